@@ -1,7 +1,9 @@
 package escrow
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 )
 
 // AtomicStorage is an interface to key-value storage with atomic operations.
@@ -11,6 +13,8 @@ type AtomicStorage interface {
 	Get(key string) (value string, ok bool, err error)
 	// GetByKeyPrefix returns list of values which keys has given prefix.
 	GetByKeyPrefix(prefix string) (values []string, err error)
+	// GetKeysByPrefix returns list of keys which has given prefix.
+	GetKeysByPrefix(prefix string) (keys []string, err error)
 	// Put uncoditionally writes value by key in storage, err is not nil in
 	// case of storage error.
 	Put(key string, value string) (err error)
@@ -26,6 +30,70 @@ type AtomicStorage interface {
 	Delete(key string) (err error)
 }
 
+// StorageTx collects changes which are made in transaction. Changes are
+// applied atomically after transaction function returns nil and discarded
+// otherwise.
+type StorageTx interface {
+	// Put writes value by key when transaction is committed
+	Put(key string, value string)
+	// Delete removes value by key when transaction is committed
+	Delete(key string)
+}
+
+// TransactionalAtomicStorage is an AtomicStorage which can apply changes of
+// several keys atomically.
+type TransactionalAtomicStorage interface {
+	AtomicStorage
+	// WithTransaction calls fn and applies changes collected by tx if fn
+	// returns nil. If fn returns error then no changes are applied and the
+	// error is returned.
+	WithTransaction(fn func(tx StorageTx) error) (err error)
+}
+
+// WithTransaction runs fn in a transaction of the storage. It returns error
+// if storage doesn't support transactions.
+func WithTransaction(storage AtomicStorage, fn func(tx StorageTx) error) (err error) {
+	transactional, ok := storage.(TransactionalAtomicStorage)
+	if !ok {
+		return errors.New("storage doesn't support transactions")
+	}
+	return transactional.WithTransaction(fn)
+}
+
+// storageTxChange is a single change collected by transaction, value is
+// nil if key is deleted.
+type storageTxChange struct {
+	key   string
+	value *string
+}
+
+// bufferedStorageTx collects transaction changes in order they are made
+type bufferedStorageTx struct {
+	changes []storageTxChange
+}
+
+func (tx *bufferedStorageTx) Put(key string, value string) {
+	tx.changes = append(tx.changes, storageTxChange{key: key, value: &value})
+}
+
+func (tx *bufferedStorageTx) Delete(key string) {
+	tx.changes = append(tx.changes, storageTxChange{key: key})
+}
+
+// prefixedStorageTx adds prefix to the keys of the transaction changes
+type prefixedStorageTx struct {
+	delegate  StorageTx
+	keyPrefix string
+}
+
+func (tx *prefixedStorageTx) Put(key string, value string) {
+	tx.delegate.Put(tx.keyPrefix+"/"+key, value)
+}
+
+func (tx *prefixedStorageTx) Delete(key string) {
+	tx.delegate.Delete(tx.keyPrefix + "/" + key)
+}
+
 // PrefixedAtomicStorage is decorator for atomic storage which adds a prefix to
 // the storage keys.
 type PrefixedAtomicStorage struct {
@@ -42,6 +110,21 @@ func (storage *PrefixedAtomicStorage) GetByKeyPrefix(prefix string) (values []st
 	return storage.delegate.GetByKeyPrefix(storage.keyPrefix + "/" + prefix)
 }
 
+// GetKeysByPrefix is implementation of AtomicStorage.GetKeysByPrefix, it
+// returns keys without storage prefix.
+func (storage *PrefixedAtomicStorage) GetKeysByPrefix(prefix string) (keys []string, err error) {
+	prefixedKeys, err := storage.delegate.GetKeysByPrefix(storage.keyPrefix + "/" + prefix)
+	if err != nil {
+		return
+	}
+
+	keys = make([]string, 0, len(prefixedKeys))
+	for _, key := range prefixedKeys {
+		keys = append(keys, strings.TrimPrefix(key, storage.keyPrefix+"/"))
+	}
+	return keys, nil
+}
+
 // Put is implementation of AtomicStorage.Put
 func (storage *PrefixedAtomicStorage) Put(key string, value string) (err error) {
 	return storage.delegate.Put(storage.keyPrefix+"/"+key, value)
@@ -61,6 +144,15 @@ func (storage *PrefixedAtomicStorage) Delete(key string) (err error) {
 	return storage.delegate.Delete(storage.keyPrefix + "/" + key)
 }
 
+// WithTransaction is implementation of
+// TransactionalAtomicStorage.WithTransaction, it returns error if delegate
+// doesn't support transactions.
+func (storage *PrefixedAtomicStorage) WithTransaction(fn func(tx StorageTx) error) (err error) {
+	return WithTransaction(storage.delegate, func(tx StorageTx) error {
+		return fn(&prefixedStorageTx{delegate: tx, keyPrefix: storage.keyPrefix})
+	})
+}
+
 // TypedAtomicStorage is an atomic storage which automatically
 // serializes/deserializes values and keys
 type TypedAtomicStorage interface {
@@ -68,6 +160,15 @@ type TypedAtomicStorage interface {
 	Get(key interface{}) (value interface{}, ok bool, err error)
 	// GetAll returns an array which contains all values from storage
 	GetAll() (array interface{}, err error)
+	// GetByKeyPrefix returns an array which contains values which serialized
+	// keys have given prefix. Prefix is not serialized.
+	GetByKeyPrefix(prefix string) (array interface{}, err error)
+	// GetAllWhere returns an array which contains values from storage for
+	// which predicate returns true. Other values are not kept in the array.
+	GetAllWhere(predicate func(value interface{}) bool) (array interface{}, err error)
+	// GetKeysByPrefix returns serialized keys which have given prefix.
+	// Prefix is not serialized.
+	GetKeysByPrefix(prefix string) (keys []string, err error)
 	// Put puts value by key unconditionally
 	Put(key interface{}, value interface{}) (err error)
 	// PutIfAbsent puts value by key if and only if key is absent in storage
@@ -112,15 +213,35 @@ func (storage *TypedAtomicStorageImpl) Get(key interface{}) (value interface{},
 	return value, true, nil
 }
 
+// GetAll implements TypedAtomicStorage.GetAll
 func (storage *TypedAtomicStorageImpl) GetAll() (array interface{}, err error) {
-	stringValues, err := storage.atomicStorage.GetByKeyPrefix("")
+	return storage.GetByKeyPrefix("")
+}
+
+// GetByKeyPrefix implements TypedAtomicStorage.GetByKeyPrefix
+func (storage *TypedAtomicStorageImpl) GetByKeyPrefix(prefix string) (array interface{}, err error) {
+	return storage.getByKeyPrefixWhere(prefix, nil)
+}
+
+// GetAllWhere implements TypedAtomicStorage.GetAllWhere
+func (storage *TypedAtomicStorageImpl) GetAllWhere(predicate func(value interface{}) bool) (array interface{}, err error) {
+	return storage.getByKeyPrefixWhere("", predicate)
+}
+
+// GetKeysByPrefix implements TypedAtomicStorage.GetKeysByPrefix
+func (storage *TypedAtomicStorageImpl) GetKeysByPrefix(prefix string) (keys []string, err error) {
+	return storage.atomicStorage.GetKeysByPrefix(prefix)
+}
+
+func (storage *TypedAtomicStorageImpl) getByKeyPrefixWhere(prefix string, predicate func(value interface{}) bool) (array interface{}, err error) {
+	stringValues, err := storage.atomicStorage.GetByKeyPrefix(prefix)
 	if err != nil {
 		return
 	}
 
 	values := reflect.MakeSlice(
 		reflect.SliceOf(reflect.PtrTo(storage.valueType)),
-		0, len(stringValues))
+		0, 0)
 
 	for _, stringValue := range stringValues {
 		value := reflect.New(storage.valueType)
@@ -128,6 +249,9 @@ func (storage *TypedAtomicStorageImpl) GetAll() (array interface{}, err error) {
 		if err != nil {
 			return nil, err
 		}
+		if predicate != nil && !predicate(value.Interface()) {
+			continue
+		}
 		values = reflect.Append(values, value)
 	}
 
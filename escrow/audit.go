@@ -0,0 +1,45 @@
+package escrow
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AuditEvent describes payment accepted by ChannelPaymentValidator.
+type AuditEvent struct {
+	// Timestamp is a time when payment was accepted
+	Timestamp time.Time
+	// ChannelID is an id of the payment channel
+	ChannelID *big.Int
+	// Nonce is a nonce of the payment channel
+	Nonce *big.Int
+	// Amount is an amount authorized by payment
+	Amount *big.Int
+	// Signer is an address of the payment signer
+	Signer common.Address
+}
+
+// AuditSink receives audit events, implementation is responsible for keeping
+// them immutable. Record is called synchronously by validator, so it should
+// not block for long time.
+type AuditSink interface {
+	Record(event AuditEvent)
+}
+
+// recordAudit sends event of the accepted payment to the audit sink if it is
+// set. Numbers are copied, so the event is not changed by later updates of
+// the payment.
+func (validator *ChannelPaymentValidator) recordAudit(payment *Payment, signer *common.Address) {
+	if validator.auditSink == nil {
+		return
+	}
+	validator.auditSink.Record(AuditEvent{
+		Timestamp: time.Now(),
+		ChannelID: new(big.Int).Set(payment.ChannelID),
+		Nonce:     new(big.Int).Set(payment.ChannelNonce),
+		Amount:    new(big.Int).Set(payment.Amount),
+		Signer:    *signer,
+	})
+}
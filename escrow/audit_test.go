@@ -0,0 +1,49 @@
+package escrow
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type capturingAuditSink struct {
+	events []AuditEvent
+}
+
+func (sink *capturingAuditSink) Record(event AuditEvent) {
+	sink.events = append(sink.events, event)
+}
+
+func TestAuditEventIsRecordedForValidPayment(t *testing.T) {
+	fixtures := newTestFixtures("audit")
+	sink := &capturingAuditSink{}
+	validator := ChannelPaymentValidatorMock()
+	WithAuditSink(sink)(validator)
+	before := time.Now()
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.Equal(t, 1, len(sink.events))
+	event := sink.events[0]
+	assert.False(t, event.Timestamp.Before(before))
+	assert.False(t, event.Timestamp.After(time.Now()))
+	assert.Equal(t, big.NewInt(42), event.ChannelID)
+	assert.Equal(t, big.NewInt(3), event.Nonce)
+	assert.Equal(t, big.NewInt(12345), event.Amount)
+	assert.Equal(t, fixtures.Address("signer"), event.Signer)
+}
+
+func TestAuditEventIsNotRecordedForInvalidPayment(t *testing.T) {
+	fixtures := newTestFixtures("audit")
+	sink := &capturingAuditSink{}
+	validator := ChannelPaymentValidatorMock()
+	WithAuditSink(sink)(validator)
+
+	err := validator.Validate(fixtures.Payment(42, 2, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.NotNil(t, err)
+	assert.Empty(t, sink.events)
+}
@@ -0,0 +1,71 @@
+package escrow
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+)
+
+// bloomFilter is a probabilistic set which never reports false negatives:
+// if mayContain returns false the value was never added. It can report
+// false positives with probability configured on creation.
+type bloomFilter struct {
+	bits      []uint64
+	size      uint64
+	hashCount uint64
+}
+
+// newBloomFilter returns bloom filter sized to keep expectedItems values
+// with falsePositiveRate probability of false positives. falsePositiveRate
+// should be in (0, 1) range.
+func newBloomFilter(expectedItems uint, falsePositiveRate float64) *bloomFilter {
+	if expectedItems == 0 {
+		expectedItems = 1
+	}
+	size := uint64(math.Ceil(-float64(expectedItems) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if size == 0 {
+		size = 1
+	}
+	hashCount := uint64(math.Round(float64(size) / float64(expectedItems) * math.Ln2))
+	if hashCount == 0 {
+		hashCount = 1
+	}
+	return &bloomFilter{
+		bits:      make([]uint64, (size+63)/64),
+		size:      size,
+		hashCount: hashCount,
+	}
+}
+
+// positions returns bit positions of the value using double hashing.
+func (filter *bloomFilter) positions(value []byte) []uint64 {
+	digest := sha256.Sum256(value)
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+
+	positions := make([]uint64, filter.hashCount)
+	for i := uint64(0); i < filter.hashCount; i++ {
+		positions[i] = (h1 + i*h2) % filter.size
+	}
+	return positions
+}
+
+func (filter *bloomFilter) add(value []byte) {
+	for _, position := range filter.positions(value) {
+		filter.bits[position/64] |= 1 << (position % 64)
+	}
+}
+
+func (filter *bloomFilter) mayContain(value []byte) bool {
+	for _, position := range filter.positions(value) {
+		if filter.bits[position/64]&(1<<(position%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sizeInBytes returns memory used by the filter bits.
+func (filter *bloomFilter) sizeInBytes() int {
+	return len(filter.bits) * 8
+}
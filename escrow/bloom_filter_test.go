@@ -0,0 +1,47 @@
+package escrow
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bloomTestValue(i int) []byte {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(i))
+	return value
+}
+
+func TestBloomFilterHasNoFalseNegatives(t *testing.T) {
+	filter := newBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.add(bloomTestValue(i))
+	}
+
+	for i := 0; i < 10000; i++ {
+		assert.True(t, filter.mayContain(bloomTestValue(i)), "False negative for value %v", i)
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	filter := newBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.add(bloomTestValue(i))
+	}
+
+	falsePositives := 0
+	for i := 10000; i < 20000; i++ {
+		if filter.mayContain(bloomTestValue(i)) {
+			falsePositives++
+		}
+	}
+
+	assert.True(t, falsePositives < 300, "Too many false positives: %v", falsePositives)
+}
+
+func TestBloomFilterEmpty(t *testing.T) {
+	filter := newBloomFilter(0, 0.01)
+
+	assert.False(t, filter.mayContain(bloomTestValue(1)))
+}
@@ -0,0 +1,40 @@
+package escrow
+
+import (
+	"math/big"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ChannelStateProvider returns state of the payment channel as it was at the
+// given block. It allows validating payments against the channel state which
+// cannot be reverted by reorganization of the chain.
+type ChannelStateProvider interface {
+	// ChannelStateAt returns channel state at block, ok is false if channel
+	// didn't exist at that block.
+	ChannelStateAt(channelID *big.Int, block *big.Int) (channel *PaymentChannelData, ok bool, err error)
+}
+
+// ValidateAtHistoricalBlock validates payment against the channel state at
+// block returned by provider set using WithChannelStateProvider. The block is
+// used as current block as well, see ValidateAtBlock. Provider error is
+// reported as Internal error and channel which didn't exist at block is
+// reported as Unauthenticated one.
+func (validator *ChannelPaymentValidator) ValidateAtHistoricalBlock(payment *Payment, block *big.Int) error {
+	if validator.channelStateProvider == nil {
+		return NewPaymentError(Internal, "channel state provider is not set")
+	}
+
+	var log = log.WithField("payment", payment).WithField("block", block)
+	channel, ok, err := validator.channelStateProvider.ChannelStateAt(payment.ChannelID, block)
+	if err != nil {
+		log.WithError(err).Error("Cannot get payment channel state at block")
+		return NewPaymentError(Internal, "payment channel error: %v", err)
+	}
+	if !ok {
+		log.Warn("Payment channel not found at block")
+		return NewPaymentError(Unauthenticated, "payment channel \"%v\" not found at block %v", payment.ChannelID, block)
+	}
+
+	return validator.ValidateAtBlock(payment, channel, block)
+}
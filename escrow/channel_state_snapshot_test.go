@@ -0,0 +1,85 @@
+package escrow
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// channelStatesByBlock keeps channel states by block number
+type channelStatesByBlock struct {
+	states map[string]*PaymentChannelData
+	err    error
+}
+
+func (provider *channelStatesByBlock) ChannelStateAt(channelID *big.Int, block *big.Int) (channel *PaymentChannelData, ok bool, err error) {
+	if provider.err != nil {
+		return nil, false, provider.err
+	}
+	channel, ok = provider.states[fmt.Sprintf("%v/%v", channelID, block)]
+	return
+}
+
+func historicalValidator(provider ChannelStateProvider) *ChannelPaymentValidator {
+	validator := ChannelPaymentValidatorMock()
+	WithChannelStateProvider(provider)(validator)
+	return validator
+}
+
+func TestValidateAtHistoricalBlock(t *testing.T) {
+	fixtures := newTestFixtures("snapshot")
+	// nonce is incremented by claim at block 50
+	provider := &channelStatesByBlock{states: map[string]*PaymentChannelData{
+		"42/40": fixtures.Channel(42, 3, 12345, 12300, 100),
+		"42/60": fixtures.Channel(42, 4, 12345, 0, 100),
+	}}
+	validator := historicalValidator(provider)
+	payment := fixtures.Payment(42, 3, 12345)
+
+	assert.Nil(t, validator.ValidateAtHistoricalBlock(payment, big.NewInt(40)))
+	assert.Equal(t, NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 4, sent: 3"),
+		validator.ValidateAtHistoricalBlock(payment, big.NewInt(60)))
+}
+
+func TestValidateAtHistoricalBlockUsesBlockAsCurrent(t *testing.T) {
+	fixtures := newTestFixtures("snapshot")
+	provider := &channelStatesByBlock{states: map[string]*PaymentChannelData{
+		"42/40":  fixtures.Channel(42, 3, 12345, 12300, 100),
+		"42/100": fixtures.Channel(42, 3, 12345, 12300, 100),
+	}}
+	validator := historicalValidator(provider)
+	payment := fixtures.Payment(42, 3, 12345)
+
+	assert.Nil(t, validator.ValidateAtHistoricalBlock(payment, big.NewInt(40)))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 100, current block: 100, expiration threshold: 0"),
+		validator.ValidateAtHistoricalBlock(payment, big.NewInt(100)))
+}
+
+func TestValidateAtHistoricalBlockChannelNotFound(t *testing.T) {
+	fixtures := newTestFixtures("snapshot")
+	validator := historicalValidator(&channelStatesByBlock{states: map[string]*PaymentChannelData{}})
+
+	err := validator.ValidateAtHistoricalBlock(fixtures.Payment(42, 3, 12345), big.NewInt(40))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment channel \"42\" not found at block 40"), err)
+}
+
+func TestValidateAtHistoricalBlockProviderError(t *testing.T) {
+	fixtures := newTestFixtures("snapshot")
+	validator := historicalValidator(&channelStatesByBlock{err: errors.New("archive node is not available")})
+
+	err := validator.ValidateAtHistoricalBlock(fixtures.Payment(42, 3, 12345), big.NewInt(40))
+
+	assert.Equal(t, NewPaymentError(Internal, "payment channel error: archive node is not available"), err)
+}
+
+func TestValidateAtHistoricalBlockWithoutProvider(t *testing.T) {
+	fixtures := newTestFixtures("snapshot")
+
+	err := ChannelPaymentValidatorMock().ValidateAtHistoricalBlock(fixtures.Payment(42, 3, 12345), big.NewInt(40))
+
+	assert.Equal(t, NewPaymentError(Internal, "channel state provider is not set"), err)
+}
@@ -0,0 +1,56 @@
+package escrow
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// gzipMagic is a header of the gzip stream, it is used to distinguish
+// compressed values from values which were stored before compression was
+// turned on.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// serializeCompressed serializes value using gob and compresses the result
+// using gzip. Header of the stream has no modification time, so the same
+// value is always serialized to the same string and CompareAndSwap works as
+// expected.
+func serializeCompressed(value interface{}) (slice string, err error) {
+	plain, err := serialize(value)
+	if err != nil {
+		return
+	}
+
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err = w.Write([]byte(plain)); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+
+	slice = string(b.Bytes())
+	return
+}
+
+// deserializeCompressed decompresses value written by serializeCompressed
+// and deserializes it using gob. Values which are not compressed are
+// deserialized as is, so compression can be turned on for existing storage.
+func deserializeCompressed(slice string, value interface{}) (err error) {
+	if !bytes.HasPrefix([]byte(slice), gzipMagic) {
+		return deserialize(slice, value)
+	}
+
+	r, err := gzip.NewReader(bytes.NewBufferString(slice))
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	plain, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	return deserialize(string(plain), value)
+}
@@ -0,0 +1,97 @@
+package escrow
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerializeCompressedRoundTrip(t *testing.T) {
+	payment := validTestPayment()
+	payment.Signature = []byte{1, 2, 3}
+
+	slice, err := serializeCompressed(payment)
+	assert.Nil(t, err)
+	actual := &Payment{}
+	err = deserializeCompressed(slice, actual)
+
+	assert.Nil(t, err)
+	assert.Equal(t, payment, actual)
+}
+
+func TestSerializeCompressedIsDeterministic(t *testing.T) {
+	first, err := serializeCompressed(validTestPayment())
+	assert.Nil(t, err)
+	second, err := serializeCompressed(validTestPayment())
+	assert.Nil(t, err)
+
+	assert.Equal(t, first, second)
+}
+
+func TestDeserializeCompressedReadsUncompressedValue(t *testing.T) {
+	slice, err := serialize(validTestPayment())
+	assert.Nil(t, err)
+	actual := &Payment{}
+
+	err = deserializeCompressed(slice, actual)
+
+	assert.Nil(t, err)
+	assert.Equal(t, validTestPayment(), actual)
+}
+
+func TestDeserializeCompressedCorruptedValue(t *testing.T) {
+	err := deserializeCompressed(string(gzipMagic)+"corrupted", &Payment{})
+
+	assert.NotNil(t, err)
+}
+
+func TestCompressedPaymentStorageRoundTrip(t *testing.T) {
+	storage := NewCompressedPaymentStorage(NewMemStorage())
+	payment := validTestPayment()
+
+	assert.Nil(t, storage.Put(payment))
+	actual, ok, err := storage.Get(payment.ChannelID, payment.ChannelNonce)
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, payment, actual)
+}
+
+func TestCompressedPaymentStorageReadsUncompressedPayments(t *testing.T) {
+	memStorage := NewMemStorage()
+	payment := validTestPayment()
+	assert.Nil(t, NewPaymentStorage(memStorage).Put(payment))
+
+	actual, ok, err := NewCompressedPaymentStorage(memStorage).Get(payment.ChannelID, payment.ChannelNonce)
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, payment, actual)
+}
+
+func TestCompressedPaymentStorageIsSmaller(t *testing.T) {
+	plainStorage := NewMemStorage()
+	compressedStorage := NewMemStorage()
+	for i := int64(0); i < 100; i++ {
+		payment := validTestPayment()
+		payment.ChannelNonce = big.NewInt(i)
+		payment.Signature = make([]byte, 65)
+		assert.Nil(t, NewPaymentStorage(plainStorage).Put(payment))
+		assert.Nil(t, NewCompressedPaymentStorage(compressedStorage).Put(payment))
+	}
+
+	plainSize := storedValuesSize(t, plainStorage)
+	compressedSize := storedValuesSize(t, compressedStorage)
+
+	assert.True(t, compressedSize < plainSize, "compressed size %v is not less than plain size %v", compressedSize, plainSize)
+}
+
+func storedValuesSize(t *testing.T, storage AtomicStorage) (size int) {
+	values, err := storage.GetByKeyPrefix(paymentStorageKeyPrefix)
+	assert.Nil(t, err)
+	for _, value := range values {
+		size += len(value)
+	}
+	return
+}
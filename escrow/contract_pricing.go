@@ -0,0 +1,92 @@
+package escrow
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// ContractPricingIncomeValidator checks that income is equal to the price
+// of the called gRPC method. Prices are read from the pricing registry
+// contract using BlockchainReader and cached to not call blockchain on
+// each request.
+type ContractPricingIncomeValidator struct {
+	reader   BlockchainReader
+	registry common.Address
+	// cacheTTL is a time price is cached for, zero means price is cached
+	// until InvalidatePrices is called.
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mutex  sync.Mutex
+	prices map[string]*cachedMethodPrice
+}
+
+type cachedMethodPrice struct {
+	price    *big.Int
+	readTime time.Time
+}
+
+// NewContractPricingIncomeValidator returns new income validator which
+// reads per method prices from the registry contract. Prices read are
+// cached for cacheTTL.
+func NewContractPricingIncomeValidator(reader BlockchainReader, registry common.Address, cacheTTL time.Duration) *ContractPricingIncomeValidator {
+	return &ContractPricingIncomeValidator{
+		reader:   reader,
+		registry: registry,
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		prices:   make(map[string]*cachedMethodPrice),
+	}
+}
+
+// Validate implements IncomeValidator.Validate.
+func (validator *ContractPricingIncomeValidator) Validate(data *IncomeData) (err error) {
+	if data.GrpcContext == nil || data.GrpcContext.Info == nil {
+		return NewPaymentError(Internal, "called method is unknown")
+	}
+	method := data.GrpcContext.Info.FullMethod
+
+	price, err := validator.price(method)
+	if err != nil {
+		log.WithError(err).WithField("method", method).WithField("registry", validator.registry).Error("Cannot read method price from contract")
+		return NewPaymentError(Internal, "cannot read price of method %v: %v", method, err)
+	}
+
+	if !data.incomeMatches(price) {
+		return NewPaymentError(Unauthenticated, "income %d does not equal to price %d of method %v", data.Income, price, method)
+	}
+
+	return
+}
+
+// InvalidatePrices removes all cached prices, so they are read from the
+// contract again on next call.
+func (validator *ContractPricingIncomeValidator) InvalidatePrices() {
+	validator.mutex.Lock()
+	defer validator.mutex.Unlock()
+
+	validator.prices = make(map[string]*cachedMethodPrice)
+}
+
+func (validator *ContractPricingIncomeValidator) price(method string) (price *big.Int, err error) {
+	validator.mutex.Lock()
+	defer validator.mutex.Unlock()
+
+	now := validator.now()
+	cached, ok := validator.prices[method]
+	if ok && (validator.cacheTTL == 0 || now.Sub(cached.readTime) < validator.cacheTTL) {
+		return cached.price, nil
+	}
+
+	price, err = validator.reader.MethodPrice(validator.registry, method)
+	if err != nil {
+		return
+	}
+	validator.prices[method] = &cachedMethodPrice{price: price, readTime: now}
+
+	return
+}
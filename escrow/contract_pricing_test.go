@@ -0,0 +1,112 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/singnet/snet-daemon/handler"
+)
+
+var testPricingRegistry = common.HexToAddress("0x0000000000000000000000000000000000000042")
+
+func methodIncome(method string, income int64) *IncomeData {
+	return &IncomeData{
+		Income: big.NewInt(income),
+		GrpcContext: &handler.GrpcStreamContext{
+			Info: &grpc.StreamServerInfo{FullMethod: method},
+		},
+	}
+}
+
+func pricingReaderMock() *blockchainReaderMock {
+	return &blockchainReaderMock{
+		prices: map[string]*big.Int{
+			"/service/Cheap":     big.NewInt(10),
+			"/service/Expensive": big.NewInt(100),
+		},
+	}
+}
+
+func TestContractPricingIncomeValidate(t *testing.T) {
+	validator := NewContractPricingIncomeValidator(pricingReaderMock(), testPricingRegistry, 0)
+
+	assert.Nil(t, validator.Validate(methodIncome("/service/Cheap", 10)))
+	assert.Nil(t, validator.Validate(methodIncome("/service/Expensive", 100)))
+}
+
+func TestContractPricingIncomeValidateWrongIncome(t *testing.T) {
+	validator := NewContractPricingIncomeValidator(pricingReaderMock(), testPricingRegistry, 0)
+
+	err := validator.Validate(methodIncome("/service/Expensive", 10))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 10 does not equal to price 100 of method /service/Expensive"), err)
+}
+
+func TestContractPricingIncomeValidateCachesPrice(t *testing.T) {
+	reader := pricingReaderMock()
+	validator := NewContractPricingIncomeValidator(reader, testPricingRegistry, 0)
+
+	validator.Validate(methodIncome("/service/Cheap", 10))
+	validator.Validate(methodIncome("/service/Cheap", 10))
+	assert.Equal(t, 1, reader.priceReads)
+
+	validator.InvalidatePrices()
+	validator.Validate(methodIncome("/service/Cheap", 10))
+	assert.Equal(t, 2, reader.priceReads)
+}
+
+func TestContractPricingIncomeValidateCacheExpires(t *testing.T) {
+	reader := pricingReaderMock()
+	validator := NewContractPricingIncomeValidator(reader, testPricingRegistry, time.Minute)
+	now := time.Unix(1000, 0)
+	validator.now = func() time.Time { return now }
+
+	validator.Validate(methodIncome("/service/Cheap", 10))
+	now = now.Add(30 * time.Second)
+	validator.Validate(methodIncome("/service/Cheap", 10))
+	assert.Equal(t, 1, reader.priceReads)
+
+	now = now.Add(30 * time.Second)
+	reader.prices["/service/Cheap"] = big.NewInt(20)
+	err := validator.Validate(methodIncome("/service/Cheap", 10))
+
+	assert.Equal(t, 2, reader.priceReads)
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 10 does not equal to price 20 of method /service/Cheap"), err)
+}
+
+func TestContractPricingIncomeValidateReadError(t *testing.T) {
+	reader := pricingReaderMock()
+	reader.priceErr = errors.New("contract call failed")
+	validator := NewContractPricingIncomeValidator(reader, testPricingRegistry, 0)
+
+	err := validator.Validate(methodIncome("/service/Cheap", 10))
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot read price of method /service/Cheap: contract call failed"), err)
+}
+
+func TestContractPricingIncomeValidateReadErrorIsNotCached(t *testing.T) {
+	reader := pricingReaderMock()
+	reader.priceErr = errors.New("contract call failed")
+	validator := NewContractPricingIncomeValidator(reader, testPricingRegistry, 0)
+
+	validator.Validate(methodIncome("/service/Cheap", 10))
+	reader.priceErr = nil
+	err := validator.Validate(methodIncome("/service/Cheap", 10))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, reader.priceReads)
+}
+
+func TestContractPricingIncomeValidateUnknownMethod(t *testing.T) {
+	validator := NewContractPricingIncomeValidator(pricingReaderMock(), testPricingRegistry, 0)
+
+	err := validator.Validate(&IncomeData{Income: big.NewInt(10), GrpcContext: &handler.GrpcStreamContext{}})
+
+	assert.Equal(t, NewPaymentError(Internal, "called method is unknown"), err)
+}
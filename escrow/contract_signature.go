@@ -0,0 +1,83 @@
+package escrow
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+)
+
+// EIP1271MagicValue is a value returned by isValidSignature method of the
+// EIP-1271 contract when signature is valid.
+var EIP1271MagicValue = [4]byte{0x16, 0x26, 0xba, 0x7e}
+
+// BlockchainReader provides read-only blockchain calls which are required
+// to verify signatures of the smart-contract wallets, proofs of funds and
+// on-chain prices.
+type BlockchainReader interface {
+	// IsContract returns true if address has contract code.
+	IsContract(address common.Address) (ok bool, err error)
+	// IsValidSignature calls EIP-1271 isValidSignature(hash, signature)
+	// method of the contract and returns its result.
+	IsValidSignature(contract common.Address, hash [32]byte, signature []byte) (magicValue [4]byte, err error)
+	// EscrowBalanceAt returns balance of the address in MultiPartyEscrow
+	// contract at the block.
+	EscrowBalanceAt(address common.Address, block *big.Int) (balance *big.Int, err error)
+	// MethodPrice returns price of the gRPC method in cogs which is
+	// published by the pricing registry contract.
+	MethodPrice(registry common.Address, method string) (price *big.Int, err error)
+	// PendingChannelExpiration returns channel expiration set by the mined
+	// extension transaction, ok is false if there is no such transaction.
+	PendingChannelExpiration(channelID *big.Int) (expiration *big.Int, ok bool, err error)
+}
+
+// getPaymentSigner returns address which signed the payment. If validator
+// is created using WithHMACAuthentication then payment MAC is verified and
+// channel signer is returned. If channel signer is a contract and
+// BlockchainReader is set by WithContractSignatures then signature is
+// verified by contract using EIP-1271 and channel signer is returned,
+// otherwise signer is recovered from ECDSA signature.
+func (validator *ChannelPaymentValidator) getPaymentSigner(payment *Payment, channel *PaymentChannelData) (signer *common.Address, err error) {
+	if validator.hmacSecret != nil {
+		return validator.verifyPaymentMAC(payment, channel)
+	}
+	if validator.blockchainReader == nil {
+		return validator.getSignerAddressFromPayment(payment)
+	}
+
+	channelSigner := channel.PaymentSignerAddress()
+	isContract, err := validator.blockchainReader.IsContract(channelSigner)
+	if err != nil {
+		log.WithError(err).WithField("signer", channelSigner).Error("Cannot check whether channel signer is contract")
+		return nil, NewPaymentError(Internal, "cannot verify contract signature: %v", err)
+	}
+	if !isContract {
+		return validator.getSignerAddressFromPayment(payment)
+	}
+
+	return validator.verifyContractSignature(payment, channelSigner)
+}
+
+func (validator *ChannelPaymentValidator) verifyContractSignature(payment *Payment, contract common.Address) (signer *common.Address, err error) {
+	message, err := getPaymentMessage(payment)
+	if err != nil {
+		log.WithField("payment", payment).WithError(err).Error("Cannot build payment message")
+		return nil, err
+	}
+
+	var hash [32]byte
+	copy(hash[:], crypto.Keccak256(validator.getSignaturePrefix(), crypto.Keccak256(message)))
+
+	magicValue, err := validator.blockchainReader.IsValidSignature(contract, hash, payment.Signature)
+	if err != nil {
+		log.WithError(err).WithField("payment", payment).Error("Cannot call isValidSignature of the channel signer contract")
+		return nil, NewPaymentError(Internal, "cannot verify contract signature: %v", err)
+	}
+	if magicValue != EIP1271MagicValue {
+		log.WithField("payment", payment).Warn("Payment signature is rejected by channel signer contract")
+		return nil, NewPaymentError(Unauthenticated, "payment signature is rejected by channel signer contract")
+	}
+
+	return &contract, nil
+}
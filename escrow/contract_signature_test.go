@@ -0,0 +1,136 @@
+package escrow
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+type blockchainReaderMock struct {
+	contracts  map[common.Address]bool
+	magicValue [4]byte
+	err        error
+
+	hash      [32]byte
+	signature []byte
+
+	balances   map[common.Address]*big.Int
+	balanceErr error
+
+	prices     map[string]*big.Int
+	priceErr   error
+	priceReads int
+
+	extensions   map[int64]*big.Int
+	extensionErr error
+}
+
+func (reader *blockchainReaderMock) IsContract(address common.Address) (bool, error) {
+	return reader.contracts[address], nil
+}
+
+func (reader *blockchainReaderMock) IsValidSignature(contract common.Address, hash [32]byte, signature []byte) ([4]byte, error) {
+	reader.hash = hash
+	reader.signature = signature
+	return reader.magicValue, reader.err
+}
+
+func (reader *blockchainReaderMock) EscrowBalanceAt(address common.Address, block *big.Int) (*big.Int, error) {
+	if reader.balanceErr != nil {
+		return nil, reader.balanceErr
+	}
+	if balance, ok := reader.balances[address]; ok {
+		return balance, nil
+	}
+	return big.NewInt(0), nil
+}
+
+func (reader *blockchainReaderMock) MethodPrice(registry common.Address, method string) (*big.Int, error) {
+	reader.priceReads++
+	if reader.priceErr != nil {
+		return nil, reader.priceErr
+	}
+	price, ok := reader.prices[method]
+	if !ok {
+		return nil, fmt.Errorf("method %v is not registered", method)
+	}
+	return price, nil
+}
+
+func (reader *blockchainReaderMock) PendingChannelExpiration(channelID *big.Int) (*big.Int, bool, error) {
+	if reader.extensionErr != nil {
+		return nil, false, reader.extensionErr
+	}
+	expiration, ok := reader.extensions[channelID.Int64()]
+	return expiration, ok, nil
+}
+
+func contractSignatureFixtures() (*testFixtures, *PaymentChannelData, *Payment) {
+	fixtures := newTestFixtures("contract signature")
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	channel.Signer = fixtures.Address("wallet")
+	payment := fixtures.Payment(42, 3, 12345)
+	payment.Signature = []byte("signature checked by contract")
+	return fixtures, channel, payment
+}
+
+func contractSignatureValidator(reader BlockchainReader) *ChannelPaymentValidator {
+	validator := ChannelPaymentValidatorMock()
+	WithContractSignatures(reader)(validator)
+	return validator
+}
+
+func TestValidateContractSignature(t *testing.T) {
+	fixtures, channel, payment := contractSignatureFixtures()
+	reader := &blockchainReaderMock{
+		contracts:  map[common.Address]bool{fixtures.Address("wallet"): true},
+		magicValue: EIP1271MagicValue,
+	}
+
+	err := contractSignatureValidator(reader).Validate(payment, channel)
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.Equal(t, payment.Signature, reader.signature)
+	message, _ := getPaymentMessage(payment)
+	assert.Equal(t, crypto.Keccak256(blockchain.HashPrefix32Bytes, crypto.Keccak256(message)), reader.hash[:])
+}
+
+func TestValidateContractSignatureRejected(t *testing.T) {
+	fixtures, channel, payment := contractSignatureFixtures()
+	reader := &blockchainReaderMock{
+		contracts:  map[common.Address]bool{fixtures.Address("wallet"): true},
+		magicValue: [4]byte{0xff, 0xff, 0xff, 0xff},
+	}
+
+	err := contractSignatureValidator(reader).Validate(payment, channel)
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment signature is rejected by channel signer contract"), err)
+}
+
+func TestValidateContractSignatureReaderError(t *testing.T) {
+	fixtures, channel, payment := contractSignatureFixtures()
+	reader := &blockchainReaderMock{
+		contracts: map[common.Address]bool{fixtures.Address("wallet"): true},
+		err:       errors.New("execution reverted"),
+	}
+
+	err := contractSignatureValidator(reader).Validate(payment, channel)
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot verify contract signature: execution reverted"), err)
+}
+
+func TestValidateEcdsaSignatureWithBlockchainReader(t *testing.T) {
+	fixtures := newTestFixtures("contract signature")
+	reader := &blockchainReaderMock{contracts: map[common.Address]bool{}}
+
+	err := contractSignatureValidator(reader).Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
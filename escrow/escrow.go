@@ -210,13 +210,15 @@ func (h *lockingPaymentChannelService) StartPaymentTransaction(payment *Payment)
 		return nil, NewPaymentError(Unauthenticated, "payment channel \"%v\" not found", channelKey)
 	}
 
-	err = h.validator.Validate(payment, channel)
+	amount, err := h.validator.ValidateCumulative(payment, channel)
 	if err != nil {
 		return
 	}
 
+	cumulative := *payment
+	cumulative.Amount = amount
 	return &paymentTransaction{
-		payment: *payment,
+		payment: cumulative,
 		channel: channel,
 		lock:    lock,
 		service: h,
@@ -244,6 +246,9 @@ func (payment *paymentTransaction) Commit() error {
 			FullAmount:       payment.channel.FullAmount,
 			Expiration:       payment.channel.Expiration,
 			Signer:           payment.channel.Signer,
+			PaymentSigner:    payment.channel.PaymentSigner,
+			TokenDecimals:    payment.channel.TokenDecimals,
+			Token:            payment.channel.Token,
 			AuthorizedAmount: payment.payment.Amount,
 			Signature:        payment.payment.Signature,
 			GroupID:          payment.channel.GroupID,
@@ -267,5 +272,5 @@ func (payment *paymentTransaction) Rollback() error {
 			log.Debug("Payment rolled back, channel unlocked")
 		}
 	}(payment)
-	return nil
+	return payment.service.validator.ReleasePayment(&payment.payment, payment.channel)
 }
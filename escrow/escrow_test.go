@@ -151,10 +151,10 @@ func (suite *PaymentChannelServiceSuite) mpeChannel() *blockchain.MultiPartyEscr
 
 func (suite *PaymentChannelServiceSuite) payment() *Payment {
 	payment := &Payment{
-		Amount:       big.NewInt(12300),
-		ChannelID:    big.NewInt(42),
-		ChannelNonce: big.NewInt(3),
-		//MpeContractAddress: suite.mpeContractAddress,
+		Amount:             big.NewInt(12300),
+		ChannelID:          big.NewInt(42),
+		ChannelNonce:       big.NewInt(3),
+		MpeContractAddress: suite.mpeContractAddress,
 	}
 	SignTestPayment(payment, suite.signerPrivateKey)
 	return payment
@@ -270,6 +270,71 @@ func (suite *PaymentChannelServiceSuite) TestPaymentSequentialTransactionAfterRo
 	assert.Equal(suite.T(), suite.channelPlusPayment(paymentB), channel)
 }
 
+func (suite *PaymentChannelServiceSuite) TestPaymentRetryAfterRollbackWithSignatureGuard() {
+	service := *suite.service.(*lockingPaymentChannelService)
+	validator := *service.validator
+	WithSignatureGuard(NewSignatureGuard(suite.memoryStorage))(&validator)
+	service.validator = &validator
+	payment := suite.payment()
+
+	transactionA, errA := service.StartPaymentTransaction(payment)
+	errAC := transactionA.Rollback()
+	transactionB, errB := service.StartPaymentTransaction(payment)
+	errBC := transactionB.Commit()
+
+	assert.Nil(suite.T(), errA, "Unexpected error: %v", errA)
+	assert.Nil(suite.T(), errAC, "Unexpected error: %v", errAC)
+	assert.Nil(suite.T(), errB, "Unexpected error: %v", errB)
+	assert.Nil(suite.T(), errBC, "Unexpected error: %v", errBC)
+}
+
+func (suite *PaymentChannelServiceSuite) TestPaymentTransactionDeltaAmount() {
+	paymentA := suite.payment()
+	paymentA.Amount = big.NewInt(13)
+	SignTestPayment(paymentA, suite.signerPrivateKey)
+	paymentB := suite.payment()
+	paymentB.Amount = big.NewInt(17)
+	SignTestPayment(paymentB, suite.signerPrivateKey)
+	deltaB := *paymentB
+	deltaB.Amount = big.NewInt(4)
+	service := *suite.service.(*lockingPaymentChannelService)
+	validator := *service.validator
+	WithDeltaAmounts()(&validator)
+	service.validator = &validator
+
+	transactionA, errA := suite.service.StartPaymentTransaction(paymentA)
+	errAC := transactionA.Commit()
+	transactionB, errB := service.StartPaymentTransaction(&deltaB)
+	errBC := transactionB.Commit()
+	channel, ok, errC := suite.storage.Get(suite.channelKey())
+
+	assert.Nil(suite.T(), errA, "Unexpected error: %v", errA)
+	assert.Nil(suite.T(), errAC, "Unexpected error: %v", errAC)
+	assert.Nil(suite.T(), errB, "Unexpected error: %v", errB)
+	assert.Nil(suite.T(), errBC, "Unexpected error: %v", errBC)
+	assert.Nil(suite.T(), errC, "Unexpected error: %v", errC)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), suite.channelPlusPayment(paymentB), channel)
+	assert.Equal(suite.T(), big.NewInt(4), deltaB.Amount)
+}
+
+func (suite *PaymentChannelServiceSuite) TestRolledBackPaymentDoesNotConsumeSpendingCap() {
+	service := *suite.service.(*lockingPaymentChannelService)
+	validator := *service.validator
+	tracker := NewSpendingCapTracker(suite.memoryStorage, big.NewInt(20000))
+	WithSpendingCaps(tracker)(&validator)
+	service.validator = &validator
+
+	transaction, errA := service.StartPaymentTransaction(suite.payment())
+	errB := transaction.Rollback()
+	spent, errC := tracker.Spent(suite.signerAddress)
+
+	assert.Nil(suite.T(), errA, "Unexpected error: %v", errA)
+	assert.Nil(suite.T(), errB, "Unexpected error: %v", errB)
+	assert.Nil(suite.T(), errC, "Unexpected error: %v", errC)
+	assert.Equal(suite.T(), big.NewInt(0), spent)
+}
+
 func (suite *PaymentChannelServiceSuite) TestStartClaim() {
 	transaction, _ := suite.service.StartPaymentTransaction(suite.payment())
 	transaction.Commit()
@@ -277,10 +342,13 @@ func (suite *PaymentChannelServiceSuite) TestStartClaim() {
 	claim, errA := suite.service.StartClaim(suite.channelKey(), IncrementChannelNonce)
 	claims, errB := suite.paymentStorage.GetAll()
 
+	// MpeContractAddress is not kept in the channel state
+	expectedPayment := suite.payment()
+	expectedPayment.MpeContractAddress = common.Address{}
 	assert.Nil(suite.T(), errA, "Unexpected error: %v", errA)
 	assert.Nil(suite.T(), errB, "Unexpected error: %v", errB)
-	assert.Equal(suite.T(), suite.payment(), claim.Payment())
-	assert.Equal(suite.T(), []*Payment{suite.payment()}, claims)
+	assert.Equal(suite.T(), expectedPayment, claim.Payment())
+	assert.Equal(suite.T(), []*Payment{expectedPayment}, claims)
 }
 
 func (suite *PaymentChannelServiceSuite) TestVerifyGroupId() {
@@ -0,0 +1,53 @@
+package escrow
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// FailureCase is a payment which failed validation together with the
+// channel state it was validated against. Cases are written by
+// WriteFailureCorpus and read by ReadFailureCorpus to reproduce production
+// failures in tests.
+type FailureCase struct {
+	// Payment is the payment which failed validation
+	Payment *Payment
+	// Channel is the channel state the payment was validated against
+	Channel *PaymentChannelData
+	// Code is a code of the validation error, it is zero if error is not
+	// PaymentError.
+	Code PaymentErrorCode `json:",omitempty"`
+	// Error is a message of the validation error
+	Error string
+}
+
+// WriteFailureCorpus appends failure case to the corpus written to w. Each
+// case is written as a separate line of JSON, so corpus can be collected by
+// appending to the same file.
+func WriteFailureCorpus(w io.Writer, payment *Payment, channel *PaymentChannelData, err error) error {
+	failure := &FailureCase{Payment: payment, Channel: channel}
+	if err != nil {
+		failure.Error = err.Error()
+		if paymentErr, ok := err.(*PaymentError); ok {
+			failure.Code = paymentErr.Code
+		}
+	}
+	return json.NewEncoder(w).Encode(failure)
+}
+
+// ReadFailureCorpus reads all failure cases written by WriteFailureCorpus.
+func ReadFailureCorpus(r io.Reader) (cases []*FailureCase, err error) {
+	decoder := json.NewDecoder(r)
+	cases = []*FailureCase{}
+	for {
+		failure := &FailureCase{}
+		err = decoder.Decode(failure)
+		if err == io.EOF {
+			return cases, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, failure)
+	}
+}
@@ -0,0 +1,47 @@
+package escrow
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureCorpusRoundTrip(t *testing.T) {
+	fixtures := newTestFixtures("corpus")
+	validator := ChannelPaymentValidatorMock()
+	payment := fixtures.Payment(42, 3, 12345)
+	payment.CallDeadline = big.NewInt(150)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	validationErr := validator.Validate(payment, channel)
+	assert.NotNil(t, validationErr)
+	corpus := &bytes.Buffer{}
+
+	assert.Nil(t, WriteFailureCorpus(corpus, payment, channel, validationErr))
+	assert.Nil(t, WriteFailureCorpus(corpus, fixtures.Payment(43, 1, 100), fixtures.Channel(43, 1, 100, 0, 100), errors.New("storage error")))
+	cases, err := ReadFailureCorpus(corpus)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(cases))
+	assert.Equal(t, payment, cases[0].Payment)
+	assert.Equal(t, channel, cases[0].Channel)
+	assert.Equal(t, ChannelExtensionRequired, cases[0].Code)
+	assert.Equal(t, validationErr, validator.Validate(cases[0].Payment, cases[0].Channel))
+	assert.Equal(t, PaymentErrorCode(0), cases[1].Code)
+	assert.Equal(t, "storage error", cases[1].Error)
+}
+
+func TestReadEmptyFailureCorpus(t *testing.T) {
+	cases, err := ReadFailureCorpus(&bytes.Buffer{})
+
+	assert.Nil(t, err)
+	assert.Empty(t, cases)
+}
+
+func TestReadMalformedFailureCorpus(t *testing.T) {
+	_, err := ReadFailureCorpus(bytes.NewBufferString("{\"Payment\": 1}\n"))
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,90 @@
+package escrow
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// testFixtures generates reproducible keys, payments and channels from seed,
+// so test failures can be reproduced using the same seed.
+type testFixtures struct {
+	seed string
+}
+
+func newTestFixtures(seed string) *testFixtures {
+	return &testFixtures{seed: seed}
+}
+
+// PrivateKey returns private key derived from the seed and the key name
+func (fixtures *testFixtures) PrivateKey(name string) *ecdsa.PrivateKey {
+	privateKey, err := crypto.ToECDSA(crypto.Keccak256([]byte(fixtures.seed + "/" + name)))
+	if err != nil {
+		panic(fmt.Sprintf("Cannot derive private key for test: %v", err))
+	}
+	return privateKey
+}
+
+// Address returns address of the private key with the given name
+func (fixtures *testFixtures) Address(name string) common.Address {
+	return crypto.PubkeyToAddress(fixtures.PrivateKey(name).PublicKey)
+}
+
+// Payment returns payment signed by "signer" key
+func (fixtures *testFixtures) Payment(channelID, nonce, amount int64) *Payment {
+	payment := &Payment{
+		MpeContractAddress: fixtures.Address("mpe"),
+		ChannelID:          big.NewInt(channelID),
+		ChannelNonce:       big.NewInt(nonce),
+		Amount:             big.NewInt(amount),
+	}
+	SignTestPayment(payment, fixtures.PrivateKey("signer"))
+	return payment
+}
+
+// Channel returns open channel which accepts payments returned by Payment
+func (fixtures *testFixtures) Channel(channelID, nonce, fullAmount, authorizedAmount, expiration int64) *PaymentChannelData {
+	return &PaymentChannelData{
+		ChannelID:        big.NewInt(channelID),
+		Nonce:            big.NewInt(nonce),
+		State:            Open,
+		Sender:           fixtures.Address("sender"),
+		Recipient:        fixtures.Address("recipient"),
+		GroupID:          [32]byte{123},
+		FullAmount:       big.NewInt(fullAmount),
+		Expiration:       big.NewInt(expiration),
+		Signer:           fixtures.Address("signer"),
+		AuthorizedAmount: big.NewInt(authorizedAmount),
+		Signature:        nil,
+	}
+}
+
+func TestTestFixturesAreDeterministic(t *testing.T) {
+	fixturesA := newTestFixtures("escrow")
+	fixturesB := newTestFixtures("escrow")
+
+	assert.Equal(t, fixturesA.PrivateKey("signer"), fixturesB.PrivateKey("signer"))
+	assert.Equal(t, fixturesA.Payment(42, 3, 12345), fixturesB.Payment(42, 3, 12345))
+	assert.Equal(t, fixturesA.Channel(42, 3, 12345, 12300, 100), fixturesB.Channel(42, 3, 12345, 12300, 100))
+}
+
+func TestTestFixturesDependOnSeed(t *testing.T) {
+	fixturesA := newTestFixtures("escrow")
+	fixturesB := newTestFixtures("another seed")
+
+	assert.NotEqual(t, fixturesA.Address("signer"), fixturesB.Address("signer"))
+	assert.NotEqual(t, fixturesA.Payment(42, 3, 12345).Signature, fixturesB.Payment(42, 3, 12345).Signature)
+}
+
+func TestTestFixturesPaymentIsValid(t *testing.T) {
+	fixtures := newTestFixtures("escrow")
+
+	err := ChannelPaymentValidatorMock().Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
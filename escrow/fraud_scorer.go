@@ -0,0 +1,34 @@
+package escrow
+
+import (
+	"math"
+)
+
+// FraudScorer estimates risk of the payment using operator's anti-fraud
+// model. It allows rejecting suspicious payments which are otherwise valid.
+type FraudScorer interface {
+	// Score returns risk score of the payment, the higher the score the more
+	// suspicious the payment is.
+	Score(payment *Payment, channel *PaymentChannelData) (score float64, err error)
+}
+
+// checkFraudScore returns SuspectedFraud error if payment score is above the
+// threshold set by WithFraudScorer. Score which is NaN or infinity cannot be
+// compared with threshold, so it is reported as Internal error.
+func (validator *ChannelPaymentValidator) checkFraudScore(payment *Payment, channel *PaymentChannelData) *PaymentError {
+	if validator.fraudScorer == nil {
+		return nil
+	}
+
+	score, err := validator.fraudScorer.Score(payment, channel)
+	if err != nil {
+		return NewPaymentError(Internal, "cannot score payment: %v", err)
+	}
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return NewPaymentError(Internal, "payment score is not a finite number: %v", score)
+	}
+	if score > validator.fraudThreshold {
+		return NewPaymentError(SuspectedFraud, "payment is rejected as suspicious, score: %v, threshold: %v", score, validator.fraudThreshold)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package escrow
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fraudScorerMock struct {
+	score    float64
+	err      error
+	payments []*Payment
+}
+
+func (scorer *fraudScorerMock) Score(payment *Payment, channel *PaymentChannelData) (float64, error) {
+	scorer.payments = append(scorer.payments, payment)
+	return scorer.score, scorer.err
+}
+
+func fraudScorerFixtures(score float64) (*testFixtures, *ChannelPaymentValidator, *fraudScorerMock) {
+	fixtures := newTestFixtures("fraud scorer")
+	scorer := &fraudScorerMock{score: score}
+	validator := ChannelPaymentValidatorMock()
+	WithFraudScorer(scorer, 0.8)(validator)
+	return fixtures, validator, scorer
+}
+
+func TestFraudScoreBelowThreshold(t *testing.T) {
+	fixtures, validator, scorer := fraudScorerFixtures(0.3)
+	payment := fixtures.Payment(42, 3, 12345)
+
+	err := validator.Validate(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.Equal(t, []*Payment{payment}, scorer.payments)
+}
+
+func TestFraudScoreAtThreshold(t *testing.T) {
+	fixtures, validator, _ := fraudScorerFixtures(0.8)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestFraudScoreAboveThreshold(t *testing.T) {
+	fixtures, validator, _ := fraudScorerFixtures(0.95)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(SuspectedFraud, "payment is rejected as suspicious, score: 0.95, threshold: 0.8"), err)
+}
+
+func TestFraudScoreAboveThresholdIsNotPersisted(t *testing.T) {
+	fixtures, validator, _ := fraudScorerFixtures(0.95)
+	storage := NewPaymentStorage(NewMemStorage())
+	WithPaymentPersistence(storage)(validator)
+
+	validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	_, ok, err := storage.Get(big.NewInt(42), big.NewInt(3))
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.False(t, ok)
+}
+
+func TestFraudScoreIsNotCalledForInvalidPayment(t *testing.T) {
+	fixtures, validator, scorer := fraudScorerFixtures(0.3)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12346), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "not enough tokens on payment channel, channel amount: 12345, payment amount: 12346"), err)
+	assert.Empty(t, scorer.payments)
+}
+
+func TestFraudScorerError(t *testing.T) {
+	fixtures, validator, scorer := fraudScorerFixtures(0)
+	scorer.err = errors.New("risk model is unavailable")
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot score payment: risk model is unavailable"), err)
+}
+
+func TestFraudScoreIsNotFinite(t *testing.T) {
+	for _, score := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		fixtures, validator, _ := fraudScorerFixtures(score)
+
+		err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+		assert.Equal(t, NewPaymentError(Internal, "payment score is not a finite number: %v", score), err)
+	}
+}
+
+func TestDiagnoseFraudScore(t *testing.T) {
+	fixtures, validator, _ := fraudScorerFixtures(0.95)
+
+	report := validator.Diagnose(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, ValidationReportEntry{
+		Check:  "fraud",
+		Passed: false,
+		Detail: "payment is rejected as suspicious, score: 0.95, threshold: 0.8",
+	}, report.Entries[len(report.Entries)-1])
+}
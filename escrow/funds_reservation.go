@@ -0,0 +1,199 @@
+package escrow
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const fundsReservationStorageKeyPrefix = "/payment/reservation"
+
+// FundsReservationStorage reserves price of the call from the channel
+// amount which is not authorized yet. Reservation is either committed when
+// call is finished and paid or released when call fails. Reservations of
+// the channel are kept in a single record which is updated using
+// CompareAndSwap, so concurrent reservations cannot oversubscribe the
+// channel even when they are made by different replicas. Reservations which
+// are neither committed nor released in ttl, for instance because replica
+// crashed during the call, expire and their amount becomes available again.
+type FundsReservationStorage struct {
+	delegate TypedAtomicStorage
+	// ttl is a time reservation is kept for, zero means reservation is kept
+	// until it is committed or released.
+	ttl time.Duration
+	now func() time.Time
+}
+
+// channelReservations keeps all reservations of the channel, slice is used
+// instead of map to make serialized value deterministic which is required
+// by CompareAndSwap.
+type channelReservations struct {
+	Reservations []fundsReservation
+}
+
+type fundsReservation struct {
+	ID        string
+	Amount    *big.Int
+	CreatedAt time.Time
+}
+
+// NewFundsReservationStorage returns new instance of FundsReservationStorage
+// which reservations expire after ttl.
+func NewFundsReservationStorage(atomicStorage AtomicStorage, ttl time.Duration) *FundsReservationStorage {
+	return &FundsReservationStorage{
+		delegate: &TypedAtomicStorageImpl{
+			atomicStorage: &PrefixedAtomicStorage{
+				delegate:  atomicStorage,
+				keyPrefix: fundsReservationStorageKeyPrefix,
+			},
+			keySerializer:     serializeStringKey,
+			valueSerializer:   serialize,
+			valueDeserializer: deserialize,
+			valueType:         reflect.TypeOf(channelReservations{}),
+		},
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// Reserve reserves amount from the channel capacity which is FullAmount
+// minus AuthorizedAmount minus amounts reserved before. It returns error if
+// capacity is not enough.
+func (storage *FundsReservationStorage) Reserve(channel *PaymentChannelData, amount *big.Int) (reservationID string, err error) {
+	if amount.Sign() <= 0 {
+		return "", fmt.Errorf("reserved amount should be positive: %v", amount)
+	}
+
+	reservationID, err = newReservationID(channel.ChannelID)
+	if err != nil {
+		return
+	}
+
+	err = storage.update(channel.ChannelID.String(), func(reservations *channelReservations) error {
+		available := new(big.Int).Sub(channel.FullAmount, channel.AuthorizedAmount)
+		available.Sub(available, reservations.total())
+		if available.Cmp(amount) < 0 {
+			return fmt.Errorf("not enough funds to reserve %v, available: %v", amount, available)
+		}
+		reservations.Reservations = append(reservations.Reservations, fundsReservation{ID: reservationID, Amount: amount, CreatedAt: storage.now()})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return reservationID, nil
+}
+
+// Commit removes reservation after call is paid, the amount is expected to
+// be authorized by channel AuthorizedAmount since then.
+func (storage *FundsReservationStorage) Commit(reservationID string) (err error) {
+	return storage.remove(reservationID)
+}
+
+// Release removes reservation of the failed call, so the amount can be
+// reserved again. Both Commit and Release return error if reservation is
+// not found, for instance because it is expired.
+func (storage *FundsReservationStorage) Release(reservationID string) (err error) {
+	return storage.remove(reservationID)
+}
+
+// Reserved returns total amount reserved from the channel, expired
+// reservations are not counted.
+func (storage *FundsReservationStorage) Reserved(channelID *big.Int) (amount *big.Int, err error) {
+	value, ok, err := storage.delegate.Get(channelID.String())
+	if err != nil {
+		return
+	}
+	if !ok {
+		return big.NewInt(0), nil
+	}
+	reservations := value.(*channelReservations)
+	storage.removeExpired(reservations)
+	return reservations.total(), nil
+}
+
+func (storage *FundsReservationStorage) remove(reservationID string) (err error) {
+	channelID := strings.SplitN(reservationID, "/", 2)[0]
+	return storage.update(channelID, func(reservations *channelReservations) error {
+		for i, reservation := range reservations.Reservations {
+			if reservation.ID == reservationID {
+				reservations.Reservations = append(reservations.Reservations[:i:i], reservations.Reservations[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("reservation %v is not found", reservationID)
+	})
+}
+
+// update removes expired reservations of the channel, applies change to
+// the rest and writes the result using CompareAndSwap, change is repeated
+// on the fresh value when record is modified concurrently.
+func (storage *FundsReservationStorage) update(channelID string, change func(reservations *channelReservations) error) (err error) {
+	for {
+		value, ok, err := storage.delegate.Get(channelID)
+		if err != nil {
+			return err
+		}
+
+		prev := &channelReservations{}
+		if ok {
+			prev = value.(*channelReservations)
+		}
+		next := &channelReservations{
+			Reservations: append([]fundsReservation{}, prev.Reservations...),
+		}
+		storage.removeExpired(next)
+		if err = change(next); err != nil {
+			return err
+		}
+
+		if ok {
+			ok, err = storage.delegate.CompareAndSwap(channelID, prev, next)
+		} else {
+			ok, err = storage.delegate.PutIfAbsent(channelID, next)
+		}
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// removeExpired removes reservations which are kept longer than ttl
+func (storage *FundsReservationStorage) removeExpired(reservations *channelReservations) {
+	if storage.ttl == 0 {
+		return
+	}
+	now := storage.now()
+	active := reservations.Reservations[:0]
+	for _, reservation := range reservations.Reservations {
+		if now.Sub(reservation.CreatedAt) < storage.ttl {
+			active = append(active, reservation)
+		}
+	}
+	reservations.Reservations = active
+}
+
+func (reservations *channelReservations) total() *big.Int {
+	total := big.NewInt(0)
+	for _, reservation := range reservations.Reservations {
+		total.Add(total, reservation.Amount)
+	}
+	return total
+}
+
+// newReservationID returns unique id of the reservation prefixed by channel
+// id, so reservation can be found by id only.
+func newReservationID(channelID *big.Int) (id string, err error) {
+	random := make([]byte, 16)
+	if _, err = rand.Read(random); err != nil {
+		return
+	}
+	return fmt.Sprintf("%v/%v", channelID, hex.EncodeToString(random)), nil
+}
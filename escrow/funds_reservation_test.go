@@ -0,0 +1,214 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FundsReservationStorageSuite struct {
+	suite.Suite
+
+	storage  *FundsReservationStorage
+	fixtures *testFixtures
+	now      time.Time
+}
+
+func TestFundsReservationStorageSuite(t *testing.T) {
+	suite.Run(t, new(FundsReservationStorageSuite))
+}
+
+func (suite *FundsReservationStorageSuite) SetupTest() {
+	suite.storage = NewFundsReservationStorage(NewMemStorage(), time.Minute)
+	suite.now = time.Unix(1000, 0)
+	suite.storage.now = func() time.Time { return suite.now }
+	suite.fixtures = newTestFixtures("reservation")
+}
+
+func (suite *FundsReservationStorageSuite) reserved(channelID int64) *big.Int {
+	reserved, err := suite.storage.Reserved(big.NewInt(channelID))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	return reserved
+}
+
+func (suite *FundsReservationStorageSuite) TestReserve() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+
+	_, err := suite.storage.Reserve(channel, big.NewInt(20))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	_, err = suite.storage.Reserve(channel, big.NewInt(40))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	assert.Equal(suite.T(), big.NewInt(60), suite.reserved(42))
+}
+
+func (suite *FundsReservationStorageSuite) TestReserveNotEnoughFunds() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+	_, err := suite.storage.Reserve(channel, big.NewInt(50))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	_, err = suite.storage.Reserve(channel, big.NewInt(11))
+
+	assert.Equal(suite.T(), errors.New("not enough funds to reserve 11, available: 10"), err)
+	assert.Equal(suite.T(), big.NewInt(50), suite.reserved(42))
+}
+
+func (suite *FundsReservationStorageSuite) TestReserveNonPositiveAmount() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+
+	_, err := suite.storage.Reserve(channel, big.NewInt(0))
+
+	assert.Equal(suite.T(), errors.New("reserved amount should be positive: 0"), err)
+}
+
+func (suite *FundsReservationStorageSuite) TestReleaseMakesFundsAvailable() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+	reservationID, err := suite.storage.Reserve(channel, big.NewInt(60))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	err = suite.storage.Release(reservationID)
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	assert.Equal(suite.T(), "0", suite.reserved(42).String())
+	_, err = suite.storage.Reserve(channel, big.NewInt(60))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *FundsReservationStorageSuite) TestCommit() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+	committed, err := suite.storage.Reserve(channel, big.NewInt(20))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	_, err = suite.storage.Reserve(channel, big.NewInt(30))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	err = suite.storage.Commit(committed)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), big.NewInt(30), suite.reserved(42))
+}
+
+func (suite *FundsReservationStorageSuite) TestCommitTwice() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+	reservationID, err := suite.storage.Reserve(channel, big.NewInt(20))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Nil(suite.T(), suite.storage.Commit(reservationID))
+
+	err = suite.storage.Release(reservationID)
+
+	assert.Equal(suite.T(), errors.New("reservation "+reservationID+" is not found"), err)
+}
+
+func (suite *FundsReservationStorageSuite) TestReservationsOfChannelsAreIndependent() {
+	_, err := suite.storage.Reserve(suite.fixtures.Channel(42, 3, 100, 40, 1000), big.NewInt(60))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	_, err = suite.storage.Reserve(suite.fixtures.Channel(43, 3, 100, 40, 1000), big.NewInt(60))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *FundsReservationStorageSuite) TestConcurrentReservationsDoNotOversubscribe() {
+	channel := suite.fixtures.Channel(42, 3, 100, 0, 1000)
+	const attempts = 50
+
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = suite.storage.Reserve(channel, big.NewInt(7))
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	assert.Equal(suite.T(), 14, succeeded)
+	assert.Equal(suite.T(), big.NewInt(98), suite.reserved(42))
+}
+
+func (suite *FundsReservationStorageSuite) TestConcurrentReserveAndRelease() {
+	channel := suite.fixtures.Channel(42, 3, 100, 0, 1000)
+	const workers = 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				reservationID, err := suite.storage.Reserve(channel, big.NewInt(10))
+				if err != nil {
+					continue
+				}
+				reserved, err := suite.storage.Reserved(big.NewInt(42))
+				assert.Nil(suite.T(), err)
+				assert.True(suite.T(), reserved.Cmp(big.NewInt(100)) <= 0, "oversubscribed: %v", reserved)
+				assert.Nil(suite.T(), suite.storage.Release(reservationID))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(suite.T(), "0", suite.reserved(42).String())
+}
+
+func (suite *FundsReservationStorageSuite) TestExpiredReservationMakesFundsAvailable() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+	_, err := suite.storage.Reserve(channel, big.NewInt(60))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	suite.now = suite.now.Add(30 * time.Second)
+	_, err = suite.storage.Reserve(channel, big.NewInt(1))
+	assert.Equal(suite.T(), errors.New("not enough funds to reserve 1, available: 0"), err)
+
+	suite.now = suite.now.Add(30 * time.Second)
+	_, err = suite.storage.Reserve(channel, big.NewInt(60))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), big.NewInt(60), suite.reserved(42))
+}
+
+func (suite *FundsReservationStorageSuite) TestReservedIgnoresExpiredReservations() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+	_, err := suite.storage.Reserve(channel, big.NewInt(20))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	suite.now = suite.now.Add(30 * time.Second)
+	_, err = suite.storage.Reserve(channel, big.NewInt(30))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	suite.now = suite.now.Add(30 * time.Second)
+
+	assert.Equal(suite.T(), big.NewInt(30), suite.reserved(42))
+}
+
+func (suite *FundsReservationStorageSuite) TestReleaseExpiredReservation() {
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+	reservationID, err := suite.storage.Reserve(channel, big.NewInt(20))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	suite.now = suite.now.Add(time.Minute)
+
+	err = suite.storage.Release(reservationID)
+
+	assert.Equal(suite.T(), errors.New("reservation "+reservationID+" is not found"), err)
+}
+
+func (suite *FundsReservationStorageSuite) TestReservationWithoutTTLDoesNotExpire() {
+	suite.storage.ttl = 0
+	channel := suite.fixtures.Channel(42, 3, 100, 40, 1000)
+	_, err := suite.storage.Reserve(channel, big.NewInt(20))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	suite.now = suite.now.Add(24 * time.Hour)
+
+	assert.Equal(suite.T(), big.NewInt(20), suite.reserved(42))
+}
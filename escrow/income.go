@@ -2,6 +2,7 @@ package escrow
 
 import (
 	"math/big"
+	"sync"
 
 	"github.com/singnet/snet-daemon/handler"
 )
@@ -16,6 +17,26 @@ type IncomeData struct {
 	// GrpcContext contains gRPC stream context information. For instance
 	// metadata could be used to pass invoice id to check pricing.
 	GrpcContext *handler.GrpcStreamContext
+	// ChannelID is an id of the payment channel which is used to pay for the
+	// call.
+	ChannelID *big.Int
+	// TokenDecimals is a number of decimal places of the channel token,
+	// Income is expressed in the smallest units of this token. Zero means
+	// DefaultTokenDecimals.
+	TokenDecimals int
+	// Token is an identifier of the token Income is paid in. Empty string
+	// means the token of the MultiPartyEscrow contract.
+	Token string
+}
+
+// incomeMatches returns true if income is equal to the price in cogs after
+// both are normalized to the common token unit.
+func (data *IncomeData) incomeMatches(priceInCogs *big.Int) bool {
+	decimals := data.TokenDecimals
+	if decimals == 0 {
+		decimals = DefaultTokenDecimals
+	}
+	return CompareTokenAmounts(data.Income, decimals, priceInCogs, DefaultTokenDecimals) == 0
 }
 
 // IncomeValidator uses pricing information to check that call was payed
@@ -32,6 +53,8 @@ type IncomeValidator interface {
 
 type incomeValidator struct {
 	priceInCogs *big.Int
+	// surchargeInCogs is optional, when set it is added to the price.
+	surchargeInCogs *big.Int
 }
 
 // NewIncomeValidator returns new income validator instance
@@ -39,14 +62,213 @@ func NewIncomeValidator(priceInCogs *big.Int) (validator IncomeValidator) {
 	return &incomeValidator{priceInCogs: priceInCogs}
 }
 
+// NewIncomeValidatorWithSurcharge returns new income validator which
+// requires income to be equal to the price plus surcharge, for instance
+// network fee added by operator. Income which covers the base price only is
+// rejected.
+func NewIncomeValidatorWithSurcharge(priceInCogs *big.Int, surchargeInCogs *big.Int) (validator IncomeValidator) {
+	return &incomeValidator{priceInCogs: priceInCogs, surchargeInCogs: surchargeInCogs}
+}
+
 func (validator *incomeValidator) Validate(data *IncomeData) (err error) {
 
 	price := validator.priceInCogs
 
-	if data.Income.Cmp(price) != 0 {
+	if validator.surchargeInCogs != nil {
+		required := new(big.Int).Add(price, validator.surchargeInCogs)
+		if !data.incomeMatches(required) {
+			err = NewPaymentError(Unauthenticated, "income %d does not equal to price %d plus surcharge %d", data.Income, price, validator.surchargeInCogs)
+		}
+		return
+	}
+
+	if !data.incomeMatches(price) {
 		err = NewPaymentError(Unauthenticated, "income %d does not equal to price %d", data.Income, price)
 		return
 	}
 
 	return
 }
+
+// ChannelPriceLookup returns price negotiated for the channel, ok is false
+// if channel has no custom price.
+type ChannelPriceLookup func(channelID *big.Int) (price *big.Int, ok bool)
+
+// ChannelPricingIncomeValidator checks that income is equal to the price
+// of the call. Price is looked up by the payment channel id and default
+// price is used if channel has no custom price.
+type ChannelPricingIncomeValidator struct {
+	defaultPriceInCogs *big.Int
+	lookup             ChannelPriceLookup
+}
+
+// NewChannelPricingIncomeValidator returns new income validator which uses
+// channel specific prices returned by lookup.
+func NewChannelPricingIncomeValidator(defaultPriceInCogs *big.Int, lookup ChannelPriceLookup) *ChannelPricingIncomeValidator {
+	return &ChannelPricingIncomeValidator{
+		defaultPriceInCogs: defaultPriceInCogs,
+		lookup:             lookup,
+	}
+}
+
+// Validate implements IncomeValidator.Validate.
+func (validator *ChannelPricingIncomeValidator) Validate(data *IncomeData) (err error) {
+	price := validator.price(data.ChannelID)
+
+	if !data.incomeMatches(price) {
+		return NewPaymentError(Unauthenticated, "income %d does not equal to price %d", data.Income, price)
+	}
+
+	return
+}
+
+func (validator *ChannelPricingIncomeValidator) price(channelID *big.Int) *big.Int {
+	if channelID == nil || validator.lookup == nil {
+		return validator.defaultPriceInCogs
+	}
+	if price, ok := validator.lookup(channelID); ok {
+		return price
+	}
+	return validator.defaultPriceInCogs
+}
+
+// TokenRate returns number of cogs which one smallest unit of the token is
+// worth. It is used to convert income paid in a secondary token to cogs.
+type TokenRate func(token string) (cogsPerUnit *big.Rat, err error)
+
+// MultiTokenIncomeValidator checks income which can be paid in one of the
+// several tokens. Income is converted to cogs using the token rate and
+// compared with the price of the token from the price table. Tokens which
+// are not in the price table are rejected.
+type MultiTokenIncomeValidator struct {
+	pricesInCogs map[string]*big.Int
+	rate         TokenRate
+}
+
+// NewMultiTokenIncomeValidator returns new income validator which accepts
+// income in the tokens of the pricesInCogs table. Prices are expressed in
+// cogs, empty token is the token of the MultiPartyEscrow contract which
+// income is compared with the price as is.
+func NewMultiTokenIncomeValidator(pricesInCogs map[string]*big.Int, rate TokenRate) *MultiTokenIncomeValidator {
+	return &MultiTokenIncomeValidator{
+		pricesInCogs: pricesInCogs,
+		rate:         rate,
+	}
+}
+
+// Validate implements IncomeValidator.Validate.
+func (validator *MultiTokenIncomeValidator) Validate(data *IncomeData) (err error) {
+	price, ok := validator.pricesInCogs[data.Token]
+	if !ok {
+		return NewPaymentError(Unauthenticated, "payment token %q is not supported", data.Token)
+	}
+
+	if data.Token == "" {
+		if !data.incomeMatches(price) {
+			return NewPaymentError(Unauthenticated, "income %d does not equal to price %d", data.Income, price)
+		}
+		return
+	}
+
+	rate, err := validator.rate(data.Token)
+	if err != nil {
+		return NewPaymentError(Internal, "cannot get rate of token %q: %v", data.Token, err)
+	}
+	incomeInCogs := new(big.Rat).Mul(new(big.Rat).SetInt(data.Income), rate)
+	if incomeInCogs.Cmp(new(big.Rat).SetInt(price)) != 0 {
+		return NewPaymentError(Unauthenticated, "income %d %v is worth %v cogs which does not equal to price %d", data.Income, data.Token, incomeInCogs.RatString(), price)
+	}
+
+	return
+}
+
+type alwaysValidIncomeValidator struct {
+}
+
+// NewAlwaysValidIncomeValidator returns income validator which accepts any
+// income. It is intended for development and tests only, and should never be
+// used to serve real calls.
+func NewAlwaysValidIncomeValidator() (validator IncomeValidator) {
+	return &alwaysValidIncomeValidator{}
+}
+
+func (validator *alwaysValidIncomeValidator) Validate(data *IncomeData) (err error) {
+	return nil
+}
+
+// StreamingIncomeValidator validates income of streaming RPC calls which are
+// billed per chunk. Validate registers income authorized by client for the
+// stream, ValidateChunk is called for each chunk and checks that total price
+// of the chunks sent does not exceed the authorized income. Streams are keyed
+// by gRPC stream context.
+type StreamingIncomeValidator struct {
+	pricePerChunk *big.Int
+	mutex         sync.Mutex
+	streams       map[*handler.GrpcStreamContext]*streamIncome
+}
+
+type streamIncome struct {
+	authorized  *big.Int
+	accumulated *big.Int
+}
+
+// NewStreamingIncomeValidator returns new streaming income validator instance
+func NewStreamingIncomeValidator(pricePerChunk *big.Int) *StreamingIncomeValidator {
+	return &StreamingIncomeValidator{
+		pricePerChunk: pricePerChunk,
+		streams:       make(map[*handler.GrpcStreamContext]*streamIncome),
+	}
+}
+
+// Validate implements IncomeValidator.Validate. It checks that income is
+// enough to pay at least one chunk and starts tracking income of the stream.
+func (validator *StreamingIncomeValidator) Validate(data *IncomeData) (err error) {
+	if data.Income.Cmp(validator.pricePerChunk) < 0 {
+		return NewPaymentError(Unauthenticated, "income %d is less than price of chunk %d", data.Income, validator.pricePerChunk)
+	}
+
+	validator.mutex.Lock()
+	defer validator.mutex.Unlock()
+
+	validator.streams[data.GrpcContext] = &streamIncome{
+		authorized:  new(big.Int).Set(data.Income),
+		accumulated: big.NewInt(0),
+	}
+	return
+}
+
+// ValidateChunk adds price of the next chunk to the running total of the
+// stream and returns error if the total exceeds income authorized for the
+// stream.
+func (validator *StreamingIncomeValidator) ValidateChunk(context *handler.GrpcStreamContext) (err error) {
+	validator.mutex.Lock()
+	defer validator.mutex.Unlock()
+
+	stream, ok := validator.streams[context]
+	if !ok {
+		return NewPaymentError(Internal, "income of the stream is not validated")
+	}
+
+	accumulated := new(big.Int).Add(stream.accumulated, validator.pricePerChunk)
+	if accumulated.Cmp(stream.authorized) > 0 {
+		return NewPaymentError(Unauthenticated, "stream price %d exceeds authorized income %d", accumulated, stream.authorized)
+	}
+	stream.accumulated = accumulated
+
+	return
+}
+
+// Finish stops tracking income of the stream and returns total price of the
+// chunks which were accepted.
+func (validator *StreamingIncomeValidator) Finish(context *handler.GrpcStreamContext) (accumulated *big.Int) {
+	validator.mutex.Lock()
+	defer validator.mutex.Unlock()
+
+	stream, ok := validator.streams[context]
+	if !ok {
+		return big.NewInt(0)
+	}
+	delete(validator.streams, context)
+
+	return stream.accumulated
+}
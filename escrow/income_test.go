@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/singnet/snet-daemon/handler"
 )
 
 type incomeValidatorMockType struct {
@@ -36,3 +38,198 @@ func TestIncomeValidate(t *testing.T) {
 	msg = fmt.Sprintf("income %s does not equal to price %s", income, price)
 	assert.Equal(t, NewPaymentError(Unauthenticated, msg), err)
 }
+
+func TestIncomeValidateWithSurchargeBasePriceOnly(t *testing.T) {
+	incomeValidator := NewIncomeValidatorWithSurcharge(big.NewInt(10), big.NewInt(2))
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(10)})
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 10 does not equal to price 10 plus surcharge 2"), err)
+}
+
+func TestIncomeValidateWithSurcharge(t *testing.T) {
+	incomeValidator := NewIncomeValidatorWithSurcharge(big.NewInt(10), big.NewInt(2))
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(12)})
+
+	assert.Nil(t, err)
+}
+
+func TestIncomeValidateWithSurchargeTooMuch(t *testing.T) {
+	incomeValidator := NewIncomeValidatorWithSurcharge(big.NewInt(10), big.NewInt(2))
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(13)})
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 13 does not equal to price 10 plus surcharge 2"), err)
+}
+
+func TestIncomeValidateChannelWith8DecimalsToken(t *testing.T) {
+	incomeValidator := NewIncomeValidator(big.NewInt(10))
+
+	assert.Nil(t, incomeValidator.Validate(&IncomeData{Income: big.NewInt(10), TokenDecimals: 8}))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 11 does not equal to price 10"),
+		incomeValidator.Validate(&IncomeData{Income: big.NewInt(11), TokenDecimals: 8}))
+}
+
+func TestIncomeValidateChannelWith18DecimalsToken(t *testing.T) {
+	incomeValidator := NewIncomeValidator(big.NewInt(10))
+
+	assert.Nil(t, incomeValidator.Validate(&IncomeData{Income: bigIntFromString("100000000000"), TokenDecimals: 18}))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 10 does not equal to price 10"),
+		incomeValidator.Validate(&IncomeData{Income: big.NewInt(10), TokenDecimals: 18}))
+}
+
+func TestIncomeValidateWithSurchargeChannelWith18DecimalsToken(t *testing.T) {
+	incomeValidator := NewIncomeValidatorWithSurcharge(big.NewInt(10), big.NewInt(2))
+
+	err := incomeValidator.Validate(&IncomeData{Income: bigIntFromString("120000000000"), TokenDecimals: 18})
+
+	assert.Nil(t, err)
+}
+
+func channelPricingIncomeValidator() *ChannelPricingIncomeValidator {
+	return NewChannelPricingIncomeValidator(big.NewInt(10), func(channelID *big.Int) (*big.Int, bool) {
+		if channelID.Cmp(big.NewInt(42)) == 0 {
+			return big.NewInt(7), true
+		}
+		return nil, false
+	})
+}
+
+func TestChannelPricingIncomeValidateOverriddenPrice(t *testing.T) {
+	incomeValidator := channelPricingIncomeValidator()
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(7), ChannelID: big.NewInt(42)})
+
+	assert.Nil(t, err)
+}
+
+func TestChannelPricingIncomeValidateDefaultPrice(t *testing.T) {
+	incomeValidator := channelPricingIncomeValidator()
+
+	assert.Nil(t, incomeValidator.Validate(&IncomeData{Income: big.NewInt(10), ChannelID: big.NewInt(43)}))
+	assert.Nil(t, incomeValidator.Validate(&IncomeData{Income: big.NewInt(10)}))
+}
+
+func TestChannelPricingIncomeValidatePriceMismatch(t *testing.T) {
+	incomeValidator := channelPricingIncomeValidator()
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(10), ChannelID: big.NewInt(42)})
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 10 does not equal to price 7"), err)
+}
+
+func TestChannelPricingIncomeValidateChannelWith18DecimalsToken(t *testing.T) {
+	incomeValidator := channelPricingIncomeValidator()
+
+	err := incomeValidator.Validate(&IncomeData{Income: bigIntFromString("70000000000"), ChannelID: big.NewInt(42), TokenDecimals: 18})
+
+	assert.Nil(t, err)
+}
+
+func multiTokenIncomeValidator() *MultiTokenIncomeValidator {
+	return NewMultiTokenIncomeValidator(
+		map[string]*big.Int{"": big.NewInt(100), "USDC": big.NewInt(90)},
+		func(token string) (*big.Rat, error) {
+			if token == "USDC" {
+				return big.NewRat(5, 2), nil
+			}
+			return nil, fmt.Errorf("unknown token %v", token)
+		},
+	)
+}
+
+func TestMultiTokenIncomeValidateDefaultToken(t *testing.T) {
+	incomeValidator := multiTokenIncomeValidator()
+
+	assert.Nil(t, incomeValidator.Validate(&IncomeData{Income: big.NewInt(100)}))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 90 does not equal to price 100"),
+		incomeValidator.Validate(&IncomeData{Income: big.NewInt(90)}))
+}
+
+func TestMultiTokenIncomeValidateSecondaryToken(t *testing.T) {
+	incomeValidator := multiTokenIncomeValidator()
+
+	assert.Nil(t, incomeValidator.Validate(&IncomeData{Income: big.NewInt(36), Token: "USDC"}))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 35 USDC is worth 175/2 cogs which does not equal to price 90"),
+		incomeValidator.Validate(&IncomeData{Income: big.NewInt(35), Token: "USDC"}))
+}
+
+func TestMultiTokenIncomeValidateUnsupportedToken(t *testing.T) {
+	incomeValidator := multiTokenIncomeValidator()
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(100), Token: "DAI"})
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment token \"DAI\" is not supported"), err)
+}
+
+func TestMultiTokenIncomeValidateRateError(t *testing.T) {
+	incomeValidator := NewMultiTokenIncomeValidator(
+		map[string]*big.Int{"USDC": big.NewInt(90)},
+		func(token string) (*big.Rat, error) { return nil, fmt.Errorf("rate is not available") },
+	)
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(36), Token: "USDC"})
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot get rate of token \"USDC\": rate is not available"), err)
+}
+
+func TestAlwaysValidIncomeValidate(t *testing.T) {
+	incomeValidator := NewAlwaysValidIncomeValidator()
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(-1)})
+
+	assert.Nil(t, err)
+	assert.IsType(t, &alwaysValidIncomeValidator{}, incomeValidator)
+	assert.NotEqual(t, fmt.Sprintf("%T", NewIncomeValidator(big.NewInt(0))), fmt.Sprintf("%T", incomeValidator))
+}
+
+func TestStreamingIncomeValidateWellPaidStream(t *testing.T) {
+	incomeValidator := NewStreamingIncomeValidator(big.NewInt(10))
+	context := &handler.GrpcStreamContext{}
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(30), GrpcContext: context})
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		err = incomeValidator.ValidateChunk(context)
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, big.NewInt(30), incomeValidator.Finish(context))
+	assert.Equal(t, NewPaymentError(Internal, "income of the stream is not validated"), incomeValidator.ValidateChunk(context))
+}
+
+func TestStreamingIncomeValidateUnderpaidStream(t *testing.T) {
+	incomeValidator := NewStreamingIncomeValidator(big.NewInt(10))
+	context := &handler.GrpcStreamContext{}
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(25), GrpcContext: context})
+	assert.Nil(t, err)
+	assert.Nil(t, incomeValidator.ValidateChunk(context))
+	assert.Nil(t, incomeValidator.ValidateChunk(context))
+	err = incomeValidator.ValidateChunk(context)
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "stream price 30 exceeds authorized income 25"), err)
+	assert.Equal(t, big.NewInt(20), incomeValidator.Finish(context))
+}
+
+func TestStreamingIncomeValidateIncomeLessThanChunkPrice(t *testing.T) {
+	incomeValidator := NewStreamingIncomeValidator(big.NewInt(10))
+
+	err := incomeValidator.Validate(&IncomeData{Income: big.NewInt(9), GrpcContext: &handler.GrpcStreamContext{}})
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "income 9 is less than price of chunk 10"), err)
+}
+
+func TestStreamingIncomeValidateStreamsAreIndependent(t *testing.T) {
+	incomeValidator := NewStreamingIncomeValidator(big.NewInt(10))
+	contextA := &handler.GrpcStreamContext{}
+	contextB := &handler.GrpcStreamContext{}
+
+	assert.Nil(t, incomeValidator.Validate(&IncomeData{Income: big.NewInt(10), GrpcContext: contextA}))
+	assert.Nil(t, incomeValidator.Validate(&IncomeData{Income: big.NewInt(20), GrpcContext: contextB}))
+	assert.Nil(t, incomeValidator.ValidateChunk(contextA))
+	assert.NotNil(t, incomeValidator.ValidateChunk(contextA))
+	assert.Nil(t, incomeValidator.ValidateChunk(contextB))
+	assert.Nil(t, incomeValidator.ValidateChunk(contextB))
+}
@@ -0,0 +1,65 @@
+package escrow
+
+import (
+	"math/big"
+	"sync/atomic"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+// redactedSignatureLength is a number of characters of base64 encoded
+// signature which are kept when log redaction is enabled.
+const redactedSignatureLength = 8
+
+// maskedAmount replaces amounts in log output when redaction is enabled.
+const maskedAmount = "***"
+
+var logRedaction int32
+
+// SetLogRedaction enables or disables redaction of sensitive payment fields
+// in log output produced by the validator and storages. When redaction is
+// enabled signatures are truncated and amounts are masked. Redaction is
+// disabled by default.
+func SetLogRedaction(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&logRedaction, value)
+}
+
+func isLogRedactionEnabled() bool {
+	return atomic.LoadInt32(&logRedaction) == 1
+}
+
+// loggedSignature returns signature encoded in base64 to be written into
+// log, signature is truncated if redaction is enabled.
+func loggedSignature(signature []byte) string {
+	encoded := blockchain.BytesToBase64(signature)
+	if !isLogRedactionEnabled() || len(signature) == 0 {
+		return encoded
+	}
+	if len(encoded) > redactedSignatureLength {
+		encoded = encoded[:redactedSignatureLength]
+	}
+	return encoded + "..."
+}
+
+// loggedAmount returns amount to be written into log, amount is masked if
+// redaction is enabled.
+func loggedAmount(amount *big.Int) interface{} {
+	if !isLogRedactionEnabled() {
+		return amount
+	}
+	return maskedAmount
+}
+
+// loggedMessage returns signed payment message encoded in base64 to be
+// written into log, message contains payment amount so it is masked if
+// redaction is enabled.
+func loggedMessage(message []byte) string {
+	if !isLogRedactionEnabled() {
+		return blockchain.BytesToBase64(message)
+	}
+	return maskedAmount
+}
@@ -0,0 +1,74 @@
+package escrow
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+func captureLog(fn func()) string {
+	var output bytes.Buffer
+	logger := log.StandardLogger()
+	previous := logger.Out
+	logger.SetOutput(&output)
+	defer logger.SetOutput(previous)
+
+	fn()
+	return output.String()
+}
+
+func invalidSignerPayment() (*Payment, *PaymentChannelData) {
+	fixtures := newTestFixtures("redaction")
+	payment := fixtures.Payment(42, 3, 1234567)
+	SignTestPayment(payment, fixtures.PrivateKey("another signer"))
+	return payment, fixtures.Channel(42, 3, 7654321, 12300, 100)
+}
+
+func TestLogRedactionEnabled(t *testing.T) {
+	SetLogRedaction(true)
+	defer SetLogRedaction(false)
+	payment, channel := invalidSignerPayment()
+	signature := blockchain.BytesToBase64(payment.Signature)
+
+	output := captureLog(func() {
+		ChannelPaymentValidatorMock().Validate(payment, channel)
+	})
+
+	assert.Contains(t, output, "Channel signer is not equal to payment signer")
+	assert.Contains(t, output, signature[:redactedSignatureLength]+"...")
+	assert.NotContains(t, output, signature)
+	assert.NotContains(t, output, "1234567")
+	assert.NotContains(t, output, "7654321")
+}
+
+func TestLogRedactionDisabled(t *testing.T) {
+	payment, channel := invalidSignerPayment()
+
+	output := captureLog(func() {
+		ChannelPaymentValidatorMock().Validate(payment, channel)
+	})
+
+	assert.Contains(t, output, blockchain.BytesToBase64(payment.Signature))
+	assert.Contains(t, output, "1234567")
+}
+
+func TestLoggedAmount(t *testing.T) {
+	assert.Equal(t, big.NewInt(42), loggedAmount(big.NewInt(42)))
+
+	SetLogRedaction(true)
+	defer SetLogRedaction(false)
+
+	assert.Equal(t, "***", loggedAmount(big.NewInt(42)))
+}
+
+func TestLoggedSignatureEmpty(t *testing.T) {
+	SetLogRedaction(true)
+	defer SetLogRedaction(false)
+
+	assert.Equal(t, "", loggedSignature(nil))
+}
@@ -50,6 +50,19 @@ func (storage *memoryStorage) GetByKeyPrefix(prefix string) (values []string, er
 	return
 }
 
+func (storage *memoryStorage) GetKeysByPrefix(prefix string) (keys []string, err error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	for key := range storage.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	return
+}
+
 func (storage *memoryStorage) unsafeGet(key string) (value string, ok bool, err error) {
 	value, ok = storage.data[key]
 	if !ok {
@@ -99,6 +112,28 @@ func (storage *memoryStorage) Delete(key string) (err error) {
 	return
 }
 
+// WithTransaction implements TransactionalAtomicStorage.WithTransaction.
+// fn is called without lock, so it can read the storage, storage is locked
+// only while collected changes are applied.
+func (storage *memoryStorage) WithTransaction(fn func(tx StorageTx) error) (err error) {
+	tx := &bufferedStorageTx{}
+	if err = fn(tx); err != nil {
+		return
+	}
+
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	for _, change := range tx.changes {
+		if change.value == nil {
+			delete(storage.data, change.key)
+		} else {
+			storage.data[change.key] = *change.value
+		}
+	}
+	return nil
+}
+
 func (storage *memoryStorage) Clear() (err error) {
 	storage.mutex.Lock()
 	defer storage.mutex.Unlock()
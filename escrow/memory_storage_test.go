@@ -0,0 +1,74 @@
+package escrow
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorageTransaction(t *testing.T) {
+	storage := NewMemStorage()
+	storage.Put("deleted", "value")
+
+	err := WithTransaction(storage, func(tx StorageTx) error {
+		tx.Put("payment", "payment value")
+		tx.Put("claim", "claim value")
+		tx.Delete("deleted")
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"payment": "payment value", "claim": "claim value"}, storage.data)
+}
+
+func TestMemoryStorageTransactionRollback(t *testing.T) {
+	storage := NewMemStorage()
+	storage.Put("deleted", "value")
+
+	err := WithTransaction(storage, func(tx StorageTx) error {
+		tx.Put("payment", "payment value")
+		tx.Delete("deleted")
+		return errors.New("claim cannot be written")
+	})
+
+	assert.Equal(t, errors.New("claim cannot be written"), err)
+	assert.Equal(t, map[string]string{"deleted": "value"}, storage.data)
+}
+
+func TestMemoryStorageTransactionCanReadStorage(t *testing.T) {
+	storage := NewMemStorage()
+	storage.Put("counter", "1")
+
+	err := WithTransaction(storage, func(tx StorageTx) error {
+		value, _, err := storage.Get("counter")
+		tx.Put("counter", value+"1")
+		return err
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"counter": "11"}, storage.data)
+}
+
+func TestPrefixedStorageTransaction(t *testing.T) {
+	storage := NewMemStorage()
+	prefixed := &PrefixedAtomicStorage{delegate: storage, keyPrefix: "/prefix"}
+
+	err := WithTransaction(prefixed, func(tx StorageTx) error {
+		tx.Put("key", "value")
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"/prefix/key": "value"}, storage.data)
+}
+
+func TestTransactionIsNotSupported(t *testing.T) {
+	storage := &failingAtomicStorage{AtomicStorage: NewMemStorage()}
+
+	err := WithTransaction(storage, func(tx StorageTx) error {
+		return nil
+	})
+
+	assert.Equal(t, errors.New("storage doesn't support transactions"), err)
+}
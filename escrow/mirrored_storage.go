@@ -0,0 +1,98 @@
+package escrow
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// MirroredAtomicStorage is a decorator for atomic storage which duplicates
+// writes into secondary storage. Writes are applied to primary storage first,
+// then they are applied to secondary storage in best-effort manner: secondary
+// storage errors are logged but not returned. All reads are made from primary
+// storage.
+type MirroredAtomicStorage struct {
+	primary   AtomicStorage
+	secondary AtomicStorage
+}
+
+// NewMirroredAtomicStorage returns new instance of MirroredAtomicStorage
+func NewMirroredAtomicStorage(primary, secondary AtomicStorage) *MirroredAtomicStorage {
+	return &MirroredAtomicStorage{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// NewMirroredPaymentStorage returns PaymentStorage which keeps payments in
+// primary storage and mirrors all writes into secondary one.
+func NewMirroredPaymentStorage(primary, secondary AtomicStorage) *PaymentStorage {
+	return NewPaymentStorage(NewMirroredAtomicStorage(primary, secondary))
+}
+
+// Get is implementation of AtomicStorage.Get
+func (storage *MirroredAtomicStorage) Get(key string) (value string, ok bool, err error) {
+	return storage.primary.Get(key)
+}
+
+// GetByKeyPrefix is implementation of AtomicStorage.GetByKeyPrefix
+func (storage *MirroredAtomicStorage) GetByKeyPrefix(prefix string) (values []string, err error) {
+	return storage.primary.GetByKeyPrefix(prefix)
+}
+
+// GetKeysByPrefix is implementation of AtomicStorage.GetKeysByPrefix
+func (storage *MirroredAtomicStorage) GetKeysByPrefix(prefix string) (keys []string, err error) {
+	return storage.primary.GetKeysByPrefix(prefix)
+}
+
+// Put is implementation of AtomicStorage.Put
+func (storage *MirroredAtomicStorage) Put(key string, value string) (err error) {
+	err = storage.primary.Put(key, value)
+	if err != nil {
+		return
+	}
+
+	storage.mirrorPut(key, value)
+	return nil
+}
+
+// PutIfAbsent is implementation of AtomicStorage.PutIfAbsent
+func (storage *MirroredAtomicStorage) PutIfAbsent(key string, value string) (ok bool, err error) {
+	ok, err = storage.primary.PutIfAbsent(key, value)
+	if err != nil || !ok {
+		return
+	}
+
+	storage.mirrorPut(key, value)
+	return true, nil
+}
+
+// CompareAndSwap is implementation of AtomicStorage.CompareAndSwap
+func (storage *MirroredAtomicStorage) CompareAndSwap(key string, prevValue string, newValue string) (ok bool, err error) {
+	ok, err = storage.primary.CompareAndSwap(key, prevValue, newValue)
+	if err != nil || !ok {
+		return
+	}
+
+	storage.mirrorPut(key, newValue)
+	return true, nil
+}
+
+// Delete is implementation of AtomicStorage.Delete
+func (storage *MirroredAtomicStorage) Delete(key string) (err error) {
+	err = storage.primary.Delete(key)
+	if err != nil {
+		return
+	}
+
+	e := storage.secondary.Delete(key)
+	if e != nil {
+		log.WithError(e).WithField("key", key).Error("Cannot delete value from secondary storage")
+	}
+	return nil
+}
+
+func (storage *MirroredAtomicStorage) mirrorPut(key string, value string) {
+	e := storage.secondary.Put(key, value)
+	if e != nil {
+		log.WithError(e).WithField("key", key).Error("Cannot write value into secondary storage")
+	}
+}
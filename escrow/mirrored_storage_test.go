@@ -0,0 +1,107 @@
+package escrow
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MirroredAtomicStorageSuite struct {
+	suite.Suite
+
+	primary   *memoryStorage
+	secondary *memoryStorage
+	storage   *MirroredAtomicStorage
+}
+
+func (suite *MirroredAtomicStorageSuite) SetupTest() {
+	suite.primary = NewMemStorage()
+	suite.secondary = NewMemStorage()
+	suite.storage = NewMirroredAtomicStorage(suite.primary, suite.secondary)
+}
+
+func TestMirroredAtomicStorageSuite(t *testing.T) {
+	suite.Run(t, new(MirroredAtomicStorageSuite))
+}
+
+func (suite *MirroredAtomicStorageSuite) assertValue(storage AtomicStorage, key string, expected string) {
+	value, ok, err := storage.Get(key)
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.True(suite.T(), ok, "Key %v is absent", key)
+	assert.Equal(suite.T(), expected, value)
+}
+
+func (suite *MirroredAtomicStorageSuite) assertAbsent(storage AtomicStorage, key string) {
+	_, ok, err := storage.Get(key)
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.False(suite.T(), ok, "Key %v is present", key)
+}
+
+func (suite *MirroredAtomicStorageSuite) TestWritesAreMirrored() {
+	assert.Nil(suite.T(), suite.storage.Put("a", "1"))
+	ok, err := suite.storage.PutIfAbsent("b", "2")
+	assert.True(suite.T(), ok)
+	assert.Nil(suite.T(), err)
+	ok, err = suite.storage.CompareAndSwap("a", "1", "3")
+	assert.True(suite.T(), ok)
+	assert.Nil(suite.T(), err)
+
+	for _, storage := range []AtomicStorage{suite.primary, suite.secondary} {
+		suite.assertValue(storage, "a", "3")
+		suite.assertValue(storage, "b", "2")
+	}
+
+	assert.Nil(suite.T(), suite.storage.Delete("a"))
+	suite.assertAbsent(suite.primary, "a")
+	suite.assertAbsent(suite.secondary, "a")
+}
+
+func (suite *MirroredAtomicStorageSuite) TestFailedPrimaryOperationIsNotMirrored() {
+	assert.Nil(suite.T(), suite.storage.Put("a", "1"))
+	assert.Nil(suite.T(), suite.secondary.Put("a", "2"))
+
+	ok, err := suite.storage.CompareAndSwap("a", "0", "3")
+
+	assert.False(suite.T(), ok)
+	assert.Nil(suite.T(), err)
+	suite.assertValue(suite.secondary, "a", "2")
+}
+
+func (suite *MirroredAtomicStorageSuite) TestReadsFromPrimary() {
+	assert.Nil(suite.T(), suite.primary.Put("a", "1"))
+	assert.Nil(suite.T(), suite.secondary.Put("a", "2"))
+	assert.Nil(suite.T(), suite.secondary.Put("b", "3"))
+
+	suite.assertValue(suite.storage, "a", "1")
+	suite.assertAbsent(suite.storage, "b")
+	values, err := suite.storage.GetByKeyPrefix("")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"1"}, values)
+}
+
+func (suite *MirroredAtomicStorageSuite) TestSecondaryFailureDoesNotFailWrite() {
+	storage := NewMirroredAtomicStorage(suite.primary, &failingAtomicStorage{
+		AtomicStorage: suite.secondary,
+		err:           errors.New("secondary storage error"),
+	})
+
+	err := storage.Put("a", "1")
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	suite.assertValue(suite.primary, "a", "1")
+	suite.assertAbsent(suite.secondary, "a")
+}
+
+func (suite *MirroredAtomicStorageSuite) TestMirroredPaymentStorage() {
+	storage := NewMirroredPaymentStorage(suite.primary, suite.secondary)
+	payment := validTestPayment()
+
+	err := storage.Put(payment)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, err := NewPaymentStorage(suite.secondary).GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{payment}, payments)
+}
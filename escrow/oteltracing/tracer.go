@@ -0,0 +1,53 @@
+// Package oteltracing adapts OpenTelemetry tracer to escrow.ValidationTracer,
+// so payment validation can be traced without escrow depending on
+// OpenTelemetry.
+package oteltracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/singnet/snet-daemon/escrow"
+)
+
+// OutcomeAttribute is a name of the span attribute which keeps outcome of
+// the traced validation step, it is either "valid" or name of the
+// escrow.PaymentErrorCode.
+const OutcomeAttribute = "outcome"
+
+type validationTracer struct {
+	tracer trace.Tracer
+}
+
+// NewValidationTracer returns escrow.ValidationTracer which creates
+// OpenTelemetry spans using tracer. It is passed to the validator using
+// escrow.WithTracer option.
+func NewValidationTracer(tracer trace.Tracer) escrow.ValidationTracer {
+	return &validationTracer{tracer: tracer}
+}
+
+func (tracer *validationTracer) StartSpan(ctx context.Context, name string, attributes []escrow.SpanAttribute) (context.Context, escrow.ValidationSpan) {
+	keyValues := make([]attribute.KeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		keyValues = append(keyValues, attribute.String(a.Key, a.Value))
+	}
+	ctx, span := tracer.tracer.Start(ctx, name, trace.WithAttributes(keyValues...))
+	return ctx, &validationSpan{span: span}
+}
+
+type validationSpan struct {
+	span trace.Span
+}
+
+// End sets outcome attribute, sets error status when err is not nil and
+// ends span.
+func (span *validationSpan) End(outcome string, err error) {
+	span.span.SetAttributes(attribute.String(OutcomeAttribute, outcome))
+	if err != nil {
+		span.span.SetStatus(codes.Error, err.Error())
+	}
+	span.span.End()
+}
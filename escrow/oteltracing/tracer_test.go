@@ -0,0 +1,82 @@
+package oteltracing
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/singnet/snet-daemon/escrow"
+)
+
+func newTestTracer() (escrow.ValidationTracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return NewValidationTracer(provider.Tracer("escrow")), exporter
+}
+
+func TestValidationTracer(t *testing.T) {
+	tracer, exporter := newTestTracer()
+
+	ctx, validateSpan := tracer.StartSpan(context.Background(), "ChannelPaymentValidator.Validate", []escrow.SpanAttribute{
+		{Key: "channelID", Value: "42"},
+		{Key: "nonce", Value: "3"},
+	})
+	_, blockSpan := tracer.StartSpan(ctx, "ChannelPaymentValidator.currentBlock", nil)
+	blockSpan.End("valid", nil)
+	validateSpan.End("valid", nil)
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "ChannelPaymentValidator.currentBlock", spans[0].Name)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, "ChannelPaymentValidator.Validate", spans[1].Name)
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("channelID", "42"),
+		attribute.String("nonce", "3"),
+		attribute.String("outcome", "valid"),
+	}, spans[1].Attributes)
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+}
+
+func TestValidationTracerFailure(t *testing.T) {
+	tracer, exporter := newTestTracer()
+
+	_, span := tracer.StartSpan(context.Background(), "ChannelPaymentValidator.Validate", nil)
+	span.End("IncorrectNonce", errors.New("incorrect payment channel nonce"))
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("outcome", "IncorrectNonce"),
+	}, spans[0].Attributes)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "incorrect payment channel nonce", spans[0].Status.Description)
+}
+
+func TestValidatorWithTracer(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	validator := &escrow.ChannelPaymentValidator{}
+	escrow.WithTracer(tracer)(validator)
+	payment := &escrow.Payment{ChannelID: big.NewInt(42), ChannelNonce: big.NewInt(3)}
+
+	err := validator.ValidateAtBlock(payment, &escrow.PaymentChannelData{}, big.NewInt(99))
+
+	assert.Equal(t, escrow.NewPaymentError(escrow.Internal, "missing payment field: payment.Amount"), err)
+	spans := exporter.GetSpans()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "ChannelPaymentValidator.Validate", spans[0].Name)
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("channelID", "42"),
+		attribute.String("nonce", "3"),
+		attribute.String("outcome", "Internal"),
+	}, spans[0].Attributes)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, err.Error(), spans[0].Status.Description)
+}
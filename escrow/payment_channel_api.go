@@ -1,6 +1,9 @@
 package escrow
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -22,17 +25,89 @@ type Payment struct {
 	Amount *big.Int
 	// Signature is a signature of the payment.
 	Signature []byte
+	// CurveType is a type of the elliptic curve of the key which is used to
+	// sign the payment, default is Secp256k1.
+	CurveType CurveType
+	// ProofOfFunds is optional, it is a recent balance proof of the channel
+	// sender which is required for high-value calls, see
+	// WithProofOfFunds.
+	ProofOfFunds *ProofOfFunds
+	// CallDeadline is optional, it is a block number until which client
+	// expects the call to be served. Payment is rejected if channel expires
+	// before the deadline.
+	CallDeadline *big.Int
+	// PreimageScheme defines which fields of the payment are signed, see
+	// PreimageScheme constants.
+	PreimageScheme PreimageScheme
+	// ContextBytes is optional, it is an additional context the payment is
+	// bound to, for instance hash of the request. It is signed when
+	// PreimageScheme is ContextBoundPreimage.
+	ContextBytes []byte
 }
 
+// PreimageScheme defines content of the message which is signed by payment
+// signer.
+type PreimageScheme int
+
+const (
+	// DefaultPreimage is a message which contains MpeContractAddress,
+	// ChannelID, ChannelNonce and Amount, it is used by default.
+	DefaultPreimage PreimageScheme = 0
+	// ContextBoundPreimage is a default message followed by ContextBytes.
+	// MultiPartyEscrow contract verifies signature of the default message
+	// only, so such signatures cannot be used to claim the channel.
+	ContextBoundPreimage PreimageScheme = 1
+)
+
+// CurveType is a type of the elliptic curve which is used to sign payment.
+type CurveType int
+
+const (
+	// Secp256k1 is a curve used by Ethereum, it is used by default.
+	Secp256k1 CurveType = 0
+	// P256 is a NIST secp256r1 curve which is used by some enterprise identity
+	// systems.
+	P256 CurveType = 1
+)
+
 func (p *Payment) String() string {
 	return fmt.Sprintf("{MpeContractAddress: %v, ChannelID: %v, ChannelNonce: %v, Amount: %v, Signature: %v}",
-		blockchain.AddressToHex(&p.MpeContractAddress), p.ChannelID, p.ChannelNonce, p.Amount, blockchain.BytesToBase64(p.Signature))
+		blockchain.AddressToHex(&p.MpeContractAddress), p.ChannelID, p.ChannelNonce, loggedAmount(p.Amount), loggedSignature(p.Signature))
 }
 
 func (p *Payment) ID() string {
 	return fmt.Sprintf("%v/%v", p.ChannelID, p.ChannelNonce)
 }
 
+// Validate checks structural integrity of the payment: ChannelID,
+// ChannelNonce and Amount should be set and non-negative,
+// MpeContractAddress should not be zero. Signature is not checked.
+func (p *Payment) Validate() (err error) {
+	if err = checkNonNegative("ChannelID", p.ChannelID); err != nil {
+		return
+	}
+	if err = checkNonNegative("ChannelNonce", p.ChannelNonce); err != nil {
+		return
+	}
+	if err = checkNonNegative("Amount", p.Amount); err != nil {
+		return
+	}
+	if p.MpeContractAddress == (common.Address{}) {
+		return errors.New("MpeContractAddress is zero address")
+	}
+	return nil
+}
+
+func checkNonNegative(name string, value *big.Int) error {
+	if value == nil {
+		return fmt.Errorf("%v is not set", name)
+	}
+	if value.Sign() < 0 {
+		return fmt.Errorf("%v is negative: %v", name, value)
+	}
+	return nil
+}
+
 // PaymentChannelKey specifies the channel in MultiPartyEscrow contract. It
 // consists of two parts: channel id and channel nonce. Channel nonce is
 // incremented each time when amount of tokens in channel descreases. Nonce
@@ -89,18 +164,74 @@ type PaymentChannelData struct {
 	// Signer is and address to be used to sign the payments. Usually it is
 	// equal to channel sender.
 	Signer common.Address
+	// PaymentSigner is optional, when it is set payments should be signed by
+	// it instead of Signer, while Signer is still used to authorize reads
+	// of the channel state.
+	PaymentSigner common.Address
+	// TokenDecimals is a number of decimal places of the token the channel
+	// is denominated in. Zero means DefaultTokenDecimals. Amounts of the
+	// channel are expressed in the smallest units of this token.
+	TokenDecimals int
+	// Token is an identifier of the token the channel is denominated in.
+	// Empty string means the token of the MultiPartyEscrow contract.
+	Token string
 
 	// service provider. This amount increments on price after each successful
 	// RPC call.
 	AuthorizedAmount *big.Int
 	// Signature is a signature of last message containing Authorized amount.
-	// It is required to claim tokens from channel.
+	// It is required to claim tokens from channel. Message is signed by
+	// channel Signer, see VerifyChannelSignature. Signature is nil when no
+	// payments were received since channel nonce was changed, in this case
+	// there is nothing to claim.
 	Signature []byte
 }
 
 func (data *PaymentChannelData) String() string {
-	return fmt.Sprintf("{ChannelID: %v, Nonce: %v, State: %v, Sender: %v, Recipient: %v, GroupId: %v, FullAmount: %v, Expiration: %v, Signer: %v, AuthorizedAmount: %v, Signature: %v",
-		data.ChannelID, data.Nonce, data.State, blockchain.AddressToHex(&data.Sender), blockchain.AddressToHex(&data.Recipient), data.GroupID, data.FullAmount, data.Expiration, data.Signer, data.AuthorizedAmount, blockchain.BytesToBase64(data.Signature))
+	return fmt.Sprintf("{ChannelID: %v, Nonce: %v, State: %v, Sender: %v, Recipient: %v, GroupId: %v, FullAmount: %v, Expiration: %v, Signer: %v, PaymentSigner: %v, TokenDecimals: %v, AuthorizedAmount: %v, Signature: %v",
+		data.ChannelID, data.Nonce, data.State, blockchain.AddressToHex(&data.Sender), blockchain.AddressToHex(&data.Recipient), data.GroupID, loggedAmount(data.FullAmount), data.Expiration, data.Signer, data.PaymentSigner, data.tokenDecimals(), loggedAmount(data.AuthorizedAmount), loggedSignature(data.Signature))
+}
+
+func (data *PaymentChannelData) tokenDecimals() int {
+	if data.TokenDecimals == 0 {
+		return DefaultTokenDecimals
+	}
+	return data.TokenDecimals
+}
+
+// PaymentSignerAddress returns address which should sign payments, it is
+// PaymentSigner if it is set and Signer otherwise.
+func (data *PaymentChannelData) PaymentSignerAddress() common.Address {
+	if data.PaymentSigner != (common.Address{}) {
+		return data.PaymentSigner
+	}
+	return data.Signer
+}
+
+// RemainingCalls returns number of calls which can be funded by channel
+// amount which is not authorized yet, i.e. (FullAmount - AuthorizedAmount) /
+// pricePerCall rounded down. It returns error if price is not positive.
+func RemainingCalls(channel *PaymentChannelData, pricePerCall *big.Int) (*big.Int, error) {
+	if pricePerCall == nil || pricePerCall.Sign() <= 0 {
+		return nil, fmt.Errorf("price per call should be positive: %v", pricePerCall)
+	}
+
+	remaining := new(big.Int).Sub(channel.FullAmount, channel.AuthorizedAmount)
+	if remaining.Sign() <= 0 {
+		return big.NewInt(0), nil
+	}
+	return remaining.Quo(remaining, pricePerCall), nil
+}
+
+// Fingerprint returns hex encoded hash of the channel state fields which
+// payment validation depends on: nonce, authorized amount, expiration and
+// signer. Fingerprint is the same for the equal states, so it can be used to
+// detect channel state changes and as a cache key.
+func Fingerprint(channel *PaymentChannelData) string {
+	state := fmt.Sprintf("nonce:%v;authorized:%v;expiration:%v;signer:%v",
+		channel.Nonce, channel.AuthorizedAmount, channel.Expiration, channel.Signer.Hex())
+	hash := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(hash[:])
 }
 
 // PaymentChannelService interface is API for payment channel functionality.
@@ -142,14 +273,75 @@ const (
 	FailedPrecondition PaymentErrorCode = 3
 	// IncorrectNonce is returned when nonce value sent by client is incorrect.
 	IncorrectNonce PaymentErrorCode = 4
+	// InsufficientIncrement is returned when payment amount is incremented on
+	// less than price of the call.
+	InsufficientIncrement PaymentErrorCode = 5
+	// MalformedSignature is returned when payment signature is structurally
+	// invalid, for instance one of its R or S components is zero.
+	MalformedSignature PaymentErrorCode = 6
+	// LowRemainingCapacity is returned when payment would leave channel
+	// remaining capacity below the minimum, client should top up the channel.
+	LowRemainingCapacity PaymentErrorCode = 7
+	// SpendingCapExceeded is returned when payment would exceed total amount
+	// which payment signer is allowed to authorize across all channels.
+	SpendingCapExceeded PaymentErrorCode = 8
+	// ChannelExtensionRequired is returned when channel expires before the
+	// call deadline requested by client, client should extend the channel.
+	ChannelExtensionRequired PaymentErrorCode = 9
+	// SuspectedFraud is returned when payment is rejected by the anti-fraud
+	// scorer.
+	SuspectedFraud PaymentErrorCode = 10
+	// SenderNotAllowed is returned when payment channel sender is not in the
+	// set of senders allowed to use the service.
+	SenderNotAllowed PaymentErrorCode = 11
+	// GroupNotAllowed is returned when payment channel group is not in the
+	// set of groups allowed to use the service.
+	GroupNotAllowed PaymentErrorCode = 12
 )
 
+// String returns machine-stable name of the code which doesn't depend on the
+// error message.
+func (code PaymentErrorCode) String() string {
+	switch code {
+	case Internal:
+		return "Internal"
+	case Unauthenticated:
+		return "Unauthenticated"
+	case FailedPrecondition:
+		return "FailedPrecondition"
+	case IncorrectNonce:
+		return "IncorrectNonce"
+	case InsufficientIncrement:
+		return "InsufficientIncrement"
+	case MalformedSignature:
+		return "MalformedSignature"
+	case LowRemainingCapacity:
+		return "LowRemainingCapacity"
+	case SpendingCapExceeded:
+		return "SpendingCapExceeded"
+	case ChannelExtensionRequired:
+		return "ChannelExtensionRequired"
+	case SuspectedFraud:
+		return "SuspectedFraud"
+	case SenderNotAllowed:
+		return "SenderNotAllowed"
+	case GroupNotAllowed:
+		return "GroupNotAllowed"
+	default:
+		return fmt.Sprintf("PaymentErrorCode(%d)", int(code))
+	}
+}
+
 // PaymentError contains error code and message and implements Error interface.
 type PaymentError struct {
 	// Code is error code
 	Code PaymentErrorCode
 	// Message is message
 	Message string
+	// Details contains optional structured fields of the error, for
+	// instance expected nonce. They are sent to gRPC clients, see
+	// GRPCStatus.
+	Details map[string]string
 }
 
 // NewPaymentError constructs new PaymentError instance with given error code
@@ -162,6 +354,26 @@ func (err *PaymentError) Error() string {
 	return err.Message
 }
 
+// PaymentErrorLocalizer returns message which should be shown to the client
+// instead of the original message of the error.
+type PaymentErrorLocalizer func(err *PaymentError) (message string)
+
+// Localize returns copy of the error which message is replaced by localizer.
+// Error code is kept unchanged.
+func (err *PaymentError) Localize(localizer PaymentErrorLocalizer) *PaymentError {
+	return &PaymentError{Code: err.Code, Message: localizer(err), Details: err.Details}
+}
+
+// WithDetail returns copy of the error with structured field added
+func (err *PaymentError) WithDetail(key, value string) *PaymentError {
+	details := make(map[string]string, len(err.Details)+1)
+	for k, v := range err.Details {
+		details[k] = v
+	}
+	details[key] = value
+	return &PaymentError{Code: err.Code, Message: err.Message, Details: details}
+}
+
 // PaymentTransaction is a payment transaction in progress.
 type PaymentTransaction interface {
 	// Channel returns the channel which is used to apply the payment
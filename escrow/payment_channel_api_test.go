@@ -0,0 +1,165 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+func validTestPayment() *Payment {
+	return &Payment{
+		MpeContractAddress: blockchain.HexToAddress("0xf25186b5081ff5ce73482ad761db0eb0d25abfbf"),
+		ChannelID:          big.NewInt(42),
+		ChannelNonce:       big.NewInt(3),
+		Amount:             big.NewInt(12345),
+	}
+}
+
+func TestPaymentValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch func(payment *Payment)
+		err   error
+	}{
+		{"valid", func(payment *Payment) {}, nil},
+		{"zero values", func(payment *Payment) {
+			payment.ChannelID = big.NewInt(0)
+			payment.ChannelNonce = big.NewInt(0)
+			payment.Amount = big.NewInt(0)
+		}, nil},
+		{"no channel id", func(payment *Payment) { payment.ChannelID = nil }, errors.New("ChannelID is not set")},
+		{"negative channel id", func(payment *Payment) { payment.ChannelID = big.NewInt(-1) }, errors.New("ChannelID is negative: -1")},
+		{"no channel nonce", func(payment *Payment) { payment.ChannelNonce = nil }, errors.New("ChannelNonce is not set")},
+		{"negative channel nonce", func(payment *Payment) { payment.ChannelNonce = big.NewInt(-2) }, errors.New("ChannelNonce is negative: -2")},
+		{"no amount", func(payment *Payment) { payment.Amount = nil }, errors.New("Amount is not set")},
+		{"negative amount", func(payment *Payment) { payment.Amount = big.NewInt(-3) }, errors.New("Amount is negative: -3")},
+		{"zero mpe address", func(payment *Payment) { payment.MpeContractAddress = common.Address{} }, errors.New("MpeContractAddress is zero address")},
+	}
+
+	for _, test := range tests {
+		payment := validTestPayment()
+		test.patch(payment)
+
+		err := payment.Validate()
+
+		assert.Equal(t, test.err, err, test.name)
+	}
+}
+
+func TestSignTestPaymentPanicsOnIncorrectPayment(t *testing.T) {
+	payment := validTestPayment()
+	payment.Amount = nil
+
+	assert.PanicsWithValue(t, "Cannot sign incorrect test payment: Amount is not set", func() {
+		SignTestPayment(payment, GenerateTestPrivateKey())
+	})
+}
+
+func TestPaymentErrorCodeString(t *testing.T) {
+	assert.Equal(t, "Internal", Internal.String())
+	assert.Equal(t, "Unauthenticated", Unauthenticated.String())
+	assert.Equal(t, "FailedPrecondition", FailedPrecondition.String())
+	assert.Equal(t, "IncorrectNonce", IncorrectNonce.String())
+	assert.Equal(t, "InsufficientIncrement", InsufficientIncrement.String())
+	assert.Equal(t, "MalformedSignature", MalformedSignature.String())
+	assert.Equal(t, "LowRemainingCapacity", LowRemainingCapacity.String())
+	assert.Equal(t, "SpendingCapExceeded", SpendingCapExceeded.String())
+	assert.Equal(t, "ChannelExtensionRequired", ChannelExtensionRequired.String())
+	assert.Equal(t, "SuspectedFraud", SuspectedFraud.String())
+	assert.Equal(t, "SenderNotAllowed", SenderNotAllowed.String())
+	assert.Equal(t, "GroupNotAllowed", GroupNotAllowed.String())
+	assert.Equal(t, "PaymentErrorCode(100)", PaymentErrorCode(100).String())
+}
+
+func TestPaymentErrorLocalize(t *testing.T) {
+	err := NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 2")
+	localizer := func(err *PaymentError) string {
+		return "nonce incorrecto: " + err.Code.String()
+	}
+
+	localized := err.Localize(localizer)
+
+	assert.Equal(t, NewPaymentError(IncorrectNonce, "nonce incorrecto: IncorrectNonce"), localized)
+	assert.Equal(t, err.Code, localized.Code)
+	assert.Equal(t, "incorrect payment channel nonce, latest: 3, sent: 2", err.Message)
+}
+
+func remainingCallsChannel(fullAmount, authorizedAmount int64) *PaymentChannelData {
+	return &PaymentChannelData{FullAmount: big.NewInt(fullAmount), AuthorizedAmount: big.NewInt(authorizedAmount)}
+}
+
+func TestRemainingCallsExactDivision(t *testing.T) {
+	calls, err := RemainingCalls(remainingCallsChannel(100, 40), big.NewInt(20))
+
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(3), calls)
+}
+
+func TestRemainingCallsWithRemainder(t *testing.T) {
+	calls, err := RemainingCalls(remainingCallsChannel(100, 45), big.NewInt(20))
+
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(2), calls)
+}
+
+func TestRemainingCallsNotEnoughForOneCall(t *testing.T) {
+	calls, err := RemainingCalls(remainingCallsChannel(100, 90), big.NewInt(20))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "0", calls.String())
+}
+
+func TestRemainingCallsOverAuthorizedChannel(t *testing.T) {
+	calls, err := RemainingCalls(remainingCallsChannel(100, 120), big.NewInt(20))
+
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(0), calls)
+}
+
+func TestRemainingCallsZeroPrice(t *testing.T) {
+	calls, err := RemainingCalls(remainingCallsChannel(100, 40), big.NewInt(0))
+
+	assert.Equal(t, errors.New("price per call should be positive: 0"), err)
+	assert.Nil(t, calls)
+}
+
+func TestRemainingCallsNilPrice(t *testing.T) {
+	_, err := RemainingCalls(remainingCallsChannel(100, 40), nil)
+
+	assert.Equal(t, errors.New("price per call should be positive: <nil>"), err)
+}
+
+func TestFingerprintIsStable(t *testing.T) {
+	fixtures := newTestFixtures("fingerprint")
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	same := fixtures.Channel(42, 3, 12345, 12300, 100)
+	same.FullAmount = big.NewInt(20000)
+	same.Signature = []byte("signature")
+
+	assert.Equal(t, Fingerprint(channel), Fingerprint(channel))
+	assert.Equal(t, Fingerprint(channel), Fingerprint(same))
+	assert.Len(t, Fingerprint(channel), 64)
+}
+
+func TestFingerprintChangesWithState(t *testing.T) {
+	fixtures := newTestFixtures("fingerprint")
+	changes := map[string]func(channel *PaymentChannelData){
+		"nonce":      func(channel *PaymentChannelData) { channel.Nonce = big.NewInt(4) },
+		"authorized": func(channel *PaymentChannelData) { channel.AuthorizedAmount = big.NewInt(12301) },
+		"expiration": func(channel *PaymentChannelData) { channel.Expiration = big.NewInt(101) },
+		"signer":     func(channel *PaymentChannelData) { channel.Signer = fixtures.Address("other signer") },
+	}
+	original := Fingerprint(fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	for field, change := range changes {
+		channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+		change(channel)
+
+		assert.NotEqual(t, original, Fingerprint(channel), "fingerprint is not changed by %v", field)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/spf13/viper"
 	"math/big"
 	"reflect"
+	"sync"
 
 	"github.com/singnet/snet-daemon/blockchain"
 )
@@ -17,13 +18,45 @@ import (
 // PaymentChannelStorage is a storage for PaymentChannelData by
 // PaymentChannelKey based on TypedAtomicStorage implementation
 type PaymentChannelStorage struct {
-	delegate TypedAtomicStorage
+	delegate                TypedAtomicStorage
+	authorizedAmountChanged AuthorizedAmountChangedCallback
+
+	// creations keeps channel records which are being created by
+	// GetOrCreateChannel by channel id.
+	creationsMutex sync.Mutex
+	creations      map[string]*channelCreation
+}
+
+// channelCreation is a result of the channel record creation which is
+// shared with concurrent GetOrCreateChannel calls, done is closed when
+// result is ready.
+type channelCreation struct {
+	done    chan struct{}
+	channel *PaymentChannelData
+	err     error
+}
+
+// AuthorizedAmountChangedCallback is called after AuthorizedAmount of the
+// channel is successfully changed in storage. old is nil if channel was
+// absent in storage before update.
+type AuthorizedAmountChangedCallback func(channelID, old, new *big.Int)
+
+// PaymentChannelStorageOption is an optional setting which can be passed to
+// NewPaymentChannelStorage.
+type PaymentChannelStorageOption func(storage *PaymentChannelStorage)
+
+// WithAuthorizedAmountChangedCallback returns option which sets callback to
+// be called after channel AuthorizedAmount is changed.
+func WithAuthorizedAmountChangedCallback(callback AuthorizedAmountChangedCallback) PaymentChannelStorageOption {
+	return func(storage *PaymentChannelStorage) {
+		storage.authorizedAmountChanged = callback
+	}
 }
 
 // NewPaymentChannelStorage returns new instance of PaymentChannelStorage
 // implementation
-func NewPaymentChannelStorage(atomicStorage AtomicStorage) *PaymentChannelStorage {
-	return &PaymentChannelStorage{
+func NewPaymentChannelStorage(atomicStorage AtomicStorage, options ...PaymentChannelStorageOption) *PaymentChannelStorage {
+	storage := &PaymentChannelStorage{
 		delegate: &TypedAtomicStorageImpl{
 			atomicStorage: &PrefixedAtomicStorage{
 				delegate:  atomicStorage,
@@ -35,6 +68,10 @@ func NewPaymentChannelStorage(atomicStorage AtomicStorage) *PaymentChannelStorag
 			valueType:         reflect.TypeOf(PaymentChannelData{}),
 		},
 	}
+	for _, option := range options {
+		option(storage)
+	}
+	return storage
 }
 
 func serialize(value interface{}) (slice string, err error) {
@@ -75,19 +112,180 @@ func (storage *PaymentChannelStorage) GetAll() (states []*PaymentChannelData, er
 	return values.([]*PaymentChannelData), nil
 }
 
-// Put stores payment channel by key
+// SumAuthorizedAmounts returns sum of AuthorizedAmount of all channels from
+// the storage. Channels without AuthorizedAmount are skipped.
+func (storage *PaymentChannelStorage) SumAuthorizedAmounts() (sum *big.Int, err error) {
+	channels, err := storage.GetAll()
+	if err != nil {
+		return
+	}
+
+	sum = big.NewInt(0)
+	for _, channel := range channels {
+		if channel.AuthorizedAmount == nil {
+			log.WithField("channelID", channel.ChannelID).Warn("Channel authorized amount is not set")
+			continue
+		}
+		sum.Add(sum, channel.AuthorizedAmount)
+	}
+	return sum, nil
+}
+
+// Put stores payment channel by key. When AuthorizedAmountChangedCallback is
+// set channel is written using PutIfAbsent and CompareAndSwap, so callback
+// receives the state which is actually replaced even if channel is updated
+// concurrently.
 func (storage *PaymentChannelStorage) Put(key *PaymentChannelKey, state *PaymentChannelData) (err error) {
-	return storage.delegate.Put(key, state)
+	if storage.authorizedAmountChanged == nil {
+		return storage.delegate.Put(key, state)
+	}
+
+	for {
+		prevState, found, e := storage.Get(key)
+		if e != nil {
+			return e
+		}
+		var ok bool
+		if found {
+			ok, e = storage.delegate.CompareAndSwap(key, prevState, state)
+		} else {
+			prevState = nil
+			ok, e = storage.delegate.PutIfAbsent(key, state)
+		}
+		if e != nil {
+			return e
+		}
+		if ok {
+			storage.notifyAuthorizedAmountChanged(key, prevState, state)
+			return nil
+		}
+	}
 }
 
 // PutIfAbsent storage payment channel by key if key is absent
 func (storage *PaymentChannelStorage) PutIfAbsent(key *PaymentChannelKey, state *PaymentChannelData) (ok bool, err error) {
-	return storage.delegate.PutIfAbsent(key, state)
+	ok, err = storage.delegate.PutIfAbsent(key, state)
+	if err == nil && ok {
+		storage.notifyAuthorizedAmountChanged(key, nil, state)
+	}
+	return
 }
 
 // CompareAndSwap compares previous storage value and set new value by key
 func (storage *PaymentChannelStorage) CompareAndSwap(key *PaymentChannelKey, prevState *PaymentChannelData, newState *PaymentChannelData) (ok bool, err error) {
-	return storage.delegate.CompareAndSwap(key, prevState, newState)
+	ok, err = storage.delegate.CompareAndSwap(key, prevState, newState)
+	if err == nil && ok {
+		storage.notifyAuthorizedAmountChanged(key, prevState, newState)
+	}
+	return
+}
+
+// GetOrCreateChannel returns channel record from the storage or creates it
+// using factory if it is absent, created is true if record was created by
+// this call. Concurrent calls for the same channel in the process wait for
+// the single factory call, and record is put using PutIfAbsent, so record
+// created concurrently by another process is never overwritten.
+func (storage *PaymentChannelStorage) GetOrCreateChannel(channelID *big.Int, factory func() (*PaymentChannelData, error)) (channel *PaymentChannelData, created bool, err error) {
+	key := &PaymentChannelKey{ID: channelID}
+	channel, ok, err := storage.Get(key)
+	if err != nil || ok {
+		return channel, false, err
+	}
+
+	storage.creationsMutex.Lock()
+	if storage.creations == nil {
+		storage.creations = make(map[string]*channelCreation)
+	}
+	if creation, ok := storage.creations[channelID.String()]; ok {
+		storage.creationsMutex.Unlock()
+		<-creation.done
+		return creation.channel, false, creation.err
+	}
+	creation := &channelCreation{done: make(chan struct{})}
+	storage.creations[channelID.String()] = creation
+	storage.creationsMutex.Unlock()
+
+	creation.channel, created, creation.err = storage.createChannel(key, factory)
+
+	storage.creationsMutex.Lock()
+	delete(storage.creations, channelID.String())
+	storage.creationsMutex.Unlock()
+	close(creation.done)
+
+	return creation.channel, created, creation.err
+}
+
+func (storage *PaymentChannelStorage) createChannel(key *PaymentChannelKey, factory func() (*PaymentChannelData, error)) (channel *PaymentChannelData, created bool, err error) {
+	channel, err = factory()
+	if err != nil {
+		return nil, false, err
+	}
+
+	created, err = storage.PutIfAbsent(key, channel)
+	if err != nil || created {
+		return channel, created, err
+	}
+
+	channel, ok, err := storage.Get(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, fmt.Errorf("channel %v is deleted while being created", key.ID)
+	}
+	return channel, false, nil
+}
+
+// ClaimChannel records on-chain claim of claimedAmount from the channel. It
+// advances channel nonce, subtracts claimed amount from channel FullAmount
+// and resets AuthorizedAmount and Signature as blockchain contract does.
+// Claimed amount can be less than authorized amount because claim may
+// settle less than the client authorized. Channel is updated using single
+// CompareAndSwap against the state read, so when the same claim is recorded
+// concurrently only one call succeeds and others return error.
+func (storage *PaymentChannelStorage) ClaimChannel(channelID *big.Int, claimedAmount *big.Int) error {
+	key := &PaymentChannelKey{ID: channelID}
+	channel, ok, err := storage.Get(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("channel %v is not found", channelID)
+	}
+	if channel.AuthorizedAmount == nil || claimedAmount.Cmp(channel.AuthorizedAmount) > 0 {
+		return fmt.Errorf("claimed amount %v exceeds authorized amount %v of channel %v", claimedAmount, channel.AuthorizedAmount, channelID)
+	}
+
+	claimed := *channel
+	claimed.Nonce = new(big.Int).Add(channel.Nonce, big.NewInt(1))
+	claimed.FullAmount = new(big.Int).Sub(channel.FullAmount, claimedAmount)
+	claimed.AuthorizedAmount = big.NewInt(0)
+	claimed.Signature = nil
+
+	ok, err = storage.CompareAndSwap(key, channel, &claimed)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("channel %v is changed concurrently", channelID)
+	}
+	return nil
+}
+
+func (storage *PaymentChannelStorage) notifyAuthorizedAmountChanged(key *PaymentChannelKey, prevState, newState *PaymentChannelData) {
+	if storage.authorizedAmountChanged == nil {
+		return
+	}
+
+	var old *big.Int
+	if prevState != nil {
+		old = prevState.AuthorizedAmount
+	}
+	current := newState.AuthorizedAmount
+	if old != nil && current != nil && old.Cmp(current) == 0 {
+		return
+	}
+	storage.authorizedAmountChanged(key.ID, old, current)
 }
 
 // BlockchainChannelReader reads channel state from blockchain
@@ -95,6 +293,7 @@ type BlockchainChannelReader struct {
 
 	readChannelFromBlockchain func(channelID *big.Int) (channel *blockchain.MultiPartyEscrowChannel, ok bool, err error)
 	recipientPaymentAddress   func() common.Address
+	recipientDelegations      RecipientDelegations
 }
 
 // NewBlockchainChannelReader returns new instance of blockchain channel reader
@@ -108,6 +307,12 @@ func NewBlockchainChannelReader(processor *blockchain.Processor, cfg *viper.Vipe
 	}
 }
 
+// AcceptDelegatedRecipients makes reader to accept channels which recipient
+// is delegated to the service payment address, see RecipientDelegations.
+func (reader *BlockchainChannelReader) AcceptDelegatedRecipients(delegations RecipientDelegations) {
+	reader.recipientDelegations = delegations
+}
+
 // GetChannelStateFromBlockchain returns channel state from Ethereum
 // blockchain. ok is false if channel was not found.
 func (reader *BlockchainChannelReader) GetChannelStateFromBlockchain(key *PaymentChannelKey) (channel *PaymentChannelData, ok bool, err error) {
@@ -120,7 +325,7 @@ func (reader *BlockchainChannelReader) GetChannelStateFromBlockchain(key *Paymen
 	recipientPaymentAddress := reader.recipientPaymentAddress()
 
 
-	if recipientPaymentAddress != ch.Recipient {
+	if !reader.recipientDelegations.accepts(ch.Recipient, recipientPaymentAddress) {
 		log.WithField("recipientPaymentAddress", recipientPaymentAddress).
 			WithField("ch.Recipient", ch.Recipient).
 			Warn("Recipient Address from service metadata not Match on what was retrieved from Channel")
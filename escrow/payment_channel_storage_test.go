@@ -3,7 +3,10 @@ package escrow
 import (
 	"errors"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -81,6 +84,330 @@ func (suite *PaymentChannelStorageSuite) TestGetAll() {
 	assert.Equal(suite.T(), []*PaymentChannelData{channelA, channelB}, channels)
 }
 
+func (suite *PaymentChannelStorageSuite) TestSumAuthorizedAmounts() {
+	channelA := suite.channel()
+	channelA.AuthorizedAmount = big.NewInt(100)
+	suite.storage.Put(suite.key(41), channelA)
+	channelB := suite.channel()
+	channelB.AuthorizedAmount = big.NewInt(23)
+	suite.storage.Put(suite.key(42), channelB)
+	channelC := suite.channel()
+	channelC.AuthorizedAmount = nil
+	suite.storage.Put(suite.key(43), channelC)
+
+	sum, err := suite.storage.SumAuthorizedAmounts()
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), big.NewInt(123), sum)
+}
+
+func (suite *PaymentChannelStorageSuite) TestSumAuthorizedAmountsEmptyStorage() {
+	sum, err := suite.storage.SumAuthorizedAmounts()
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), big.NewInt(0), sum)
+}
+
+type authorizedAmountChange struct {
+	channelID *big.Int
+	old       *big.Int
+	new       *big.Int
+}
+
+type failingAtomicStorage struct {
+	AtomicStorage
+	err error
+}
+
+func (storage *failingAtomicStorage) Put(key string, value string) (err error) {
+	return storage.err
+}
+
+func (storage *failingAtomicStorage) CompareAndSwap(key string, prevValue string, newValue string) (ok bool, err error) {
+	return false, storage.err
+}
+
+func (suite *PaymentChannelStorageSuite) storageWithCallback(atomicStorage AtomicStorage) (*PaymentChannelStorage, *[]authorizedAmountChange) {
+	changes := []authorizedAmountChange{}
+	storage := NewPaymentChannelStorage(atomicStorage, WithAuthorizedAmountChangedCallback(func(channelID, old, new *big.Int) {
+		changes = append(changes, authorizedAmountChange{channelID, old, new})
+	}))
+	return storage, &changes
+}
+
+func (suite *PaymentChannelStorageSuite) TestAuthorizedAmountChangedCallback() {
+	storage, changes := suite.storageWithCallback(suite.memoryStorage)
+	channel := suite.channel()
+	assert.Nil(suite.T(), storage.Put(suite.key(42), channel))
+	updated := suite.channel()
+	updated.AuthorizedAmount = big.NewInt(10)
+	assert.Nil(suite.T(), storage.Put(suite.key(42), updated))
+	sameAmount := suite.channel()
+	sameAmount.AuthorizedAmount = big.NewInt(10)
+	sameAmount.Signature = []byte{0x1}
+	assert.Nil(suite.T(), storage.Put(suite.key(42), sameAmount))
+	swapped := suite.channel()
+	swapped.AuthorizedAmount = big.NewInt(20)
+	ok, err := storage.CompareAndSwap(suite.key(42), sameAmount, swapped)
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	assert.Equal(suite.T(), []authorizedAmountChange{
+		{big.NewInt(42), nil, big.NewInt(0)},
+		{big.NewInt(42), big.NewInt(0), big.NewInt(10)},
+		{big.NewInt(42), big.NewInt(10), big.NewInt(20)},
+	}, *changes)
+}
+
+func (suite *PaymentChannelStorageSuite) TestAuthorizedAmountChangedCallbackFailedWrite() {
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), suite.channel()))
+	storage, changes := suite.storageWithCallback(&failingAtomicStorage{
+		AtomicStorage: suite.memoryStorage,
+		err:           errors.New("storage error"),
+	})
+	updated := suite.channel()
+	updated.AuthorizedAmount = big.NewInt(10)
+
+	errA := storage.Put(suite.key(42), updated)
+	_, errB := storage.CompareAndSwap(suite.key(42), suite.channel(), updated)
+
+	assert.Equal(suite.T(), errors.New("storage error"), errA)
+	assert.Equal(suite.T(), errors.New("storage error"), errB)
+	assert.Equal(suite.T(), []authorizedAmountChange{}, *changes)
+}
+
+func (suite *PaymentChannelStorageSuite) TestAuthorizedAmountChangedCallbackFailedCompareAndSwap() {
+	storage, changes := suite.storageWithCallback(suite.memoryStorage)
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), suite.channel()))
+	prev := suite.channel()
+	prev.AuthorizedAmount = big.NewInt(5)
+	updated := suite.channel()
+	updated.AuthorizedAmount = big.NewInt(10)
+
+	ok, err := storage.CompareAndSwap(suite.key(42), prev, updated)
+
+	assert.Nil(suite.T(), err)
+	assert.False(suite.T(), ok)
+	assert.Equal(suite.T(), []authorizedAmountChange{}, *changes)
+}
+
+// racingAtomicStorage calls race once right before the first
+// CompareAndSwap call to emulate concurrent update.
+type racingAtomicStorage struct {
+	AtomicStorage
+	race  func() error
+	raced bool
+}
+
+func (storage *racingAtomicStorage) CompareAndSwap(key string, prevValue string, newValue string) (ok bool, err error) {
+	if !storage.raced {
+		storage.raced = true
+		if err = storage.race(); err != nil {
+			return
+		}
+	}
+	return storage.AtomicStorage.CompareAndSwap(key, prevValue, newValue)
+}
+
+func (suite *PaymentChannelStorageSuite) TestAuthorizedAmountChangedCallbackConcurrentPut() {
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), suite.channel()))
+	concurrent := suite.channel()
+	concurrent.AuthorizedAmount = big.NewInt(5)
+	storage, changes := suite.storageWithCallback(&racingAtomicStorage{
+		AtomicStorage: suite.memoryStorage,
+		race: func() error {
+			return suite.storage.Put(suite.key(42), concurrent)
+		},
+	})
+	updated := suite.channel()
+	updated.AuthorizedAmount = big.NewInt(10)
+
+	err := storage.Put(suite.key(42), updated)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []authorizedAmountChange{
+		{big.NewInt(42), big.NewInt(5), big.NewInt(10)},
+	}, *changes)
+	channel, ok, err := suite.storage.Get(suite.key(42))
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), updated, channel)
+}
+
+func (suite *PaymentChannelStorageSuite) TestClaimChannel() {
+	channel := suite.channel()
+	channel.AuthorizedAmount = big.NewInt(100)
+	channel.Signature = []byte{0x1}
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), channel))
+
+	err := suite.storage.ClaimChannel(big.NewInt(42), big.NewInt(100))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	claimed, ok, err := suite.storage.Get(suite.key(42))
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), ok)
+	expected := suite.channel()
+	expected.Nonce = big.NewInt(4)
+	expected.FullAmount = big.NewInt(12245)
+	assert.Equal(suite.T(), expected, claimed)
+}
+
+func (suite *PaymentChannelStorageSuite) TestClaimChannelPartially() {
+	channel := suite.channel()
+	channel.AuthorizedAmount = big.NewInt(100)
+	channel.Signature = []byte{0x1}
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), channel))
+
+	err := suite.storage.ClaimChannel(big.NewInt(42), big.NewInt(60))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	claimed, ok, err := suite.storage.Get(suite.key(42))
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), ok)
+	expected := suite.channel()
+	expected.Nonce = big.NewInt(4)
+	expected.FullAmount = big.NewInt(12285)
+	assert.Equal(suite.T(), expected, claimed)
+}
+
+func (suite *PaymentChannelStorageSuite) TestClaimChannelNotFound() {
+	err := suite.storage.ClaimChannel(big.NewInt(42), big.NewInt(100))
+
+	assert.Equal(suite.T(), errors.New("channel 42 is not found"), err)
+}
+
+func (suite *PaymentChannelStorageSuite) TestClaimChannelAmountExceedsAuthorizedAmount() {
+	channel := suite.channel()
+	channel.AuthorizedAmount = big.NewInt(100)
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), channel))
+
+	err := suite.storage.ClaimChannel(big.NewInt(42), big.NewInt(101))
+
+	assert.Equal(suite.T(), errors.New("claimed amount 101 exceeds authorized amount 100 of channel 42"), err)
+	unchanged, _, _ := suite.storage.Get(suite.key(42))
+	assert.Equal(suite.T(), channel, unchanged)
+}
+
+func (suite *PaymentChannelStorageSuite) TestClaimChannelChangedConcurrently() {
+	channel := suite.channel()
+	channel.AuthorizedAmount = big.NewInt(100)
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), channel))
+	updated := suite.channel()
+	updated.AuthorizedAmount = big.NewInt(110)
+	storage := NewPaymentChannelStorage(&racingAtomicStorage{
+		AtomicStorage: suite.memoryStorage,
+		race: func() error {
+			return suite.storage.Put(suite.key(42), updated)
+		},
+	})
+
+	err := storage.ClaimChannel(big.NewInt(42), big.NewInt(100))
+
+	assert.Equal(suite.T(), errors.New("channel 42 is changed concurrently"), err)
+	unchanged, _, _ := suite.storage.Get(suite.key(42))
+	assert.Equal(suite.T(), updated, unchanged)
+}
+
+func (suite *PaymentChannelStorageSuite) TestClaimChannelConcurrently() {
+	channel := suite.channel()
+	channel.AuthorizedAmount = big.NewInt(100)
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), channel))
+
+	errs := make(chan error, 2)
+	start := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			<-start
+			errs <- suite.storage.ClaimChannel(big.NewInt(42), big.NewInt(100))
+		}()
+	}
+	close(start)
+
+	succeeded := 0
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			succeeded++
+		} else {
+			assert.Contains(suite.T(), []error{
+				errors.New("channel 42 is changed concurrently"),
+				errors.New("claimed amount 100 exceeds authorized amount 0 of channel 42"),
+			}, err)
+		}
+	}
+	assert.Equal(suite.T(), 1, succeeded)
+	claimed, _, err := suite.storage.Get(suite.key(42))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), big.NewInt(4), claimed.Nonce)
+}
+
+func (suite *PaymentChannelStorageSuite) TestGetOrCreateChannelCreates() {
+	channel, created, err := suite.storage.GetOrCreateChannel(big.NewInt(42), func() (*PaymentChannelData, error) {
+		return suite.channel(), nil
+	})
+
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), created)
+	assert.Equal(suite.T(), suite.channel(), channel)
+	stored, ok, err := suite.storage.Get(suite.key(42))
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), suite.channel(), stored)
+}
+
+func (suite *PaymentChannelStorageSuite) TestGetOrCreateChannelGetsExisting() {
+	existing := suite.channel()
+	existing.AuthorizedAmount = big.NewInt(100)
+	assert.Nil(suite.T(), suite.storage.Put(suite.key(42), existing))
+
+	channel, created, err := suite.storage.GetOrCreateChannel(big.NewInt(42), func() (*PaymentChannelData, error) {
+		suite.T().Fatal("factory should not be called")
+		return nil, nil
+	})
+
+	assert.Nil(suite.T(), err)
+	assert.False(suite.T(), created)
+	assert.Equal(suite.T(), existing, channel)
+}
+
+func (suite *PaymentChannelStorageSuite) TestGetOrCreateChannelFactoryError() {
+	_, created, err := suite.storage.GetOrCreateChannel(big.NewInt(42), func() (*PaymentChannelData, error) {
+		return nil, errors.New("blockchain error")
+	})
+
+	assert.Equal(suite.T(), errors.New("blockchain error"), err)
+	assert.False(suite.T(), created)
+	_, ok, _ := suite.storage.Get(suite.key(42))
+	assert.False(suite.T(), ok)
+}
+
+func (suite *PaymentChannelStorageSuite) TestGetOrCreateChannelConcurrently() {
+	var factoryCalls, createdCount int32
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			channel, created, err := suite.storage.GetOrCreateChannel(big.NewInt(42), func() (*PaymentChannelData, error) {
+				atomic.AddInt32(&factoryCalls, 1)
+				time.Sleep(10 * time.Millisecond)
+				return suite.channel(), nil
+			})
+			assert.Nil(suite.T(), err)
+			assert.Equal(suite.T(), suite.channel(), channel)
+			if created {
+				atomic.AddInt32(&createdCount, 1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(suite.T(), int32(1), factoryCalls)
+	assert.Equal(suite.T(), int32(1), createdCount)
+}
+
 type BlockchainChannelReaderSuite struct {
 	suite.Suite
 
@@ -1,10 +1,18 @@
 package escrow
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/singnet/snet-daemon/blockchain"
 	"github.com/singnet/snet-daemon/handler"
@@ -24,6 +32,15 @@ const (
 	// PaymentChannelSignatureHeader is a signature of the client to confirm
 	// amount withdrawing authorization. Value is an array of bytes.
 	PaymentChannelSignatureHeader = "snet-payment-channel-signature-bin"
+	// PaymentChannelEncodedSignatureHeader is an alternative to
+	// PaymentChannelSignatureHeader for clients which cannot send binary
+	// metadata. Value is a signature encoded as 0x-hex or base64 string, see
+	// DecodeSignature. Only one of the signature headers should be passed.
+	PaymentChannelEncodedSignatureHeader = "snet-payment-channel-signature"
+	// PaymentCallDeadlineHeader is an optional block number until which
+	// client expects the call to be served. Value is a string containing a
+	// decimal number, see Payment.CallDeadline.
+	PaymentCallDeadlineHeader = "snet-payment-call-deadline"
 
 	// EscrowPaymentType each call should have id and nonce of payment channel
 	// in metadata.
@@ -34,18 +51,37 @@ type paymentChannelPaymentHandler struct {
 	service            PaymentChannelService
 	mpeContractAddress func() common.Address
 	incomeValidator    IncomeValidator
+	localizer          PaymentErrorLocalizer
+}
+
+// PaymentHandlerOption is an optional setting which can be passed to
+// NewPaymentHandler.
+type PaymentHandlerOption func(h *paymentChannelPaymentHandler)
+
+// WithLocalizer returns option which replaces messages of payment errors
+// returned to the client by messages returned from localizer. gRPC status
+// codes and PaymentError codes are not affected.
+func WithLocalizer(localizer PaymentErrorLocalizer) PaymentHandlerOption {
+	return func(h *paymentChannelPaymentHandler) {
+		h.localizer = localizer
+	}
 }
 
 // NewPaymentHandler retuns new MultiPartyEscrow contract payment handler.
 func NewPaymentHandler(
 	service PaymentChannelService,
 	processor *blockchain.Processor,
-	incomeValidator IncomeValidator) handler.PaymentHandler {
-	return &paymentChannelPaymentHandler{
+	incomeValidator IncomeValidator,
+	options ...PaymentHandlerOption) handler.PaymentHandler {
+	h := &paymentChannelPaymentHandler{
 		service:            service,
 		mpeContractAddress: processor.EscrowContractAddress,
 		incomeValidator:    incomeValidator,
 	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
 }
 
 func (h *paymentChannelPaymentHandler) Type() (typ string) {
@@ -60,57 +96,137 @@ func (h *paymentChannelPaymentHandler) Payment(context *handler.GrpcStreamContex
 
 	transaction, e := h.service.StartPaymentTransaction(internalPayment)
 	if e != nil {
-		return nil, paymentErrorToGrpcError(e)
+		return nil, h.toGrpcError(e)
 	}
 
 	income := big.NewInt(0)
 	income.Sub(internalPayment.Amount, transaction.Channel().AuthorizedAmount)
-	e = h.incomeValidator.Validate(&IncomeData{Income: income, GrpcContext: context})
+	e = h.incomeValidator.Validate(&IncomeData{Income: income, GrpcContext: context, ChannelID: internalPayment.ChannelID, TokenDecimals: transaction.Channel().TokenDecimals, Token: transaction.Channel().Token})
 	if e != nil {
 		//Make sure the transaction is Rolled back , else this will cause a lock on the channel
 		transaction.Rollback()
-		return nil, paymentErrorToGrpcError(e)
+		return nil, h.toGrpcError(e)
 	}
 
 	return transaction, nil
 }
 
 func (h *paymentChannelPaymentHandler) getPaymentFromContext(context *handler.GrpcStreamContext) (payment *Payment, err *handler.GrpcError) {
-	channelID, err := handler.GetBigInt(context.MD, PaymentChannelIDHeader)
+	return paymentFromMetadata(context.MD, h.mpeContractAddress())
+}
+
+// PaymentFromMetadata parses payment from the canonical gRPC metadata headers:
+// PaymentChannelIDHeader, PaymentChannelNonceHeader,
+// PaymentChannelAmountHeader and PaymentChannelSignatureHeader. mpe is an
+// address of the MultiPartyEscrow contract the payment is sent to. Returned
+// error is a gRPC status error with codes.InvalidArgument code when some
+// header is missing or has incorrect format or when payment does not pass
+// Payment.Validate check. Signature can be passed via
+// PaymentChannelEncodedSignatureHeader instead of
+// PaymentChannelSignatureHeader, if it cannot be decoded then returned
+// error is a status of MalformedSignature payment error.
+func PaymentFromMetadata(md metadata.MD, mpe common.Address) (payment *Payment, err error) {
+	payment, e := paymentFromMetadata(md, mpe)
+	if e != nil {
+		return nil, e.Err()
+	}
+	return payment, nil
+}
+
+func paymentFromMetadata(md metadata.MD, mpe common.Address) (payment *Payment, err *handler.GrpcError) {
+	channelID, err := handler.GetBigInt(md, PaymentChannelIDHeader)
 	if err != nil {
 		return
 	}
 
-	channelNonce, err := handler.GetBigInt(context.MD, PaymentChannelNonceHeader)
+	channelNonce, err := handler.GetBigInt(md, PaymentChannelNonceHeader)
 	if err != nil {
 		return
 	}
 
-	amount, err := handler.GetBigInt(context.MD, PaymentChannelAmountHeader)
+	amount, err := handler.GetBigInt(md, PaymentChannelAmountHeader)
 	if err != nil {
 		return
 	}
 
-	signature, err := handler.GetBytes(context.MD, PaymentChannelSignatureHeader)
+	signature, err := signatureFromMetadata(md)
 	if err != nil {
 		return
 	}
 
-	return &Payment{
-		MpeContractAddress: h.mpeContractAddress(),
+	payment = &Payment{
+		MpeContractAddress: mpe,
 		ChannelID:          channelID,
 		ChannelNonce:       channelNonce,
 		Amount:             amount,
 		Signature:          signature,
-	}, nil
+	}
+	if len(md.Get(PaymentCallDeadlineHeader)) > 0 {
+		if payment.CallDeadline, err = handler.GetBigInt(md, PaymentCallDeadlineHeader); err != nil {
+			return nil, err
+		}
+	}
+	if e := payment.Validate(); e != nil {
+		return nil, handler.NewGrpcErrorf(codes.InvalidArgument, "incorrect payment: %v", e)
+	}
+
+	return payment, nil
+}
+
+// signatureFromMetadata returns signature passed either as binary value of
+// PaymentChannelSignatureHeader or as encoded value of
+// PaymentChannelEncodedSignatureHeader.
+func signatureFromMetadata(md metadata.MD) (signature []byte, err *handler.GrpcError) {
+	if len(md.Get(PaymentChannelEncodedSignatureHeader)) == 0 {
+		return handler.GetBytes(md, PaymentChannelSignatureHeader)
+	}
+	if len(md.Get(PaymentChannelSignatureHeader)) > 0 {
+		return nil, handler.NewGrpcErrorf(codes.InvalidArgument, "only one of \"%v\" and \"%v\" should be passed", PaymentChannelSignatureHeader, PaymentChannelEncodedSignatureHeader)
+	}
+
+	encoded, err := handler.GetSingleValue(md, PaymentChannelEncodedSignatureHeader)
+	if err != nil {
+		return
+	}
+	signature, e := DecodeSignature(encoded)
+	if e != nil {
+		return nil, paymentErrorToGrpcError(NewPaymentError(MalformedSignature, "cannot decode payment signature: %v", e))
+	}
+	return signature, nil
+}
+
+// DecodeSignature decodes signature which is passed as a string. String
+// which starts from "0x" is decoded as hex, otherwise it is decoded as
+// standard base64.
+func DecodeSignature(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		signature, err := hex.DecodeString(s[2:])
+		if err != nil {
+			return nil, errors.New("incorrect hex signature: " + err.Error())
+		}
+		return signature, nil
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("signature is neither 0x-hex nor base64 encoded")
+	}
+	return signature, nil
 }
 
 func (h *paymentChannelPaymentHandler) Complete(payment handler.Payment) (err *handler.GrpcError) {
-	return paymentErrorToGrpcError(payment.(*paymentTransaction).Commit())
+	return h.toGrpcError(payment.(*paymentTransaction).Commit())
 }
 
 func (h *paymentChannelPaymentHandler) CompleteAfterError(payment handler.Payment, result error) (err *handler.GrpcError) {
-	return paymentErrorToGrpcError(payment.(*paymentTransaction).Rollback())
+	return h.toGrpcError(payment.(*paymentTransaction).Rollback())
+}
+
+func (h *paymentChannelPaymentHandler) toGrpcError(err error) *handler.GrpcError {
+	if paymentErr, ok := err.(*PaymentError); ok && h.localizer != nil {
+		return paymentErrorToGrpcError(paymentErr.Localize(h.localizer))
+	}
+	return paymentErrorToGrpcError(err)
 }
 
 func paymentErrorToGrpcError(err error) *handler.GrpcError {
@@ -118,23 +234,66 @@ func paymentErrorToGrpcError(err error) *handler.GrpcError {
 		return nil
 	}
 
-	if _, ok := err.(*PaymentError); !ok {
+	paymentErr, ok := err.(*PaymentError)
+	if !ok {
 		return handler.NewGrpcErrorf(codes.Internal, "internal error: %v", err)
 	}
 
-	var grpcCode codes.Code
-	switch err.(*PaymentError).Code {
+	return &handler.GrpcError{Status: paymentErr.GRPCStatus()}
+}
+
+func paymentErrorCodeToGrpcCode(code PaymentErrorCode) codes.Code {
+	switch code {
 	case Internal:
-		grpcCode = codes.Internal
-	case Unauthenticated:
-		grpcCode = codes.Unauthenticated
-	case FailedPrecondition:
-		grpcCode = codes.FailedPrecondition
+		return codes.Internal
+	case Unauthenticated, InsufficientIncrement, MalformedSignature:
+		return codes.Unauthenticated
+	case FailedPrecondition, LowRemainingCapacity, ChannelExtensionRequired:
+		return codes.FailedPrecondition
 	case IncorrectNonce:
-		grpcCode = handler.IncorrectNonce
+		return handler.IncorrectNonce
+	case SpendingCapExceeded:
+		return codes.ResourceExhausted
+	case SuspectedFraud, SenderNotAllowed, GroupNotAllowed:
+		return codes.PermissionDenied
 	default:
-		grpcCode = codes.Internal
+		return codes.Internal
 	}
+}
+
+// PaymentErrorDomain is a value of the "domain" field of the details
+// returned by PaymentError.GRPCStatus.
+const PaymentErrorDomain = "escrow.snet-daemon"
+
+// GRPCStatus returns gRPC status of the error. Status contains
+// google.protobuf.Struct detail which "reason" field is error code name, see
+// PaymentErrorCode.String, "domain" field is PaymentErrorDomain and
+// "metadata" field is a struct of error Details. It allows gRPC clients to
+// handle errors without parsing messages.
+func (err *PaymentError) GRPCStatus() *status.Status {
+	st := status.New(paymentErrorCodeToGrpcCode(err.Code), err.Message)
+	withDetails, e := st.WithDetails(paymentErrorInfo(err))
+	if e != nil {
+		log.WithError(e).Error("Cannot add details to payment error status")
+		return st
+	}
+	return withDetails
+}
+
+// paymentErrorInfo returns details of the payment error as a
+// google.protobuf.Struct.
+func paymentErrorInfo(err *PaymentError) *structpb.Struct {
+	fields := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(err.Details))}
+	for key, value := range err.Details {
+		fields.Fields[key] = stringValue(value)
+	}
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"reason":   stringValue(err.Code.String()),
+		"domain":   stringValue(PaymentErrorDomain),
+		"metadata": {Kind: &structpb.Value_StructValue{StructValue: fields}},
+	}}
+}
 
-	return handler.NewGrpcErrorf(grpcCode, err.(*PaymentError).Message)
+func stringValue(value string) *structpb.Value {
+	return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: value}}
 }
@@ -1,15 +1,21 @@
 package escrow
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"math/big"
 	"strconv"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/singnet/snet-daemon/blockchain"
 	"github.com/singnet/snet-daemon/handler"
@@ -128,7 +134,7 @@ func (suite *PaymentHandlerTestSuite) TestStartTransactionError() {
 
 	payment, err := paymentHandler.Payment(context)
 
-	assert.Equal(suite.T(), handler.NewGrpcError(codes.FailedPrecondition, "another transaction in progress"), err)
+	assertPaymentGrpcError(suite.T(), codes.FailedPrecondition, "another transaction in progress", "FailedPrecondition", err)
 	assert.Nil(suite.T(), payment)
 }
 
@@ -140,6 +146,295 @@ func (suite *PaymentHandlerTestSuite) TestValidatePaymentIncorrectIncome() {
 
 	payment, err := paymentHandler.Payment(context)
 
-	assert.Equal(suite.T(), handler.NewGrpcError(codes.Unauthenticated, "incorrect payment income: \"45\", expected \"46\""), err)
+	assertPaymentGrpcError(suite.T(), codes.Unauthenticated, "incorrect payment income: \"45\", expected \"46\"", "Unauthenticated", err)
 	assert.Nil(suite.T(), payment)
 }
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadata() {
+	mpeContractAddress := blockchain.HexToAddress("0xf25186b5081ff5ce73482ad761db0eb0d25abfbf")
+	md := suite.grpcMetadata(42, 3, 12345, []byte{0x1, 0x2, 0xFE, 0xFF})
+
+	payment, err := PaymentFromMetadata(md, mpeContractAddress)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), &Payment{
+		MpeContractAddress: mpeContractAddress,
+		ChannelID:          big.NewInt(42),
+		ChannelNonce:       big.NewInt(3),
+		Amount:             big.NewInt(12345),
+		Signature:          []byte{0x1, 0x2, 0xFE, 0xFF},
+	}, payment)
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataEncodedSignature() {
+	signature := bytes.Repeat([]byte{0xFE}, 65)
+	for _, encoded := range []string{
+		"0x" + hex.EncodeToString(signature),
+		base64.StdEncoding.EncodeToString(signature),
+	} {
+		md := suite.grpcMetadata(42, 3, 12345, nil)
+		delete(md, PaymentChannelSignatureHeader)
+		md.Set(PaymentChannelEncodedSignatureHeader, encoded)
+
+		payment, err := PaymentFromMetadata(md, blockchain.HexToAddress("0xf25186b5081ff5ce73482ad761db0eb0d25abfbf"))
+
+		assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+		assert.Equal(suite.T(), signature, payment.Signature)
+	}
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataBinarySignatureIsNotDecoded() {
+	signature := []byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xFE}, 65)))
+	md := suite.grpcMetadata(42, 3, 12345, signature)
+
+	payment, err := PaymentFromMetadata(md, blockchain.HexToAddress("0xf25186b5081ff5ce73482ad761db0eb0d25abfbf"))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), signature, payment.Signature)
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataMalformedEncodedSignature() {
+	md := suite.grpcMetadata(42, 3, 12345, nil)
+	delete(md, PaymentChannelSignatureHeader)
+	md.Set(PaymentChannelEncodedSignatureHeader, "0x01zz")
+
+	payment, err := paymentFromMetadata(md, common.Address{})
+
+	assertPaymentGrpcError(suite.T(), codes.Unauthenticated, "cannot decode payment signature: incorrect hex signature: encoding/hex: invalid byte: U+007A 'z'", "MalformedSignature", err)
+	assert.Nil(suite.T(), payment)
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataBothSignatureHeaders() {
+	md := suite.grpcMetadata(42, 3, 12345, []byte{0x1, 0x2, 0xFE, 0xFF})
+	md.Set(PaymentChannelEncodedSignatureHeader, "0x0102feff")
+
+	payment, err := PaymentFromMetadata(md, common.Address{})
+
+	assert.Equal(suite.T(), handler.NewGrpcErrorf(codes.InvalidArgument, "only one of \"%v\" and \"%v\" should be passed", PaymentChannelSignatureHeader, PaymentChannelEncodedSignatureHeader).Err(), err)
+	assert.Nil(suite.T(), payment)
+}
+
+func TestDecodeSignature(t *testing.T) {
+	signature := []byte{0x1, 0x2, 0xFE, 0xFF}
+
+	fromHex, err := DecodeSignature("0x0102feff")
+	assert.Nil(t, err)
+	fromBase64, err := DecodeSignature("AQL+/w==")
+	assert.Nil(t, err)
+
+	assert.Equal(t, signature, fromHex)
+	assert.Equal(t, signature, fromBase64)
+}
+
+func TestDecodeSignatureInvalidEncoding(t *testing.T) {
+	_, err := DecodeSignature("not a signature!")
+	assert.Equal(t, errors.New("signature is neither 0x-hex nor base64 encoded"), err)
+
+	_, err = DecodeSignature("0x01zz")
+	assert.Equal(t, errors.New("incorrect hex signature: encoding/hex: invalid byte: U+007A 'z'"), err)
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataMissingHeaders() {
+	for _, header := range []string{PaymentChannelIDHeader, PaymentChannelNonceHeader, PaymentChannelAmountHeader, PaymentChannelSignatureHeader} {
+		md := suite.grpcMetadata(42, 3, 12345, []byte{0x1, 0x2, 0xFE, 0xFF})
+		delete(md, header)
+
+		payment, err := PaymentFromMetadata(md, common.Address{})
+
+		assert.Equal(suite.T(), handler.NewGrpcErrorf(codes.InvalidArgument, "missing \"%v\"", header).Err(), err)
+		assert.Nil(suite.T(), payment)
+	}
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataMalformedHeaders() {
+	for _, header := range []string{PaymentChannelIDHeader, PaymentChannelNonceHeader, PaymentChannelAmountHeader} {
+		md := suite.grpcMetadata(42, 3, 12345, []byte{0x1, 0x2, 0xFE, 0xFF})
+		md.Set(header, "not-a-number")
+
+		payment, err := PaymentFromMetadata(md, common.Address{})
+
+		assert.Equal(suite.T(), handler.NewGrpcErrorf(codes.InvalidArgument, "incorrect format \"%v\": \"not-a-number\"", header).Err(), err)
+		assert.Nil(suite.T(), payment)
+	}
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataCallDeadline() {
+	md := suite.grpcMetadata(42, 3, 12345, []byte{0x1, 0x2, 0xFE, 0xFF})
+	md.Set(PaymentCallDeadlineHeader, "150")
+
+	payment, err := PaymentFromMetadata(md, common.Address{1})
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), big.NewInt(150), payment.CallDeadline)
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataMalformedCallDeadline() {
+	md := suite.grpcMetadata(42, 3, 12345, []byte{0x1, 0x2, 0xFE, 0xFF})
+	md.Set(PaymentCallDeadlineHeader, "soon")
+
+	payment, err := PaymentFromMetadata(md, common.Address{1})
+
+	assert.Equal(suite.T(), handler.NewGrpcErrorf(codes.InvalidArgument, "incorrect format \"%v\": \"soon\"", PaymentCallDeadlineHeader).Err(), err)
+	assert.Nil(suite.T(), payment)
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentFromMetadataDuplicatedHeader() {
+	md := suite.grpcMetadata(42, 3, 12345, []byte{0x1, 0x2, 0xFE, 0xFF})
+	md.Append(PaymentChannelIDHeader, "43")
+
+	payment, err := PaymentFromMetadata(md, common.Address{})
+
+	assert.Equal(suite.T(), handler.NewGrpcError(codes.InvalidArgument, "too many values for key \"snet-payment-channel-id\": [42 43]").Err(), err)
+	assert.Nil(suite.T(), payment)
+}
+
+func (suite *PaymentHandlerTestSuite) TestGetPaymentNegativeAmount() {
+	context := suite.grpcContext(func(md *metadata.MD) {
+		md.Set(PaymentChannelAmountHeader, "-1")
+	})
+
+	payment, err := suite.paymentHandler.Payment(context)
+
+	assert.Equal(suite.T(), handler.NewGrpcError(codes.InvalidArgument, "incorrect payment: Amount is negative: -1"), err)
+	assert.Nil(suite.T(), payment)
+}
+
+func (suite *PaymentHandlerTestSuite) TestLowRemainingCapacityIsFailedPrecondition() {
+	err := paymentErrorToGrpcError(NewPaymentError(LowRemainingCapacity, "remaining channel capacity 9 is below minimum 10, channel should be topped up"))
+
+	assertPaymentGrpcError(suite.T(), codes.FailedPrecondition, "remaining channel capacity 9 is below minimum 10, channel should be topped up", "LowRemainingCapacity", err)
+}
+
+func (suite *PaymentHandlerTestSuite) TestSpendingCapExceededIsResourceExhausted() {
+	err := paymentErrorToGrpcError(NewPaymentError(SpendingCapExceeded, "payment signer 0x01 exceeds spending cap 100"))
+
+	assertPaymentGrpcError(suite.T(), codes.ResourceExhausted, "payment signer 0x01 exceeds spending cap 100", "SpendingCapExceeded", err)
+}
+
+func (suite *PaymentHandlerTestSuite) TestChannelExtensionRequiredIsFailedPrecondition() {
+	err := paymentErrorToGrpcError(NewPaymentError(ChannelExtensionRequired, "please extend the channel"))
+
+	assertPaymentGrpcError(suite.T(), codes.FailedPrecondition, "please extend the channel", "ChannelExtensionRequired", err)
+}
+
+func (suite *PaymentHandlerTestSuite) TestSuspectedFraudIsPermissionDenied() {
+	err := paymentErrorToGrpcError(NewPaymentError(SuspectedFraud, "payment is rejected as suspicious"))
+
+	assertPaymentGrpcError(suite.T(), codes.PermissionDenied, "payment is rejected as suspicious", "SuspectedFraud", err)
+}
+
+func (suite *PaymentHandlerTestSuite) TestSenderNotAllowedIsPermissionDenied() {
+	err := paymentErrorToGrpcError(NewPaymentError(SenderNotAllowed, "payment channel sender 0x01 is not allowed"))
+
+	assertPaymentGrpcError(suite.T(), codes.PermissionDenied, "payment channel sender 0x01 is not allowed", "SenderNotAllowed", err)
+}
+
+func (suite *PaymentHandlerTestSuite) TestGroupNotAllowedIsPermissionDenied() {
+	err := paymentErrorToGrpcError(NewPaymentError(GroupNotAllowed, "payment channel group 7b is not allowed"))
+
+	assertPaymentGrpcError(suite.T(), codes.PermissionDenied, "payment channel group 7b is not allowed", "GroupNotAllowed", err)
+}
+
+func (suite *PaymentHandlerTestSuite) TestLocalizedPaymentError() {
+	context := suite.grpcContext(func(md *metadata.MD) {})
+	paymentHandler := suite.paymentHandler
+	paymentHandler.incomeValidator = &incomeValidatorMockType{err: NewPaymentError(Unauthenticated, "income 44 does not equal to price 45")}
+	WithLocalizer(func(err *PaymentError) string { return "pago incorrecto" })(&paymentHandler)
+
+	payment, err := paymentHandler.Payment(context)
+
+	assertPaymentGrpcError(suite.T(), codes.Unauthenticated, "pago incorrecto", "Unauthenticated", err)
+	assert.Nil(suite.T(), payment)
+}
+
+func (suite *PaymentHandlerTestSuite) TestLocalizerDoesNotChangeInternalErrors() {
+	context := suite.grpcContext(func(md *metadata.MD) {})
+	paymentHandler := suite.paymentHandler
+	paymentHandler.service = &paymentChannelServiceMock{err: errors.New("storage error")}
+	WithLocalizer(func(err *PaymentError) string { return "pago incorrecto" })(&paymentHandler)
+
+	payment, err := paymentHandler.Payment(context)
+
+	assert.Equal(suite.T(), handler.NewGrpcError(codes.Internal, "internal error: storage error"), err)
+	assert.Nil(suite.T(), payment)
+}
+
+// paymentErrorDetails decodes payment error details from the gRPC status
+func paymentErrorDetails(t *testing.T, st *status.Status) (reason string, domain string, metadata map[string]string) {
+	if !assert.Equal(t, 1, len(st.Details())) {
+		return
+	}
+	info, ok := st.Details()[0].(*structpb.Struct)
+	if !assert.True(t, ok, "Unexpected detail: %v", st.Details()[0]) {
+		return
+	}
+	metadata = make(map[string]string)
+	for key, value := range info.Fields["metadata"].GetStructValue().GetFields() {
+		metadata[key] = value.GetStringValue()
+	}
+	return info.Fields["reason"].GetStringValue(), info.Fields["domain"].GetStringValue(), metadata
+}
+
+// assertPaymentGrpcError checks code and message of the gRPC error and
+// reason of the payment error details it carries
+func assertPaymentGrpcError(t *testing.T, code codes.Code, message string, reason string, err *handler.GrpcError) {
+	if !assert.NotNil(t, err) {
+		return
+	}
+	assert.Equal(t, code, err.Status.Code())
+	assert.Equal(t, message, err.Status.Message())
+	actualReason, _, _ := paymentErrorDetails(t, err.Status)
+	assert.Equal(t, reason, actualReason)
+}
+
+func TestPaymentErrorGRPCStatus(t *testing.T) {
+	err := NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 2").
+		WithDetail("latest", "3").WithDetail("sent", "2")
+
+	st, ok := status.FromError(err)
+
+	assert.True(t, ok)
+	assert.Equal(t, handler.IncorrectNonce, st.Code())
+	assert.Equal(t, "incorrect payment channel nonce, latest: 3, sent: 2", st.Message())
+	reason, domain, metadata := paymentErrorDetails(t, st)
+	assert.Equal(t, "IncorrectNonce", reason)
+	assert.Equal(t, PaymentErrorDomain, domain)
+	assert.Equal(t, map[string]string{"latest": "3", "sent": "2"}, metadata)
+}
+
+func TestPaymentErrorGRPCStatusWithoutDetails(t *testing.T) {
+	st := NewPaymentError(LowRemainingCapacity, "remaining channel capacity 9 is below minimum 10").GRPCStatus()
+
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+	reason, _, metadata := paymentErrorDetails(t, st)
+	assert.Equal(t, "LowRemainingCapacity", reason)
+	assert.Empty(t, metadata)
+}
+
+func (suite *PaymentHandlerTestSuite) TestPaymentErrorDetailsAreReturnedByHandler() {
+	context := suite.grpcContext(func(md *metadata.MD) {})
+	paymentHandler := suite.paymentHandler
+	paymentHandler.service = &paymentChannelServiceMock{
+		err: NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 2").WithDetail("latest", "3"),
+	}
+
+	_, grpcErr := paymentHandler.Payment(context)
+
+	st, ok := status.FromError(grpcErr.Err())
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), handler.IncorrectNonce, st.Code())
+	reason, domain, metadata := paymentErrorDetails(suite.T(), st)
+	assert.Equal(suite.T(), "IncorrectNonce", reason)
+	assert.Equal(suite.T(), PaymentErrorDomain, domain)
+	assert.Equal(suite.T(), map[string]string{"latest": "3"}, metadata)
+}
+
+func TestPaymentErrorWithDetailDoesNotChangeOriginal(t *testing.T) {
+	err := NewPaymentError(Unauthenticated, "payment is not signed by channel signer")
+
+	withDetail := err.WithDetail("signer", "0x1")
+
+	assert.Nil(t, err.Details)
+	assert.Equal(t, map[string]string{"signer": "0x1"}, withDetail.Details)
+	assert.Equal(t, err.Message, withDetail.Message)
+}
@@ -0,0 +1,41 @@
+package escrow
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// ComputePaymentMAC returns HMAC-SHA256 of the payment message using shared
+// secret. Trusted clients put it into Payment.Signature instead of ECDSA
+// signature when validator is created with WithHMACAuthentication option.
+func ComputePaymentMAC(payment *Payment, secret []byte) (mac []byte, err error) {
+	message, err := getPaymentMessage(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hmac.New(sha256.New, secret)
+	hash.Write(message)
+	return hash.Sum(nil), nil
+}
+
+// verifyPaymentMAC checks payment signature as HMAC of the payment message.
+// Signer cannot be recovered from MAC, so channel payment signer is
+// returned when MAC is valid.
+func (validator *ChannelPaymentValidator) verifyPaymentMAC(payment *Payment, channel *PaymentChannelData) (signer *common.Address, err error) {
+	expected, err := ComputePaymentMAC(payment, validator.hmacSecret)
+	if err != nil {
+		log.WithField("payment", payment).WithError(err).Error("Cannot build payment message")
+		return nil, err
+	}
+	if !hmac.Equal(expected, payment.Signature) {
+		log.WithField("payment", payment).Warn("Payment MAC is not valid")
+		return nil, NewPaymentError(Unauthenticated, "payment MAC is not valid")
+	}
+
+	channelSigner := channel.PaymentSignerAddress()
+	return &channelSigner, nil
+}
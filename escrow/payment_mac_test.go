@@ -0,0 +1,70 @@
+package escrow
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testHMACSecret = []byte("shared secret of internal service")
+
+func hmacPayment(fixtures *testFixtures, secret []byte) *Payment {
+	payment := fixtures.Payment(42, 3, 12345)
+	payment.Signature, _ = ComputePaymentMAC(payment, secret)
+	return payment
+}
+
+func hmacValidator() *ChannelPaymentValidator {
+	validator := ChannelPaymentValidatorMock()
+	WithHMACAuthentication(testHMACSecret)(validator)
+	return validator
+}
+
+func TestHMACAuthenticationValidMAC(t *testing.T) {
+	fixtures := newTestFixtures("hmac")
+
+	err := hmacValidator().Validate(hmacPayment(fixtures, testHMACSecret), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestHMACAuthenticationTamperedAmount(t *testing.T) {
+	fixtures := newTestFixtures("hmac")
+	payment := hmacPayment(fixtures, testHMACSecret)
+	payment.Amount = big.NewInt(12346)
+
+	err := hmacValidator().Validate(payment, fixtures.Channel(42, 3, 12346, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment MAC is not valid"), err)
+}
+
+func TestHMACAuthenticationTamperedMAC(t *testing.T) {
+	fixtures := newTestFixtures("hmac")
+	payment := hmacPayment(fixtures, testHMACSecret)
+	payment.Signature[0] ^= 0xFF
+
+	err := hmacValidator().Validate(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment MAC is not valid"), err)
+}
+
+func TestHMACAuthenticationWrongSecret(t *testing.T) {
+	fixtures := newTestFixtures("hmac")
+
+	err := hmacValidator().Validate(hmacPayment(fixtures, []byte("another secret")), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment MAC is not valid"), err)
+}
+
+func TestHMACAuthenticationRejectsECDSASignature(t *testing.T) {
+	fixtures := newTestFixtures("hmac")
+
+	err := hmacValidator().Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment MAC is not valid"), err)
+}
+
+func TestHMACAuthenticationSelfTest(t *testing.T) {
+	assert.Nil(t, hmacValidator().SelfTest())
+}
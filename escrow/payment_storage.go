@@ -1,45 +1,659 @@
 package escrow
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 )
 
+const paymentStorageKeyPrefix = "/payment/storage"
+
+// ErrCorruptPayment is a cause of the errors returned by PaymentStorage when
+// stored payment cannot be deserialized, see CorruptPaymentError.
+var ErrCorruptPayment = errors.New("corrupt payment record")
+
+// CorruptPaymentError is returned by PaymentStorage when stored payment
+// cannot be deserialized. Cause method returns ErrCorruptPayment, so the
+// error can be checked using errors.Cause of github.com/pkg/errors, Is and
+// Unwrap methods allow checking it using errors.Is and errors.As of Go 1.13.
+type CorruptPaymentError struct {
+	// Key is a key of the corrupted record in the underlying AtomicStorage,
+	// it is empty if corrupted record cannot be found, for instance when it
+	// is fixed concurrently.
+	Key string
+	// Err is a deserialization error.
+	Err error
+}
+
+func (err *CorruptPaymentError) Error() string {
+	return fmt.Sprintf("%v, key: %q, error: %v", ErrCorruptPayment, err.Key, err.Err)
+}
+
+// Cause returns ErrCorruptPayment.
+func (err *CorruptPaymentError) Cause() error {
+	return ErrCorruptPayment
+}
+
+// Is returns true if target is ErrCorruptPayment.
+func (err *CorruptPaymentError) Is(target error) bool {
+	return target == ErrCorruptPayment
+}
+
+// Unwrap returns deserialization error.
+func (err *CorruptPaymentError) Unwrap() error {
+	return err.Err
+}
+
 // PaymentStorage is a storage for PaymentChannelData by
 // PaymentChannelKey based on TypedAtomicStorage implementation
 type PaymentStorage struct {
-	delegate TypedAtomicStorage
+	keyPrefix     string
+	delegate      TypedAtomicStorage
+	tombstones    TypedAtomicStorage
+	modifications TypedAtomicStorage
+	now           func() time.Time
+}
+
+// paymentTombstone keeps soft deleted payment and time of deletion
+type paymentTombstone struct {
+	Payment   *Payment
+	DeletedAt time.Time
+}
+
+// paymentModification keeps time of the last modification of the payment,
+// it is kept separately from payment to not change serialized payment
+// format.
+type paymentModification struct {
+	ChannelID    *big.Int
+	ChannelNonce *big.Int
+	ModifiedAt   time.Time
+}
+
+// PaymentQueryOption is an optional setting of the PaymentStorage.GetAll
+// query.
+type PaymentQueryOption func(query *paymentQuery)
+
+type paymentQuery struct {
+	includeDeleted bool
+}
+
+// IncludeDeleted returns option which makes GetAll to return soft deleted
+// payments in addition to the live ones.
+func IncludeDeleted() PaymentQueryOption {
+	return func(query *paymentQuery) {
+		query.includeDeleted = true
+	}
 }
 
 // NewPaymentStorage returns new instance of PaymentStorage
 // implementation
 func NewPaymentStorage(atomicStorage AtomicStorage) *PaymentStorage {
+	return newPaymentStorage(atomicStorage, paymentStorageKeyPrefix, serialize, deserialize)
+}
+
+// NewCompressedPaymentStorage returns new instance of PaymentStorage which
+// compresses payments using gzip before putting them into the atomicStorage.
+// Payments stored without compression are still read, so the storage can
+// be switched to compression without migration.
+func NewCompressedPaymentStorage(atomicStorage AtomicStorage) *PaymentStorage {
+	return newPaymentStorage(atomicStorage, paymentStorageKeyPrefix, serializeCompressed, deserializeCompressed)
+}
+
+// NewPaymentStorageWithNamespace returns new instance of PaymentStorage which
+// keys are prefixed by namespace. It allows keeping payments of different
+// environments, for instance staging and production, in the same backend.
+func NewPaymentStorageWithNamespace(atomicStorage AtomicStorage, namespace string) *PaymentStorage {
+	return newPaymentStorage(atomicStorage, "/"+namespace+paymentStorageKeyPrefix, serialize, deserialize)
+}
+
+func newPaymentStorage(atomicStorage AtomicStorage, keyPrefix string,
+	valueSerializer func(value interface{}) (string, error),
+	valueDeserializer func(slice string, value interface{}) error) *PaymentStorage {
 	return &PaymentStorage{
+		keyPrefix: keyPrefix,
 		delegate: &TypedAtomicStorageImpl{
 			atomicStorage: &PrefixedAtomicStorage{
 				delegate:  atomicStorage,
-				keyPrefix: "/payment/storage",
+				keyPrefix: keyPrefix,
 			},
-			keySerializer:     serialize,
-			valueSerializer:   serialize,
-			valueDeserializer: deserialize,
+			keySerializer:     serializeStringKey,
+			valueSerializer:   valueSerializer,
+			valueDeserializer: corruptPaymentDeserializer(valueDeserializer),
 			valueType:         reflect.TypeOf(Payment{}),
 		},
+		tombstones: &TypedAtomicStorageImpl{
+			atomicStorage: &PrefixedAtomicStorage{
+				delegate:  atomicStorage,
+				keyPrefix: keyPrefix + tombstoneKeySuffix,
+			},
+			keySerializer:     serializeStringKey,
+			valueSerializer:   valueSerializer,
+			valueDeserializer: corruptPaymentDeserializer(valueDeserializer),
+			valueType:         reflect.TypeOf(paymentTombstone{}),
+		},
+		modifications: &TypedAtomicStorageImpl{
+			atomicStorage: &PrefixedAtomicStorage{
+				delegate:  atomicStorage,
+				keyPrefix: keyPrefix + modificationKeySuffix,
+			},
+			keySerializer:     serializeStringKey,
+			valueSerializer:   serialize,
+			valueDeserializer: corruptPaymentDeserializer(deserialize),
+			valueType:         reflect.TypeOf(paymentModification{}),
+		},
+		now: time.Now,
+	}
+}
+
+// Suffixes which are added to the key prefix of the storage to get prefixes
+// of the tombstones and modifications keys.
+const (
+	tombstoneKeySuffix    = "-tombstone"
+	modificationKeySuffix = "-modified"
+)
+
+// corruptPaymentDeserializer returns deserializer which reports errors of
+// valueDeserializer as CorruptPaymentError. Deserializer doesn't know key
+// of the record, it is set by PaymentStorage, see withCorruptKey.
+func corruptPaymentDeserializer(valueDeserializer func(slice string, value interface{}) error) func(slice string, value interface{}) error {
+	return func(slice string, value interface{}) error {
+		if err := valueDeserializer(slice, value); err != nil {
+			return &CorruptPaymentError{Err: err}
+		}
+		return nil
+	}
+}
+
+// ChannelKeyPrefix returns prefix of the keys which are used to keep payments
+// of the channel in the underlying AtomicStorage. Storage created by
+// NewPaymentStorageWithNamespace adds "/<namespace>" before the prefix.
+func ChannelKeyPrefix(channelID *big.Int) string {
+	return paymentStorageKeyPrefix + "/" + channelKeyPrefix(channelID)
+}
+
+// channelKeyPrefix returns prefix of Payment.ID() values of the channel
+func channelKeyPrefix(channelID *big.Int) string {
+	return fmt.Sprintf("%v/", channelID)
+}
+
+// legacyPaymentKey returns key which was used to keep payment with the id
+// before payment keys became plain strings, such keys are gob encoded.
+func legacyPaymentKey(id string) (key string, err error) {
+	return serialize(id)
+}
+
+// paymentIDFromKey returns payment id kept by key, legacy is true if key is
+// gob encoded, see legacyPaymentKey.
+func paymentIDFromKey(key string) (id string, legacy bool, err error) {
+	if isPlainPaymentKey(key) {
+		return key, false, nil
+	}
+	if err = deserialize(key, &id); err != nil || !isPlainPaymentKey(id) {
+		return "", false, fmt.Errorf("incorrect payment key: %q", key)
+	}
+	return id, true, nil
+}
+
+func isPlainPaymentKey(key string) bool {
+	parts := strings.Split(key, "/")
+	if len(parts) != 2 {
+		return false
+	}
+	for _, part := range parts {
+		if _, ok := new(big.Int).SetString(part, 10); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// serializeStringKey keeps string keys as is, so keys can be scanned by
+// prefix.
+func serializeStringKey(key interface{}) (serialized string, err error) {
+	serialized, ok := key.(string)
+	if !ok {
+		return "", fmt.Errorf("key is not a string: %v", key)
+	}
+	return serialized, nil
+}
+
+// Get returns payment by channel id and nonce, ok is false if payment is not
+// found. Payment which is kept by legacy gob encoded key is returned as
+// well, see MigrateLegacyKeys.
+func (storage *PaymentStorage) Get(channelID, nonce *big.Int) (payment *Payment, ok bool, err error) {
+	id := (&Payment{ChannelID: channelID, ChannelNonce: nonce}).ID()
+	payment, ok, err = storage.getByKey(id)
+	if err != nil || ok {
+		return
+	}
+
+	legacyKey, err := legacyPaymentKey(id)
+	if err != nil {
+		return
+	}
+	return storage.getByKey(legacyKey)
+}
+
+func (storage *PaymentStorage) getByKey(key string) (payment *Payment, ok bool, err error) {
+	value, ok, err := storage.delegate.Get(key)
+	if corrupt, isCorrupt := err.(*CorruptPaymentError); isCorrupt {
+		corrupt.Key = storage.keyPrefix + "/" + key
+	}
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return value.(*Payment), true, nil
+}
+
+// withCorruptKey sets key of the CorruptPaymentError returned when records
+// of the typed storage with given key prefix are read. Deserializer doesn't
+// know the key, so it is found by reading the records one by one. This is
+// done only when corrupted record is met, so normal reads are not slowed
+// down. typedPrefix is a prefix of the typed storage keys in the underlying
+// AtomicStorage. Other errors are returned as is.
+func (storage *PaymentStorage) withCorruptKey(typed TypedAtomicStorage, typedPrefix string, prefix string, err error) error {
+	corrupt, isCorrupt := err.(*CorruptPaymentError)
+	if !isCorrupt || corrupt.Key != "" {
+		return err
 	}
+
+	keys, e := typed.GetKeysByPrefix(prefix)
+	if e != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, _, e = typed.Get(key); e != nil {
+			if _, isCorrupt = e.(*CorruptPaymentError); isCorrupt {
+				corrupt.Key = typedPrefix + "/" + key
+				break
+			}
+		}
+	}
+	return err
 }
 
-func (storage *PaymentStorage) GetAll() (states []*Payment, err error) {
+// MigrateLegacyKeys moves payments which are kept by gob encoded keys, as
+// daemon did before payment keys became plain strings, to the plain string
+// keys. Such payments are returned by Get, GetAll and removed by Delete, but
+// they are not visible to the methods which scan payments of the channel,
+// for instance IterateChannel, so migration should be run on start. If
+// payment is already kept by plain key then legacy copy is removed.
+func (storage *PaymentStorage) MigrateLegacyKeys() (migrated int, err error) {
+	keys, err := storage.delegate.GetKeysByPrefix("")
+	if err != nil {
+		return
+	}
+
+	for _, key := range keys {
+		id, legacy, e := paymentIDFromKey(key)
+		if e != nil {
+			return migrated, e
+		}
+		if !legacy {
+			continue
+		}
+
+		value, ok, e := storage.delegate.Get(key)
+		if e != nil {
+			return migrated, e
+		}
+		if !ok {
+			continue
+		}
+		if _, e = storage.delegate.PutIfAbsent(id, value); e != nil {
+			return migrated, e
+		}
+		if e = storage.delegate.Delete(key); e != nil {
+			return migrated, e
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// GetAll returns all payments from the storage, soft deleted payments are
+// returned only if IncludeDeleted option is passed.
+func (storage *PaymentStorage) GetAll(options ...PaymentQueryOption) (states []*Payment, err error) {
+	query := &paymentQuery{}
+	for _, option := range options {
+		option(query)
+	}
+
 	values, err := storage.delegate.GetAll()
+	if err != nil {
+		return nil, storage.withCorruptKey(storage.delegate, storage.keyPrefix, "", err)
+	}
+	states = values.([]*Payment)
+
+	if query.includeDeleted {
+		tombstones, err := storage.getTombstones()
+		if err != nil {
+			return nil, err
+		}
+		for _, tombstone := range tombstones {
+			states = append(states, tombstone.Payment)
+		}
+	}
+
+	return states, nil
+}
+
+func (storage *PaymentStorage) getTombstones() (tombstones []*paymentTombstone, err error) {
+	values, err := storage.tombstones.GetAll()
+	if err != nil {
+		return nil, storage.withCorruptKey(storage.tombstones, storage.keyPrefix+tombstoneKeySuffix, "", err)
+	}
+	return values.([]*paymentTombstone), nil
+}
+
+// SoftDelete removes payment from the storage but keeps its tombstone, so
+// payment is still returned by GetAll with IncludeDeleted option until it is
+// purged. Tombstone is written before payment is removed, so payment is
+// never lost.
+func (storage *PaymentStorage) SoftDelete(payment *Payment) (err error) {
+	err = storage.tombstones.Put(payment.ID(), &paymentTombstone{
+		Payment:   payment,
+		DeletedAt: storage.now(),
+	})
 	if err != nil {
 		return
 	}
+	return storage.Delete(payment)
+}
+
+// Purge removes tombstones of the payments which were soft deleted more
+// than retention ago.
+func (storage *PaymentStorage) Purge(retention time.Duration) (err error) {
+	tombstones, err := storage.getTombstones()
+	if err != nil {
+		return
+	}
+
+	deadline := storage.now().Add(-retention)
+	for _, tombstone := range tombstones {
+		if !tombstone.DeletedAt.Before(deadline) {
+			continue
+		}
+		if err = storage.tombstones.Delete(tombstone.Payment.ID()); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// GetAllWhere returns payments for which predicate returns true, other
+// payments are dropped while reading the storage.
+func (storage *PaymentStorage) GetAllWhere(predicate func(payment *Payment) bool) (payments []*Payment, err error) {
+	values, err := storage.delegate.GetAllWhere(func(value interface{}) bool {
+		return predicate(value.(*Payment))
+	})
+	if err != nil {
+		return nil, storage.withCorruptKey(storage.delegate, storage.keyPrefix, "", err)
+	}
 
 	return values.([]*Payment), nil
 }
 
+// IterateChannel calls fn for each payment of the channel. Iteration is
+// stopped on the first error returned by fn, the error is returned to the
+// caller.
+func (storage *PaymentStorage) IterateChannel(channelID *big.Int, fn func(payment *Payment) error) (err error) {
+	values, err := storage.delegate.GetByKeyPrefix(channelKeyPrefix(channelID))
+	if err != nil {
+		return storage.withCorruptKey(storage.delegate, storage.keyPrefix, channelKeyPrefix(channelID), err)
+	}
+
+	for _, payment := range values.([]*Payment) {
+		if err = fn(payment); err != nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+// LatestNonce returns the highest nonce of the channel payments kept in the
+// storage, ok is false if storage has no payments of the channel.
+func (storage *PaymentStorage) LatestNonce(channelID *big.Int) (nonce *big.Int, ok bool, err error) {
+	err = storage.IterateChannel(channelID, func(payment *Payment) error {
+		if nonce == nil || payment.ChannelNonce.Cmp(nonce) > 0 {
+			nonce = payment.ChannelNonce
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return nonce, nonce != nil, nil
+}
+
+// VerifyChannelHistory loads payments of the channel from the storage and
+// checks that they form consistent history: each payment belongs to the
+// channel, nonces are unique and amount doesn't decrease when nonce grows.
+// First inconsistency found is returned as error.
+func VerifyChannelHistory(channelID *big.Int, storage *PaymentStorage) (err error) {
+	payments := []*Payment{}
+	err = storage.IterateChannel(channelID, func(payment *Payment) error {
+		payments = append(payments, payment)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].ChannelNonce.Cmp(payments[j].ChannelNonce) < 0
+	})
+
+	var previous *Payment
+	for _, payment := range payments {
+		if payment.ChannelID.Cmp(channelID) != 0 {
+			return fmt.Errorf("payment of channel %v is found in history of channel %v", payment.ChannelID, channelID)
+		}
+		if previous != nil {
+			if payment.ChannelNonce.Cmp(previous.ChannelNonce) == 0 {
+				return fmt.Errorf("duplicate payment nonce %v in history of channel %v", payment.ChannelNonce, channelID)
+			}
+			if payment.Amount.Cmp(previous.Amount) < 0 {
+				return fmt.Errorf("payment amount decreases in history of channel %v: amount %v at nonce %v is less than amount %v at nonce %v",
+					channelID, payment.Amount, payment.ChannelNonce, previous.Amount, previous.ChannelNonce)
+			}
+		}
+		previous = payment
+	}
+
+	return nil
+}
+
+// DistinctChannelIDs returns ids of the channels which have payments in the
+// storage. Ids are derived from storage keys, so payments are not loaded.
+func (storage *PaymentStorage) DistinctChannelIDs() (channelIDs []*big.Int, err error) {
+	keys, err := storage.delegate.GetKeysByPrefix("")
+	if err != nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	channelIDs = make([]*big.Int, 0)
+	for _, key := range keys {
+		id, _, err := paymentIDFromKey(key)
+		if err != nil {
+			return nil, err
+		}
+		channelIDString := strings.SplitN(id, "/", 2)[0]
+		if seen[channelIDString] {
+			continue
+		}
+		channelID, _ := new(big.Int).SetString(channelIDString, 10)
+		seen[channelIDString] = true
+		channelIDs = append(channelIDs, channelID)
+	}
+
+	return channelIDs, nil
+}
+
+// CompactChannel removes all payments of the channel except the one with the
+// highest amount, which is the only payment required for settlement. The kept
+// payment is not modified, so if compaction fails in the middle storage is
+// still consistent and compaction can be repeated.
+func (storage *PaymentStorage) CompactChannel(channelID *big.Int) (err error) {
+	var latest *Payment
+	payments := []*Payment{}
+	err = storage.IterateChannel(channelID, func(payment *Payment) error {
+		payments = append(payments, payment)
+		if latest == nil || payment.Amount.Cmp(latest.Amount) > 0 {
+			latest = payment
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for _, payment := range payments {
+		if payment == latest {
+			continue
+		}
+		if err = storage.Delete(payment); err != nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+// NotifySettled is called when the channel is settled at the nonce. It
+// removes payments of the channel with nonce at or below the settled one as
+// they cannot be claimed anymore, payments with greater nonce are kept.
+func (storage *PaymentStorage) NotifySettled(channelID, nonce *big.Int) (err error) {
+	settled := []*Payment{}
+	err = storage.IterateChannel(channelID, func(payment *Payment) error {
+		if payment.ChannelNonce.Cmp(nonce) <= 0 {
+			settled = append(settled, payment)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for _, payment := range settled {
+		if err = storage.Delete(payment); err != nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+// GetModifiedSince returns payments which were put into the storage at or
+// after since. Payments which were put before modification time tracking
+// was introduced are not returned, use GetAll to get them.
+func (storage *PaymentStorage) GetModifiedSince(since time.Time) (payments []*Payment, err error) {
+	values, err := storage.modifications.GetAllWhere(func(value interface{}) bool {
+		return !value.(*paymentModification).ModifiedAt.Before(since)
+	})
+	if err != nil {
+		return nil, storage.withCorruptKey(storage.modifications, storage.keyPrefix+modificationKeySuffix, "", err)
+	}
+
+	payments = []*Payment{}
+	for _, modification := range values.([]*paymentModification) {
+		payment, ok, err := storage.Get(modification.ChannelID, modification.ChannelNonce)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			payments = append(payments, payment)
+		}
+	}
+	return payments, nil
+}
+
+// Put puts payment into the storage and records time of the modification.
+// Payment is put first, so modification time is never recorded for the
+// payment which is not in the storage.
 func (storage *PaymentStorage) Put(payment *Payment) (err error) {
-	return storage.delegate.Put(payment.ID(), payment)
+	if err = storage.delegate.Put(payment.ID(), payment); err != nil {
+		return
+	}
+	return storage.putModification(payment)
+}
+
+func (storage *PaymentStorage) putModification(payment *Payment) error {
+	return storage.modifications.Put(payment.ID(), &paymentModification{
+		ChannelID:    payment.ChannelID,
+		ChannelNonce: payment.ChannelNonce,
+		ModifiedAt:   storage.now(),
+	})
+}
+
+// PutIdempotent puts payment into the storage unless identical payment is
+// already stored. Payments are compared by hash of their serialized content.
+// stored is false if payment is already in the storage, in this case neither
+// payment nor its modification time is changed, so retries of the same
+// payment don't look like modifications.
+func (storage *PaymentStorage) PutIdempotent(payment *Payment) (stored bool, err error) {
+	hash, err := paymentContentHash(payment)
+	if err != nil {
+		return
+	}
+
+	for {
+		existing, ok, e := storage.Get(payment.ChannelID, payment.ChannelNonce)
+		if e != nil {
+			return false, e
+		}
+		if ok {
+			existingHash, e := paymentContentHash(existing)
+			if e != nil {
+				return false, e
+			}
+			if bytes.Equal(hash, existingHash) {
+				return false, nil
+			}
+			return true, storage.Put(payment)
+		}
+
+		ok, e = storage.delegate.PutIfAbsent(payment.ID(), payment)
+		if e != nil {
+			return false, e
+		}
+		if ok {
+			return true, storage.putModification(payment)
+		}
+	}
 }
 
+// paymentContentHash returns hash of the serialized payment.
+func paymentContentHash(payment *Payment) ([]byte, error) {
+	serialized, err := serialize(payment)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(serialized))
+	return hash[:], nil
+}
+
+// Delete removes payment and its modification time from the storage. Copy
+// of the payment kept by legacy gob encoded key is removed as well.
 func (storage *PaymentStorage) Delete(payment *Payment) (err error) {
-	return storage.delegate.Delete(payment.ID())
+	legacyKey, err := legacyPaymentKey(payment.ID())
+	if err != nil {
+		return
+	}
+	if err = storage.delegate.Delete(legacyKey); err != nil {
+		return
+	}
+	if err = storage.delegate.Delete(payment.ID()); err != nil {
+		return
+	}
+	return storage.modifications.Delete(payment.ID())
 }
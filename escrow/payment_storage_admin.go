@@ -0,0 +1,138 @@
+package escrow
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sort"
+
+	"github.com/singnet/snet-daemon/blockchain"
+	log "github.com/sirupsen/logrus"
+)
+
+// paymentView is a JSON representation of the payment returned by
+// PaymentStorageAdminHandler. Numbers are encoded as decimal strings to not
+// lose precision in JSON clients.
+type paymentView struct {
+	MpeContractAddress string `json:"mpeContractAddress"`
+	ChannelID          string `json:"channelId"`
+	ChannelNonce       string `json:"channelNonce"`
+	Amount             string `json:"amount"`
+	Signature          string `json:"signature"`
+}
+
+// paymentCountsView is a JSON representation of the payment storage counts
+type paymentCountsView struct {
+	Payments int `json:"payments"`
+	Channels int `json:"channels"`
+}
+
+func newPaymentView(payment *Payment) paymentView {
+	return paymentView{
+		MpeContractAddress: blockchain.AddressToHex(&payment.MpeContractAddress),
+		ChannelID:          payment.ChannelID.String(),
+		ChannelNonce:       payment.ChannelNonce.String(),
+		Amount:             payment.Amount.String(),
+		Signature:          blockchain.BytesToBase64(payment.Signature),
+	}
+}
+
+// PaymentStorageAdminHandler exposes PaymentStorage content via read-only
+// HTTP API. It handles the following GET requests:
+//   - /payments returns all payments;
+//   - /payments/channel?id=<channel id> returns payments of the channel;
+//   - /payments/count returns number of payments and channels.
+//
+// Handler doesn't provide any write operation intentionally.
+type PaymentStorageAdminHandler struct {
+	storage *PaymentStorage
+	mux     *http.ServeMux
+}
+
+// NewPaymentStorageAdminHandler returns new instance of
+// PaymentStorageAdminHandler. Use http.StripPrefix to mount it under custom
+// path.
+func NewPaymentStorageAdminHandler(storage *PaymentStorage) *PaymentStorageAdminHandler {
+	handler := &PaymentStorageAdminHandler{
+		storage: storage,
+		mux:     http.NewServeMux(),
+	}
+	handler.mux.HandleFunc("/payments", handler.listPayments)
+	handler.mux.HandleFunc("/payments/channel", handler.getChannelPayments)
+	handler.mux.HandleFunc("/payments/count", handler.countPayments)
+	return handler
+}
+
+// ServeHTTP implements http.Handler
+func (handler *PaymentStorageAdminHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "only GET requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	handler.mux.ServeHTTP(writer, request)
+}
+
+func (handler *PaymentStorageAdminHandler) listPayments(writer http.ResponseWriter, request *http.Request) {
+	payments, err := handler.storage.GetAll()
+	if err != nil {
+		log.WithError(err).Error("Cannot get payments from storage")
+		http.Error(writer, "cannot get payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writePayments(writer, payments)
+}
+
+func (handler *PaymentStorageAdminHandler) getChannelPayments(writer http.ResponseWriter, request *http.Request) {
+	channelID, ok := new(big.Int).SetString(request.URL.Query().Get("id"), 10)
+	if !ok {
+		http.Error(writer, "incorrect channel id: \""+request.URL.Query().Get("id")+"\"", http.StatusBadRequest)
+		return
+	}
+
+	payments := []*Payment{}
+	err := handler.storage.IterateChannel(channelID, func(payment *Payment) error {
+		payments = append(payments, payment)
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).WithField("channelID", channelID).Error("Cannot get channel payments from storage")
+		http.Error(writer, "cannot get channel payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writePayments(writer, payments)
+}
+
+func (handler *PaymentStorageAdminHandler) countPayments(writer http.ResponseWriter, request *http.Request) {
+	payments, err := handler.storage.GetAll()
+	if err != nil {
+		log.WithError(err).Error("Cannot get payments from storage")
+		http.Error(writer, "cannot get payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	channelIDs, err := handler.storage.DistinctChannelIDs()
+	if err != nil {
+		log.WithError(err).Error("Cannot get channel ids from storage")
+		http.Error(writer, "cannot get channel ids: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writer, paymentCountsView{Payments: len(payments), Channels: len(channelIDs)})
+}
+
+// writePayments writes payments sorted by id to make output stable
+func writePayments(writer http.ResponseWriter, payments []*Payment) {
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].ID() < payments[j].ID()
+	})
+	views := make([]paymentView, 0, len(payments))
+	for _, payment := range payments {
+		views = append(views, newPaymentView(payment))
+	}
+	writeJSON(writer, views)
+}
+
+func writeJSON(writer http.ResponseWriter, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		log.WithError(err).Error("Cannot write JSON response")
+	}
+}
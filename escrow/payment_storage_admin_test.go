@@ -0,0 +1,106 @@
+package escrow
+
+import (
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/singnet/snet-daemon/blockchain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PaymentStorageAdminSuite struct {
+	suite.Suite
+
+	storage *PaymentStorage
+	handler *PaymentStorageAdminHandler
+}
+
+func TestPaymentStorageAdminSuite(t *testing.T) {
+	suite.Run(t, new(PaymentStorageAdminSuite))
+}
+
+func (suite *PaymentStorageAdminSuite) SetupTest() {
+	suite.storage = NewPaymentStorage(NewMemStorage())
+	suite.handler = NewPaymentStorageAdminHandler(suite.storage)
+
+	suite.putPayment(42, 1, 100)
+	suite.putPayment(42, 2, 200)
+	suite.putPayment(43, 0, 300)
+}
+
+func (suite *PaymentStorageAdminSuite) payment(channelID, nonce, amount int64) *Payment {
+	return &Payment{
+		MpeContractAddress: blockchain.HexToAddress("0xf25186b5081ff5ce73482ad761db0eb0d25abfbf"),
+		ChannelID:          big.NewInt(channelID),
+		ChannelNonce:       big.NewInt(nonce),
+		Amount:             big.NewInt(amount),
+		Signature:          []byte{0x1, 0x2, 0xFE, 0xFF},
+	}
+}
+
+func (suite *PaymentStorageAdminSuite) putPayment(channelID, nonce, amount int64) {
+	err := suite.storage.Put(suite.payment(channelID, nonce, amount))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *PaymentStorageAdminSuite) get(method, url string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	suite.handler.ServeHTTP(recorder, httptest.NewRequest(method, url, nil))
+	return recorder
+}
+
+func paymentJSON(channelID, nonce, amount string) string {
+	address := blockchain.HexToAddress("0xf25186b5081ff5ce73482ad761db0eb0d25abfbf")
+	return `{"mpeContractAddress":"` + blockchain.AddressToHex(&address) + `","channelId":"` + channelID +
+		`","channelNonce":"` + nonce + `","amount":"` + amount + `","signature":"AQL+/w=="}`
+}
+
+func (suite *PaymentStorageAdminSuite) TestListPayments() {
+	response := suite.get(http.MethodGet, "/payments")
+
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "application/json", response.Header().Get("Content-Type"))
+	assert.JSONEq(suite.T(), "["+paymentJSON("42", "1", "100")+","+
+		paymentJSON("42", "2", "200")+","+paymentJSON("43", "0", "300")+"]", response.Body.String())
+}
+
+func (suite *PaymentStorageAdminSuite) TestGetChannelPayments() {
+	response := suite.get(http.MethodGet, "/payments/channel?id=42")
+
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.JSONEq(suite.T(), "["+paymentJSON("42", "1", "100")+","+
+		paymentJSON("42", "2", "200")+"]", response.Body.String())
+}
+
+func (suite *PaymentStorageAdminSuite) TestGetChannelPaymentsUnknownChannel() {
+	response := suite.get(http.MethodGet, "/payments/channel?id=44")
+
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.JSONEq(suite.T(), "[]", response.Body.String())
+}
+
+func (suite *PaymentStorageAdminSuite) TestGetChannelPaymentsIncorrectChannelID() {
+	response := suite.get(http.MethodGet, "/payments/channel?id=abc")
+
+	assert.Equal(suite.T(), http.StatusBadRequest, response.Code)
+	assert.Equal(suite.T(), "incorrect channel id: \"abc\"\n", response.Body.String())
+}
+
+func (suite *PaymentStorageAdminSuite) TestCountPayments() {
+	response := suite.get(http.MethodGet, "/payments/count")
+
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.JSONEq(suite.T(), `{"payments":3,"channels":2}`, response.Body.String())
+}
+
+func (suite *PaymentStorageAdminSuite) TestWritesAreNotAllowed() {
+	response := suite.get(http.MethodDelete, "/payments")
+
+	assert.Equal(suite.T(), http.StatusMethodNotAllowed, response.Code)
+	payments, err := suite.storage.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), 3, len(payments))
+}
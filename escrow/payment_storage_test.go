@@ -0,0 +1,587 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PaymentStorageSuite struct {
+	suite.Suite
+
+	memoryStorage *memoryStorage
+	storage       *PaymentStorage
+}
+
+func (suite *PaymentStorageSuite) SetupSuite() {
+	suite.memoryStorage = NewMemStorage()
+	suite.storage = NewPaymentStorage(suite.memoryStorage)
+}
+
+func (suite *PaymentStorageSuite) SetupTest() {
+	suite.memoryStorage.Clear()
+}
+
+func TestPaymentStorageSuite(t *testing.T) {
+	suite.Run(t, new(PaymentStorageSuite))
+}
+
+func (suite *PaymentStorageSuite) payment(channelID, nonce, amount int64) *Payment {
+	payment := validTestPayment()
+	payment.ChannelID = big.NewInt(channelID)
+	payment.ChannelNonce = big.NewInt(nonce)
+	payment.Amount = big.NewInt(amount)
+	payment.Signature = []byte{0x1, 0x2, 0xFE, 0xFF}
+	return payment
+}
+
+func (suite *PaymentStorageSuite) putPayments(payments ...*Payment) {
+	for _, payment := range payments {
+		err := suite.storage.Put(payment)
+		assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	}
+}
+
+func sortPayments(payments []*Payment) []*Payment {
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].ID() < payments[j].ID()
+	})
+	return payments
+}
+
+func (suite *PaymentStorageSuite) TestChannelKeyPrefix() {
+	suite.putPayments(suite.payment(42, 3, 12345))
+
+	assert.Equal(suite.T(), "/payment/storage/42/", ChannelKeyPrefix(big.NewInt(42)))
+	values, err := suite.memoryStorage.GetByKeyPrefix(ChannelKeyPrefix(big.NewInt(42)))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), 1, len(values))
+}
+
+func (suite *PaymentStorageSuite) TestIterateChannel() {
+	suite.putPayments(
+		suite.payment(4, 1, 100),
+		suite.payment(42, 1, 200),
+		suite.payment(42, 2, 300),
+		suite.payment(420, 1, 400),
+	)
+
+	payments := []*Payment{}
+	err := suite.storage.IterateChannel(big.NewInt(42), func(payment *Payment) error {
+		payments = append(payments, payment)
+		return nil
+	})
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{suite.payment(42, 1, 200), suite.payment(42, 2, 300)}, sortPayments(payments))
+}
+
+func (suite *PaymentStorageSuite) TestIterateChannelStopsOnError() {
+	suite.putPayments(suite.payment(42, 1, 200), suite.payment(42, 2, 300))
+
+	calls := 0
+	err := suite.storage.IterateChannel(big.NewInt(42), func(payment *Payment) error {
+		calls++
+		return errors.New("stop")
+	})
+
+	assert.Equal(suite.T(), errors.New("stop"), err)
+	assert.Equal(suite.T(), 1, calls)
+}
+
+func (suite *PaymentStorageSuite) TestKeysArePlainStrings() {
+	suite.putPayments(suite.payment(42, 3, 12345))
+
+	_, ok, err := suite.memoryStorage.Get("/payment/storage/42/3")
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.True(suite.T(), ok)
+	assert.False(suite.T(), strings.HasPrefix(ChannelKeyPrefix(big.NewInt(4)), ChannelKeyPrefix(big.NewInt(42))))
+}
+
+// putLegacyPayment puts payment the way daemon did before payment keys
+// became plain strings: key is gob encoded.
+func (suite *PaymentStorageSuite) putLegacyPayment(payment *Payment) {
+	key, err := serialize(payment.ID())
+	assert.Nil(suite.T(), err)
+	value, err := serialize(payment)
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), suite.memoryStorage.Put(paymentStorageKeyPrefix+"/"+key, value))
+}
+
+func (suite *PaymentStorageSuite) TestGetLegacyKeyedPayment() {
+	payment := suite.payment(42, 3, 12345)
+	suite.putLegacyPayment(payment)
+
+	stored, ok, err := suite.storage.Get(big.NewInt(42), big.NewInt(3))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), payment, stored)
+}
+
+func (suite *PaymentStorageSuite) TestDeleteLegacyKeyedPayment() {
+	payment := suite.payment(42, 3, 12345)
+	suite.putLegacyPayment(payment)
+
+	err := suite.storage.Delete(payment)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	_, ok, err := suite.storage.Get(big.NewInt(42), big.NewInt(3))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.False(suite.T(), ok)
+	payments, err := suite.storage.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), payments)
+}
+
+func (suite *PaymentStorageSuite) TestDistinctChannelIDsWithLegacyKeys() {
+	suite.putLegacyPayment(suite.payment(42, 3, 12345))
+	suite.putPayments(suite.payment(7, 1, 100))
+
+	channelIDs, err := suite.storage.DistinctChannelIDs()
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.ElementsMatch(suite.T(), []*big.Int{big.NewInt(42), big.NewInt(7)}, channelIDs)
+}
+
+func (suite *PaymentStorageSuite) TestMigrateLegacyKeys() {
+	legacy := suite.payment(42, 3, 12345)
+	suite.putLegacyPayment(legacy)
+	suite.putLegacyPayment(suite.payment(42, 4, 200))
+	suite.putPayments(suite.payment(42, 4, 300), suite.payment(7, 1, 100))
+
+	migrated, err := suite.storage.MigrateLegacyKeys()
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), 2, migrated)
+	channel := []*Payment{}
+	suite.storage.IterateChannel(big.NewInt(42), func(payment *Payment) error {
+		channel = append(channel, payment)
+		return nil
+	})
+	assert.ElementsMatch(suite.T(), []*Payment{legacy, suite.payment(42, 4, 300)}, channel)
+	keys, err := suite.memoryStorage.GetKeysByPrefix(paymentStorageKeyPrefix + "/")
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.ElementsMatch(suite.T(), []string{"/payment/storage/42/3", "/payment/storage/42/4", "/payment/storage/7/1"}, keys)
+
+	migrated, err = suite.storage.MigrateLegacyKeys()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), 0, migrated)
+}
+
+func (suite *PaymentStorageSuite) TestGetCorruptPayment() {
+	suite.memoryStorage.Put("/payment/storage/42/3", "\x01\x02 corrupt payment")
+
+	payment, ok, err := suite.storage.Get(big.NewInt(42), big.NewInt(3))
+
+	assert.Nil(suite.T(), payment)
+	assert.False(suite.T(), ok)
+	corrupt, isCorrupt := err.(*CorruptPaymentError)
+	if assert.True(suite.T(), isCorrupt, "Unexpected error: %v", err) {
+		assert.Equal(suite.T(), ErrCorruptPayment, corrupt.Cause())
+		assert.True(suite.T(), corrupt.Is(ErrCorruptPayment))
+		assert.False(suite.T(), corrupt.Is(errors.New("corrupt payment record")))
+		assert.Equal(suite.T(), "/payment/storage/42/3", corrupt.Key)
+		assert.NotNil(suite.T(), corrupt.Err)
+		assert.Equal(suite.T(), corrupt.Err, corrupt.Unwrap())
+		assert.Contains(suite.T(), err.Error(), "corrupt payment record, key: \"/payment/storage/42/3\"")
+	}
+}
+
+func (suite *PaymentStorageSuite) TestGetAllCorruptPayment() {
+	suite.putPayments(suite.payment(42, 2, 12300))
+	suite.memoryStorage.Put("/payment/storage/42/3", "\x01\x02 corrupt payment")
+
+	_, err := suite.storage.GetAll()
+
+	suite.assertCorruptKey("/payment/storage/42/3", err)
+}
+
+// assertCorruptKey checks that err is CorruptPaymentError with given key
+func (suite *PaymentStorageSuite) assertCorruptKey(key string, err error) {
+	corrupt, isCorrupt := err.(*CorruptPaymentError)
+	if assert.True(suite.T(), isCorrupt, "Unexpected error: %v", err) {
+		assert.Equal(suite.T(), key, corrupt.Key)
+	}
+}
+
+func (suite *PaymentStorageSuite) TestGetAllWhereCorruptPayment() {
+	suite.putPayments(suite.payment(42, 2, 12300))
+	suite.memoryStorage.Put("/payment/storage/42/3", "\x01\x02 corrupt payment")
+
+	_, err := suite.storage.GetAllWhere(func(payment *Payment) bool { return true })
+
+	suite.assertCorruptKey("/payment/storage/42/3", err)
+}
+
+func (suite *PaymentStorageSuite) TestIterateChannelCorruptPayment() {
+	suite.putPayments(suite.payment(42, 2, 12300), suite.payment(43, 1, 100))
+	suite.memoryStorage.Put("/payment/storage/42/3", "\x01\x02 corrupt payment")
+
+	err := suite.storage.IterateChannel(big.NewInt(42), func(payment *Payment) error { return nil })
+
+	suite.assertCorruptKey("/payment/storage/42/3", err)
+}
+
+func (suite *PaymentStorageSuite) TestGetAllIncludeDeletedCorruptTombstone() {
+	suite.memoryStorage.Put("/payment/storage-tombstone/42/3", "\x01\x02 corrupt tombstone")
+
+	_, err := suite.storage.GetAll(IncludeDeleted())
+
+	suite.assertCorruptKey("/payment/storage-tombstone/42/3", err)
+}
+
+func (suite *PaymentStorageSuite) TestGetModifiedSinceCorruptModification() {
+	suite.memoryStorage.Put("/payment/storage-modified/42/3", "\x01\x02 corrupt modification")
+
+	_, err := suite.storage.GetModifiedSince(time.Unix(0, 0))
+
+	suite.assertCorruptKey("/payment/storage-modified/42/3", err)
+}
+
+func (suite *PaymentStorageSuite) TestCompactChannel() {
+	suite.putPayments(
+		suite.payment(42, 1, 200),
+		suite.payment(42, 2, 500),
+		suite.payment(42, 3, 300),
+		suite.payment(43, 1, 100),
+		suite.payment(43, 2, 50),
+	)
+
+	err := suite.storage.CompactChannel(big.NewInt(42))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, err := suite.storage.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{
+		suite.payment(42, 2, 500),
+		suite.payment(43, 1, 100),
+		suite.payment(43, 2, 50),
+	}, sortPayments(payments))
+}
+
+func (suite *PaymentStorageSuite) TestCompactChannelWithoutPayments() {
+	suite.putPayments(suite.payment(43, 1, 100))
+
+	err := suite.storage.CompactChannel(big.NewInt(42))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, _ := suite.storage.GetAll()
+	assert.Equal(suite.T(), []*Payment{suite.payment(43, 1, 100)}, payments)
+}
+
+func (suite *PaymentStorageSuite) TestNotifySettled() {
+	suite.putPayments(
+		suite.payment(42, 1, 200),
+		suite.payment(42, 2, 300),
+		suite.payment(42, 3, 400),
+		suite.payment(43, 1, 100),
+	)
+
+	err := suite.storage.NotifySettled(big.NewInt(42), big.NewInt(2))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, err := suite.storage.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{
+		suite.payment(42, 3, 400),
+		suite.payment(43, 1, 100),
+	}, sortPayments(payments))
+}
+
+func (suite *PaymentStorageSuite) TestNotifySettledRemovesModificationTime() {
+	suite.putPayments(suite.payment(42, 1, 200))
+
+	err := suite.storage.NotifySettled(big.NewInt(42), big.NewInt(1))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, _ := suite.storage.GetModifiedSince(time.Time{})
+	assert.Equal(suite.T(), []*Payment{}, payments)
+	keys, _ := suite.memoryStorage.GetByKeyPrefix("")
+	assert.Empty(suite.T(), keys)
+}
+
+func (suite *PaymentStorageSuite) TestNotifySettledWithoutPayments() {
+	suite.putPayments(suite.payment(43, 1, 100))
+
+	err := suite.storage.NotifySettled(big.NewInt(42), big.NewInt(5))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, _ := suite.storage.GetAll()
+	assert.Equal(suite.T(), []*Payment{suite.payment(43, 1, 100)}, payments)
+}
+
+func (suite *PaymentStorageSuite) TestGetAllWhere() {
+	suite.putPayments(
+		suite.payment(41, 1, 100),
+		suite.payment(42, 1, 200),
+		suite.payment(42, 2, 300),
+		suite.payment(43, 1, 50),
+	)
+
+	payments, err := suite.storage.GetAllWhere(func(payment *Payment) bool {
+		return payment.Amount.Cmp(big.NewInt(200)) >= 0
+	})
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{suite.payment(42, 1, 200), suite.payment(42, 2, 300)}, sortPayments(payments))
+}
+
+func (suite *PaymentStorageSuite) TestGetAllWhereNothingMatches() {
+	suite.putPayments(suite.payment(42, 1, 200))
+
+	payments, err := suite.storage.GetAllWhere(func(payment *Payment) bool {
+		return false
+	})
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{}, payments)
+}
+
+func (suite *PaymentStorageSuite) TestNamespacesAreIsolated() {
+	staging := NewPaymentStorageWithNamespace(suite.memoryStorage, "staging")
+	production := NewPaymentStorageWithNamespace(suite.memoryStorage, "production")
+	stagingPayment := suite.payment(42, 3, 100)
+	productionPayment := suite.payment(42, 3, 200)
+
+	assert.Nil(suite.T(), staging.Put(stagingPayment))
+	assert.Nil(suite.T(), production.Put(productionPayment))
+
+	stagingPayments, err := staging.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{stagingPayment}, stagingPayments)
+	productionPayments, err := production.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{productionPayment}, productionPayments)
+	defaultPayments, err := suite.storage.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), defaultPayments)
+}
+
+func (suite *PaymentStorageSuite) TestLatestNonce() {
+	suite.putPayments(suite.payment(42, 1, 200), suite.payment(42, 3, 300), suite.payment(43, 5, 100))
+
+	nonce, ok, err := suite.storage.LatestNonce(big.NewInt(42))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), big.NewInt(3), nonce)
+}
+
+func (suite *PaymentStorageSuite) TestLatestNonceNoPayments() {
+	nonce, ok, err := suite.storage.LatestNonce(big.NewInt(42))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.False(suite.T(), ok)
+	assert.Nil(suite.T(), nonce)
+}
+
+func (suite *PaymentStorageSuite) storageWithClock(now *time.Time) *PaymentStorage {
+	storage := NewPaymentStorage(suite.memoryStorage)
+	storage.now = func() time.Time { return *now }
+	return storage
+}
+
+func (suite *PaymentStorageSuite) TestSoftDelete() {
+	deleted := suite.payment(42, 1, 200)
+	live := suite.payment(42, 2, 300)
+	suite.putPayments(deleted, live)
+
+	err := suite.storage.SoftDelete(deleted)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, err := suite.storage.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{live}, payments)
+	payments, err = suite.storage.GetAll(IncludeDeleted())
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{deleted, live}, sortPayments(payments))
+}
+
+func (suite *PaymentStorageSuite) TestPurge() {
+	now := time.Unix(1000000, 0)
+	storage := suite.storageWithClock(&now)
+	old := suite.payment(42, 1, 200)
+	recent := suite.payment(42, 2, 300)
+	suite.putPayments(old, recent)
+	assert.Nil(suite.T(), storage.SoftDelete(old))
+	now = now.Add(time.Hour)
+	assert.Nil(suite.T(), storage.SoftDelete(recent))
+	now = now.Add(time.Minute)
+
+	err := storage.Purge(30 * time.Minute)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, err := storage.GetAll(IncludeDeleted())
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{recent}, payments)
+}
+
+func (suite *PaymentStorageSuite) TestPurgeKeepsLivePayments() {
+	live := suite.payment(42, 1, 200)
+	suite.putPayments(live)
+
+	err := suite.storage.Purge(0)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, err := suite.storage.GetAll(IncludeDeleted())
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{live}, payments)
+}
+
+func (suite *PaymentStorageSuite) TestVerifyChannelHistory() {
+	suite.putPayments(
+		suite.payment(42, 3, 300), suite.payment(42, 1, 100), suite.payment(42, 2, 100),
+		suite.payment(43, 1, 500))
+
+	err := VerifyChannelHistory(big.NewInt(42), suite.storage)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *PaymentStorageSuite) TestVerifyChannelHistoryDecreasingAmount() {
+	suite.putPayments(suite.payment(42, 1, 100), suite.payment(42, 2, 300), suite.payment(42, 3, 200))
+
+	err := VerifyChannelHistory(big.NewInt(42), suite.storage)
+
+	assert.Equal(suite.T(), errors.New("payment amount decreases in history of channel 42: amount 200 at nonce 3 is less than amount 300 at nonce 2"), err)
+}
+
+func (suite *PaymentStorageSuite) TestVerifyChannelHistoryNoPayments() {
+	err := VerifyChannelHistory(big.NewInt(42), suite.storage)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *PaymentStorageSuite) TestDistinctChannelIDs() {
+	suite.putPayments(
+		suite.payment(42, 1, 200), suite.payment(42, 3, 300),
+		suite.payment(43, 5, 100), suite.payment(44, 0, 100), suite.payment(44, 1, 200))
+
+	channelIDs, err := suite.storage.DistinctChannelIDs()
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	sort.Slice(channelIDs, func(i, j int) bool { return channelIDs[i].Cmp(channelIDs[j]) < 0 })
+	assert.Equal(suite.T(), []*big.Int{big.NewInt(42), big.NewInt(43), big.NewInt(44)}, channelIDs)
+}
+
+func (suite *PaymentStorageSuite) TestDistinctChannelIDsSkipsDeletedPayments() {
+	deleted := suite.payment(43, 5, 100)
+	suite.putPayments(suite.payment(42, 1, 200), deleted)
+	assert.Nil(suite.T(), suite.storage.SoftDelete(deleted))
+
+	channelIDs, err := suite.storage.DistinctChannelIDs()
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*big.Int{big.NewInt(42)}, channelIDs)
+}
+
+func (suite *PaymentStorageSuite) TestDistinctChannelIDsNoPayments() {
+	channelIDs, err := suite.storage.DistinctChannelIDs()
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), channelIDs)
+}
+
+func (suite *PaymentStorageSuite) TestGetModifiedSince() {
+	now := time.Unix(1000000, 0)
+	storage := suite.storageWithClock(&now)
+	old := suite.payment(42, 1, 200)
+	atCutoff := suite.payment(42, 2, 300)
+	recent := suite.payment(43, 1, 100)
+	assert.Nil(suite.T(), storage.Put(old))
+	now = now.Add(time.Minute)
+	assert.Nil(suite.T(), storage.Put(atCutoff))
+	now = now.Add(time.Minute)
+	assert.Nil(suite.T(), storage.Put(recent))
+
+	payments, err := storage.GetModifiedSince(time.Unix(1000000, 0).Add(time.Minute))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{atCutoff, recent}, sortPayments(payments))
+}
+
+func (suite *PaymentStorageSuite) TestGetModifiedSinceUpdatedPayment() {
+	now := time.Unix(1000000, 0)
+	storage := suite.storageWithClock(&now)
+	payment := suite.payment(42, 1, 200)
+	assert.Nil(suite.T(), storage.Put(payment))
+	now = now.Add(time.Hour)
+	payment.Amount = big.NewInt(300)
+	assert.Nil(suite.T(), storage.Put(payment))
+
+	payments, err := storage.GetModifiedSince(time.Unix(1000000, 0).Add(time.Minute))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*Payment{payment}, payments)
+}
+
+func (suite *PaymentStorageSuite) TestGetModifiedSinceSkipsDeletedPayments() {
+	now := time.Unix(1000000, 0)
+	storage := suite.storageWithClock(&now)
+	deleted := suite.payment(42, 1, 200)
+	assert.Nil(suite.T(), storage.Put(deleted))
+	assert.Nil(suite.T(), storage.Delete(deleted))
+
+	payments, err := storage.GetModifiedSince(time.Unix(0, 0))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), payments)
+}
+
+func (suite *PaymentStorageSuite) TestPutIdempotentFirstInsert() {
+	payment := suite.payment(42, 1, 200)
+
+	stored, err := suite.storage.PutIdempotent(payment)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.True(suite.T(), stored)
+	actual, ok, _ := suite.storage.Get(big.NewInt(42), big.NewInt(1))
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), payment, actual)
+}
+
+func (suite *PaymentStorageSuite) TestPutIdempotentIdenticalReinsert() {
+	now := time.Unix(1000000, 0)
+	storage := suite.storageWithClock(&now)
+	_, err := storage.PutIdempotent(suite.payment(42, 1, 200))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	now = now.Add(time.Hour)
+
+	stored, err := storage.PutIdempotent(suite.payment(42, 1, 200))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.False(suite.T(), stored)
+	payments, _ := storage.GetModifiedSince(time.Unix(1000000, 0).Add(time.Minute))
+	assert.Empty(suite.T(), payments)
+}
+
+func (suite *PaymentStorageSuite) TestPutIdempotentChangedPayment() {
+	_, err := suite.storage.PutIdempotent(suite.payment(42, 1, 200))
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	stored, err := suite.storage.PutIdempotent(suite.payment(42, 1, 300))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.True(suite.T(), stored)
+	actual, _, _ := suite.storage.Get(big.NewInt(42), big.NewInt(1))
+	assert.Equal(suite.T(), suite.payment(42, 1, 300), actual)
+}
+
+func (suite *PaymentStorageSuite) TestGetModifiedSinceNothingModified() {
+	now := time.Unix(1000000, 0)
+	storage := suite.storageWithClock(&now)
+	assert.Nil(suite.T(), storage.Put(suite.payment(42, 1, 200)))
+
+	payments, err := storage.GetModifiedSince(now.Add(time.Second))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), payments)
+}
@@ -0,0 +1,49 @@
+package escrow
+
+import (
+	"math/big"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PendingChannelLookup returns payment channel states which are observed
+// on-chain but may be not yet seen by the daemon, for instance channel which
+// is reopened with the next nonce in the recent block.
+type PendingChannelLookup interface {
+	// PendingChannel returns pending state of the channel with the nonce,
+	// channel is nil if there is no such state. confirmed is true when state
+	// has enough confirmations to accept payments against it.
+	PendingChannel(channelID, nonce *big.Int) (channel *PaymentChannelData, confirmed bool, err error)
+}
+
+// resolvePendingChannel returns channel state to validate payment against.
+// If payment nonce is ahead of the channel nonce and pending channel lookup
+// is set, then confirmed pending state with payment nonce is returned, and
+// error is returned while the state is not confirmed. Otherwise passed
+// channel is returned.
+func (validator *ChannelPaymentValidator) resolvePendingChannel(payment *Payment, channel *PaymentChannelData) (*PaymentChannelData, error) {
+	if validator.pendingChannels == nil {
+		return channel, nil
+	}
+	maxNonce := new(big.Int).Add(channel.Nonce, big.NewInt(validator.nonceLag))
+	if payment.ChannelNonce.Cmp(maxNonce) <= 0 {
+		return channel, nil
+	}
+
+	var log = log.WithField("payment", payment).WithField("channel", channel)
+	pending, confirmed, err := validator.pendingChannels.PendingChannel(payment.ChannelID, payment.ChannelNonce)
+	if err != nil {
+		log.WithError(err).Error("Cannot read pending channel state")
+		return nil, NewPaymentError(Internal, "cannot read pending channel state: %v", err)
+	}
+	if pending == nil {
+		return channel, nil
+	}
+	if !confirmed {
+		log.Warn("Payment channel state with payment nonce is not confirmed yet")
+		return nil, NewPaymentError(IncorrectNonce, "payment channel state with nonce %v is pending confirmation", payment.ChannelNonce)
+	}
+
+	log.WithField("pendingChannel", pending).Info("Payment is validated against confirmed pending channel state")
+	return pending, nil
+}
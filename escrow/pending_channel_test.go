@@ -0,0 +1,77 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pendingChannelLookupMock struct {
+	channel   *PaymentChannelData
+	confirmed bool
+	err       error
+}
+
+func (lookup *pendingChannelLookupMock) PendingChannel(channelID, nonce *big.Int) (*PaymentChannelData, bool, error) {
+	if lookup.channel == nil || lookup.channel.ChannelID.Cmp(channelID) != 0 || lookup.channel.Nonce.Cmp(nonce) != 0 {
+		return nil, false, lookup.err
+	}
+	return lookup.channel, lookup.confirmed, lookup.err
+}
+
+func pendingChannelFixtures() (*testFixtures, *ChannelPaymentValidator, *pendingChannelLookupMock) {
+	fixtures := newTestFixtures("pending channel")
+	lookup := &pendingChannelLookupMock{channel: fixtures.Channel(42, 4, 1000, 0, 100)}
+	validator := ChannelPaymentValidatorMock()
+	WithPendingChannelLookup(lookup)(validator)
+	return fixtures, validator, lookup
+}
+
+func TestPendingChannelIsNotConfirmed(t *testing.T) {
+	fixtures, validator, _ := pendingChannelFixtures()
+
+	err := validator.Validate(fixtures.Payment(42, 4, 10), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(IncorrectNonce, "payment channel state with nonce 4 is pending confirmation"), err)
+}
+
+func TestPendingChannelThenConfirmed(t *testing.T) {
+	fixtures, validator, lookup := pendingChannelFixtures()
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	payment := fixtures.Payment(42, 4, 10)
+
+	err := validator.Validate(payment, channel)
+	assert.Equal(t, NewPaymentError(IncorrectNonce, "payment channel state with nonce 4 is pending confirmation"), err)
+
+	lookup.confirmed = true
+	err = validator.Validate(payment, channel)
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestPendingChannelIsNotFound(t *testing.T) {
+	fixtures, validator, _ := pendingChannelFixtures()
+
+	err := validator.Validate(fixtures.Payment(42, 5, 10), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 5"), err)
+}
+
+func TestPendingChannelLookupIsNotUsedForCurrentNonce(t *testing.T) {
+	fixtures, validator, lookup := pendingChannelFixtures()
+	lookup.err = errors.New("lookup should not be called")
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestPendingChannelLookupError(t *testing.T) {
+	fixtures, validator, lookup := pendingChannelFixtures()
+	lookup.err = errors.New("node is not available")
+
+	err := validator.Validate(fixtures.Payment(42, 4, 10), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot read pending channel state: node is not available"), err)
+}
@@ -0,0 +1,34 @@
+package escrow
+
+import (
+	"math/big"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// extendByPendingExtension returns copy of the channel with expiration set by
+// the pending extension if channel is near to be expired at
+// currentBlockWithThreshold and extension is mined but not yet reflected in
+// the channel state. It returns nil if pending extension lookup is not set,
+// there is no pending extension or extended channel expires too early as
+// well.
+func (validator *ChannelPaymentValidator) extendByPendingExtension(channel *PaymentChannelData, currentBlockWithThreshold *big.Int) (*PaymentChannelData, *PaymentError) {
+	if validator.pendingExtensions == nil {
+		return nil, nil
+	}
+
+	var log = log.WithField("channel", channel)
+	expiration, ok, err := validator.pendingExtensions.PendingChannelExpiration(channel.ChannelID)
+	if err != nil {
+		log.WithError(err).Error("Cannot read pending channel extension")
+		return nil, NewPaymentError(Internal, "cannot read pending channel extension: %v", err)
+	}
+	if !ok || currentBlockWithThreshold.Cmp(expiration) >= 0 {
+		return nil, nil
+	}
+
+	log.WithField("pendingExpiration", expiration).Info("Payment is validated against pending channel extension")
+	extended := *channel
+	extended.Expiration = expiration
+	return &extended, nil
+}
@@ -0,0 +1,73 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pendingExtensionFixtures() (*testFixtures, *ChannelPaymentValidator, *blockchainReaderMock) {
+	fixtures := newTestFixtures("pending extension")
+	reader := &blockchainReaderMock{extensions: map[int64]*big.Int{}}
+	validator := ChannelPaymentValidatorMock()
+	WithPendingExtensions(reader)(validator)
+	return fixtures, validator, reader
+}
+
+func TestPendingExtensionRescuesNearExpiredPayment(t *testing.T) {
+	fixtures, validator, reader := pendingExtensionFixtures()
+	reader.extensions[42] = big.NewInt(200)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 99)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), channel)
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.Equal(t, big.NewInt(99), channel.Expiration)
+}
+
+func TestPendingExtensionIsNotFound(t *testing.T) {
+	fixtures, validator, _ := pendingExtensionFixtures()
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 99))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 99, current block: 99, expiration threshold: 0"), err)
+}
+
+func TestPendingExtensionIsNearToBeExpired(t *testing.T) {
+	fixtures, validator, reader := pendingExtensionFixtures()
+	reader.extensions[42] = big.NewInt(99)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 90))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 90, current block: 99, expiration threshold: 0"), err)
+}
+
+func TestPendingExtensionIsChecked(t *testing.T) {
+	fixtures, validator, reader := pendingExtensionFixtures()
+	reader.extensions[42] = big.NewInt(200)
+	WithMaxExpirationHorizon(big.NewInt(50))(validator)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 99))
+
+	assert.Equal(t, NewPaymentError(Internal, "implausible channel expiration"), err)
+}
+
+func TestPendingExtensionIsNotReadForValidChannel(t *testing.T) {
+	fixtures, validator, reader := pendingExtensionFixtures()
+	reader.extensionErr = errors.New("node is unavailable")
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestPendingExtensionReadError(t *testing.T) {
+	fixtures, validator, reader := pendingExtensionFixtures()
+	reader.extensionErr = errors.New("node is unavailable")
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 99))
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot read pending channel extension: node is unavailable"), err)
+}
@@ -0,0 +1,71 @@
+package escrow
+
+import (
+	"fmt"
+)
+
+const pendingPaymentStorageKeyPrefix = "/payment/pending"
+
+// PendingPaymentStorage keeps payments which are accepted provisionally and
+// should be settled later. Commit moves pending payment into the storage of
+// settled payments, Rollback discards it.
+type PendingPaymentStorage struct {
+	pending *PaymentStorage
+	settled *PaymentStorage
+}
+
+// NewPendingPaymentStorage returns new instance of PendingPaymentStorage.
+// Pending payments are kept in atomicStorage under separate prefix,
+// committed payments are put into settled storage.
+func NewPendingPaymentStorage(atomicStorage AtomicStorage, settled *PaymentStorage) *PendingPaymentStorage {
+	return &PendingPaymentStorage{
+		pending: newPaymentStorage(atomicStorage, pendingPaymentStorageKeyPrefix, serialize, deserialize),
+		settled: settled,
+	}
+}
+
+// Put records payment as pending
+func (storage *PendingPaymentStorage) Put(payment *Payment) (err error) {
+	return storage.pending.Put(payment)
+}
+
+// GetAll returns all pending payments
+func (storage *PendingPaymentStorage) GetAll() (payments []*Payment, err error) {
+	return storage.pending.GetAll()
+}
+
+// Commit moves pending payment with the same channel id and nonce into the
+// settled payments storage. Payment is put into settled storage before it
+// is removed from pending one, so it is never lost.
+func (storage *PendingPaymentStorage) Commit(payment *Payment) (err error) {
+	pending, err := storage.getPending(payment)
+	if err != nil {
+		return
+	}
+
+	if err = storage.settled.Put(pending); err != nil {
+		return
+	}
+	return storage.pending.Delete(pending)
+}
+
+// Rollback discards pending payment with the same channel id and nonce
+func (storage *PendingPaymentStorage) Rollback(payment *Payment) (err error) {
+	pending, err := storage.getPending(payment)
+	if err != nil {
+		return
+	}
+
+	return storage.pending.Delete(pending)
+}
+
+func (storage *PendingPaymentStorage) getPending(payment *Payment) (pending *Payment, err error) {
+	pending, ok, err := storage.pending.Get(payment.ChannelID, payment.ChannelNonce)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, fmt.Errorf("payment %v is not pending", payment.ID())
+	}
+	return pending, nil
+}
@@ -0,0 +1,98 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PendingPaymentStorageSuite struct {
+	suite.Suite
+
+	memoryStorage *memoryStorage
+	settled       *PaymentStorage
+	storage       *PendingPaymentStorage
+	fixtures      *testFixtures
+}
+
+func (suite *PendingPaymentStorageSuite) SetupSuite() {
+	suite.memoryStorage = NewMemStorage()
+	suite.settled = NewPaymentStorage(suite.memoryStorage)
+	suite.storage = NewPendingPaymentStorage(suite.memoryStorage, suite.settled)
+	suite.fixtures = newTestFixtures("pending")
+}
+
+func (suite *PendingPaymentStorageSuite) SetupTest() {
+	suite.memoryStorage.Clear()
+}
+
+func TestPendingPaymentStorageSuite(t *testing.T) {
+	suite.Run(t, new(PendingPaymentStorageSuite))
+}
+
+func (suite *PendingPaymentStorageSuite) pendingPayments() []*Payment {
+	payments, err := suite.storage.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	return payments
+}
+
+func (suite *PendingPaymentStorageSuite) settledPayments() []*Payment {
+	payments, err := suite.settled.GetAll()
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	return payments
+}
+
+func (suite *PendingPaymentStorageSuite) TestPutIsNotSettled() {
+	payment := suite.fixtures.Payment(42, 3, 12345)
+
+	assert.Nil(suite.T(), suite.storage.Put(payment))
+
+	assert.Equal(suite.T(), []*Payment{payment}, suite.pendingPayments())
+	assert.Empty(suite.T(), suite.settledPayments())
+}
+
+func (suite *PendingPaymentStorageSuite) TestCommit() {
+	payment := suite.fixtures.Payment(42, 3, 12345)
+	assert.Nil(suite.T(), suite.storage.Put(payment))
+
+	err := suite.storage.Commit(payment)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), suite.pendingPayments())
+	assert.Equal(suite.T(), []*Payment{payment}, suite.settledPayments())
+}
+
+func (suite *PendingPaymentStorageSuite) TestRollback() {
+	payment := suite.fixtures.Payment(42, 3, 12345)
+	assert.Nil(suite.T(), suite.storage.Put(payment))
+
+	err := suite.storage.Rollback(payment)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), suite.pendingPayments())
+	assert.Empty(suite.T(), suite.settledPayments())
+}
+
+func (suite *PendingPaymentStorageSuite) TestCommitNotPendingPayment() {
+	err := suite.storage.Commit(suite.fixtures.Payment(42, 3, 12345))
+
+	assert.Equal(suite.T(), errors.New("payment 42/3 is not pending"), err)
+}
+
+func (suite *PendingPaymentStorageSuite) TestValidatorRecordsPendingPayment() {
+	validator := ChannelPaymentValidatorMock()
+	WithPendingPayments(suite.storage)(validator)
+	payment := suite.fixtures.Payment(42, 3, 12345)
+
+	err := validator.Validate(payment, suite.fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	pending, ok, err := suite.storage.pending.Get(big.NewInt(42), big.NewInt(3))
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), payment, pending)
+	assert.Empty(suite.T(), suite.settledPayments())
+}
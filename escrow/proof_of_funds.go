@@ -0,0 +1,105 @@
+package escrow
+
+import (
+	"fmt"
+	"math/big"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ProofOfFunds is a balance proof which client attaches to the payment to
+// show that channel sender has enough funds in escrow. Proof is not a part
+// of the signed payment message, it is verified against blockchain state
+// at Block instead.
+type ProofOfFunds struct {
+	// Block is a number of the block at which balance is proved.
+	Block *big.Int
+	// Balance is an escrow balance of the channel sender at Block.
+	Balance *big.Int
+}
+
+func (proof *ProofOfFunds) String() string {
+	return fmt.Sprintf("{Block: %v, Balance: %v}", proof.Block, loggedAmount(proof.Balance))
+}
+
+// ProofOfFundsVerifier checks proof of funds attached to the payment. It is
+// called by validator after payment signature and channel state are
+// verified. Verifier should return PaymentError to be sent to client when
+// proof is not accepted.
+type ProofOfFundsVerifier interface {
+	VerifyProofOfFunds(payment *Payment, channel *PaymentChannelData, currentBlock *big.Int) (err error)
+}
+
+// BlockchainProofOfFundsVerifier verifies proof of funds using escrow
+// balance returned by BlockchainReader.
+type BlockchainProofOfFundsVerifier struct {
+	reader BlockchainReader
+	// maxAge is a maximum number of blocks between proof block and current
+	// block.
+	maxAge int64
+	// threshold is optional, when set proof is required only for payments
+	// which increment channel authorized amount at least on threshold.
+	threshold *big.Int
+}
+
+// NewBlockchainProofOfFundsVerifier returns new proof of funds verifier.
+// Proof is required for payments which increment channel authorized amount
+// at least on threshold, nil threshold means proof is required for each
+// payment. Proofs older than maxAge blocks are rejected.
+func NewBlockchainProofOfFundsVerifier(reader BlockchainReader, maxAge int64, threshold *big.Int) *BlockchainProofOfFundsVerifier {
+	return &BlockchainProofOfFundsVerifier{
+		reader:    reader,
+		maxAge:    maxAge,
+		threshold: threshold,
+	}
+}
+
+// VerifyProofOfFunds implements ProofOfFundsVerifier.VerifyProofOfFunds.
+func (verifier *BlockchainProofOfFundsVerifier) VerifyProofOfFunds(payment *Payment, channel *PaymentChannelData, currentBlock *big.Int) (err error) {
+	increment := new(big.Int).Sub(payment.Amount, channel.AuthorizedAmount)
+	if verifier.threshold != nil && increment.Cmp(verifier.threshold) < 0 {
+		return nil
+	}
+
+	proof := payment.ProofOfFunds
+	if proof == nil || proof.Block == nil || proof.Balance == nil {
+		return NewPaymentError(Unauthenticated, "proof of funds is required for payment of %v", increment)
+	}
+	if proof.Block.Cmp(currentBlock) > 0 {
+		return NewPaymentError(Unauthenticated, "proof of funds block %v is after current block %v", proof.Block, currentBlock)
+	}
+	oldestBlock := new(big.Int).Sub(currentBlock, big.NewInt(verifier.maxAge))
+	if proof.Block.Cmp(oldestBlock) < 0 {
+		return NewPaymentError(Unauthenticated, "proof of funds is outdated, proof block: %v, current block: %v, max age: %v", proof.Block, currentBlock, verifier.maxAge)
+	}
+
+	balance, err := verifier.reader.EscrowBalanceAt(channel.Sender, proof.Block)
+	if err != nil {
+		log.WithError(err).WithField("proof", proof).Error("Cannot read escrow balance to verify proof of funds")
+		return NewPaymentError(Internal, "cannot verify proof of funds: %v", err)
+	}
+	if balance.Cmp(proof.Balance) != 0 {
+		return NewPaymentError(Unauthenticated, "proof of funds balance %v does not match blockchain balance %v at block %v", proof.Balance, balance, proof.Block)
+	}
+	if proof.Balance.Cmp(increment) < 0 {
+		return NewPaymentError(Unauthenticated, "proof of funds balance %v is not enough to pay %v", proof.Balance, increment)
+	}
+
+	return nil
+}
+
+// verifyProofOfFunds returns nil if proof of funds verifier is not set or
+// it accepts proof attached to the payment.
+func (validator *ChannelPaymentValidator) verifyProofOfFunds(payment *Payment, channel *PaymentChannelData, currentBlock *big.Int) *PaymentError {
+	if validator.proofOfFunds == nil {
+		return nil
+	}
+	err := validator.proofOfFunds.VerifyProofOfFunds(payment, channel, currentBlock)
+	if err == nil {
+		return nil
+	}
+	if paymentErr, ok := err.(*PaymentError); ok {
+		return paymentErr
+	}
+	return NewPaymentError(Unauthenticated, "proof of funds is not valid: %v", err)
+}
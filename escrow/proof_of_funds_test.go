@@ -0,0 +1,122 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func proofOfFundsFixtures(threshold *big.Int) (*testFixtures, *ChannelPaymentValidator, *blockchainReaderMock) {
+	fixtures := newTestFixtures("proof of funds")
+	reader := &blockchainReaderMock{
+		balances: map[common.Address]*big.Int{fixtures.Address("sender"): big.NewInt(1000)},
+	}
+	validator := ChannelPaymentValidatorMock()
+	WithProofOfFunds(NewBlockchainProofOfFundsVerifier(reader, 10, threshold))(validator)
+	return fixtures, validator, reader
+}
+
+func paymentWithProof(fixtures *testFixtures, block, balance int64) *Payment {
+	payment := fixtures.Payment(42, 3, 12345)
+	payment.ProofOfFunds = &ProofOfFunds{Block: big.NewInt(block), Balance: big.NewInt(balance)}
+	return payment
+}
+
+func TestProofOfFundsValid(t *testing.T) {
+	fixtures, validator, _ := proofOfFundsFixtures(nil)
+
+	err := validator.ValidateAtBlock(paymentWithProof(fixtures, 95, 1000), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestProofOfFundsOutdated(t *testing.T) {
+	fixtures, validator, _ := proofOfFundsFixtures(nil)
+
+	err := validator.ValidateAtBlock(paymentWithProof(fixtures, 89, 1000), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "proof of funds is outdated, proof block: 89, current block: 100, max age: 10"), err)
+}
+
+func TestProofOfFundsFromFutureBlock(t *testing.T) {
+	fixtures, validator, _ := proofOfFundsFixtures(nil)
+
+	err := validator.ValidateAtBlock(paymentWithProof(fixtures, 101, 1000), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "proof of funds block 101 is after current block 100"), err)
+}
+
+func TestProofOfFundsMissing(t *testing.T) {
+	fixtures, validator, _ := proofOfFundsFixtures(nil)
+
+	err := validator.ValidateAtBlock(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "proof of funds is required for payment of 45"), err)
+}
+
+func TestProofOfFundsIsNotRequiredBelowThreshold(t *testing.T) {
+	fixtures, validator, _ := proofOfFundsFixtures(big.NewInt(46))
+
+	err := validator.ValidateAtBlock(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestProofOfFundsBalanceMismatch(t *testing.T) {
+	fixtures, validator, _ := proofOfFundsFixtures(nil)
+
+	err := validator.ValidateAtBlock(paymentWithProof(fixtures, 95, 2000), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "proof of funds balance 2000 does not match blockchain balance 1000 at block 95"), err)
+}
+
+func TestProofOfFundsBalanceIsNotEnough(t *testing.T) {
+	fixtures, validator, reader := proofOfFundsFixtures(nil)
+	reader.balances[fixtures.Address("sender")] = big.NewInt(44)
+
+	err := validator.ValidateAtBlock(paymentWithProof(fixtures, 95, 44), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "proof of funds balance 44 is not enough to pay 45"), err)
+}
+
+func TestProofOfFundsBlockchainError(t *testing.T) {
+	fixtures, validator, reader := proofOfFundsFixtures(nil)
+	reader.balanceErr = errors.New("node is not available")
+
+	err := validator.ValidateAtBlock(paymentWithProof(fixtures, 95, 1000), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot verify proof of funds: node is not available"), err)
+}
+
+type proofOfFundsVerifierMock struct {
+	err error
+}
+
+func (verifier *proofOfFundsVerifierMock) VerifyProofOfFunds(payment *Payment, channel *PaymentChannelData, currentBlock *big.Int) error {
+	return verifier.err
+}
+
+func TestProofOfFundsCustomVerifierError(t *testing.T) {
+	fixtures := newTestFixtures("proof of funds")
+	validator := ChannelPaymentValidatorMock()
+	WithProofOfFunds(&proofOfFundsVerifierMock{err: errors.New("balance oracle rejected proof")})(validator)
+
+	err := validator.ValidateAtBlock(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "proof of funds is not valid: balance oracle rejected proof"), err)
+}
+
+func TestDiagnoseProofOfFunds(t *testing.T) {
+	fixtures, validator, _ := proofOfFundsFixtures(nil)
+
+	report := validator.Diagnose(paymentWithProof(fixtures, 80, 1000), fixtures.Channel(42, 3, 12345, 12300, 1000))
+
+	assert.Equal(t, ValidationReportEntry{
+		Check:  "funds",
+		Passed: false,
+		Detail: "proof of funds is outdated, proof block: 80, current block: 99, max age: 10",
+	}, report.Entries[len(report.Entries)-1])
+}
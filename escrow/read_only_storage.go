@@ -0,0 +1,67 @@
+package escrow
+
+import (
+	"errors"
+)
+
+// ErrReadOnlyStorage is returned by ReadOnlyAtomicStorage on any write
+// attempt.
+var ErrReadOnlyStorage = errors.New("storage is read-only")
+
+// ReadOnlyAtomicStorage is a decorator for atomic storage which passes reads
+// to the delegate and rejects all writes with ErrReadOnlyStorage. It is
+// intended to be used on read replicas which cannot write into storage.
+type ReadOnlyAtomicStorage struct {
+	delegate AtomicStorage
+}
+
+// NewReadOnlyAtomicStorage returns new instance of ReadOnlyAtomicStorage
+func NewReadOnlyAtomicStorage(delegate AtomicStorage) *ReadOnlyAtomicStorage {
+	return &ReadOnlyAtomicStorage{delegate: delegate}
+}
+
+// Get is implementation of AtomicStorage.Get
+func (storage *ReadOnlyAtomicStorage) Get(key string) (value string, ok bool, err error) {
+	return storage.delegate.Get(key)
+}
+
+// GetByKeyPrefix is implementation of AtomicStorage.GetByKeyPrefix
+func (storage *ReadOnlyAtomicStorage) GetByKeyPrefix(prefix string) (values []string, err error) {
+	return storage.delegate.GetByKeyPrefix(prefix)
+}
+
+// GetKeysByPrefix is implementation of AtomicStorage.GetKeysByPrefix
+func (storage *ReadOnlyAtomicStorage) GetKeysByPrefix(prefix string) (keys []string, err error) {
+	return storage.delegate.GetKeysByPrefix(prefix)
+}
+
+// Put is implementation of AtomicStorage.Put, it always returns
+// ErrReadOnlyStorage.
+func (storage *ReadOnlyAtomicStorage) Put(key string, value string) (err error) {
+	return ErrReadOnlyStorage
+}
+
+// PutIfAbsent is implementation of AtomicStorage.PutIfAbsent, it always
+// returns ErrReadOnlyStorage.
+func (storage *ReadOnlyAtomicStorage) PutIfAbsent(key string, value string) (ok bool, err error) {
+	return false, ErrReadOnlyStorage
+}
+
+// CompareAndSwap is implementation of AtomicStorage.CompareAndSwap, it
+// always returns ErrReadOnlyStorage.
+func (storage *ReadOnlyAtomicStorage) CompareAndSwap(key string, prevValue string, newValue string) (ok bool, err error) {
+	return false, ErrReadOnlyStorage
+}
+
+// Delete is implementation of AtomicStorage.Delete, it always returns
+// ErrReadOnlyStorage.
+func (storage *ReadOnlyAtomicStorage) Delete(key string) (err error) {
+	return ErrReadOnlyStorage
+}
+
+// WithTransaction is implementation of
+// TransactionalAtomicStorage.WithTransaction, it always returns
+// ErrReadOnlyStorage.
+func (storage *ReadOnlyAtomicStorage) WithTransaction(fn func(tx StorageTx) error) (err error) {
+	return ErrReadOnlyStorage
+}
@@ -0,0 +1,45 @@
+package escrow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyAtomicStorageReads(t *testing.T) {
+	delegate := NewMemStorage()
+	delegate.Put("/prefix/key", "value")
+	storage := NewReadOnlyAtomicStorage(delegate)
+
+	value, ok, err := storage.Get("/prefix/key")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value", value)
+
+	values, err := storage.GetByKeyPrefix("/prefix")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"value"}, values)
+
+	keys, err := storage.GetKeysByPrefix("/prefix")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/prefix/key"}, keys)
+}
+
+func TestReadOnlyAtomicStorageRejectsWrites(t *testing.T) {
+	delegate := NewMemStorage()
+	delegate.Put("key", "value")
+	storage := NewReadOnlyAtomicStorage(delegate)
+
+	assert.Equal(t, ErrReadOnlyStorage, storage.Put("key", "new value"))
+	_, err := storage.PutIfAbsent("another key", "value")
+	assert.Equal(t, ErrReadOnlyStorage, err)
+	_, err = storage.CompareAndSwap("key", "value", "new value")
+	assert.Equal(t, ErrReadOnlyStorage, err)
+	assert.Equal(t, ErrReadOnlyStorage, storage.Delete("key"))
+	assert.Equal(t, ErrReadOnlyStorage, WithTransaction(storage, func(tx StorageTx) error {
+		tx.Put("key", "new value")
+		return nil
+	}))
+
+	assert.Equal(t, map[string]string{"key": "value"}, delegate.data)
+}
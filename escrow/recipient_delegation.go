@@ -0,0 +1,35 @@
+package escrow
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+// RecipientDelegations maps channel recipient to the payment address of the
+// service provider which the recipient forwards funds to. It allows
+// accepting channels which pay to an intermediate recipient.
+type RecipientDelegations map[common.Address]common.Address
+
+// accepts returns true if recipient is the payment address itself or it is
+// delegated to the payment address.
+func (delegations RecipientDelegations) accepts(recipient, paymentAddress common.Address) bool {
+	if recipient == paymentAddress {
+		return true
+	}
+	delegated, ok := delegations[recipient]
+	return ok && delegated == paymentAddress
+}
+
+// isAcceptedRecipient returns true if recipient check is not configured or
+// channel recipient is accepted by the recipient delegations.
+func (validator *ChannelPaymentValidator) isAcceptedRecipient(channel *PaymentChannelData) bool {
+	if validator.recipientPaymentAddress == nil {
+		return true
+	}
+	return validator.recipientDelegations.accepts(channel.Recipient, validator.recipientPaymentAddress())
+}
+
+func (validator *ChannelPaymentValidator) recipientError(channel *PaymentChannelData) *PaymentError {
+	return NewPaymentError(Unauthenticated, "payment channel recipient %v is not a payment address of the service", blockchain.AddressToHex(&channel.Recipient))
+}
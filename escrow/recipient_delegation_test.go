@@ -0,0 +1,104 @@
+package escrow
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+func validatorWithRecipientDelegations(fixtures *testFixtures) *ChannelPaymentValidator {
+	validator := ChannelPaymentValidatorMock()
+	WithRecipientDelegations(
+		func() common.Address { return fixtures.Address("provider") },
+		RecipientDelegations{fixtures.Address("forwarder"): fixtures.Address("provider")},
+	)(validator)
+	return validator
+}
+
+func TestValidatePaymentToDirectRecipient(t *testing.T) {
+	fixtures := newTestFixtures("recipient")
+	validator := validatorWithRecipientDelegations(fixtures)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	channel.Recipient = fixtures.Address("provider")
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), channel)
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestValidatePaymentToDelegatedRecipient(t *testing.T) {
+	fixtures := newTestFixtures("recipient")
+	validator := validatorWithRecipientDelegations(fixtures)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	channel.Recipient = fixtures.Address("forwarder")
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), channel)
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestValidatePaymentToUnrelatedRecipient(t *testing.T) {
+	fixtures := newTestFixtures("recipient")
+	validator := validatorWithRecipientDelegations(fixtures)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	recipient := fixtures.Address("unrelated")
+	channel.Recipient = recipient
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), channel)
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment channel recipient %v is not a payment address of the service", blockchain.AddressToHex(&recipient)), err)
+}
+
+func TestValidatePaymentToRecipientDelegatedToAnotherProvider(t *testing.T) {
+	fixtures := newTestFixtures("recipient")
+	validator := ChannelPaymentValidatorMock()
+	WithRecipientDelegations(
+		func() common.Address { return fixtures.Address("provider") },
+		RecipientDelegations{fixtures.Address("forwarder"): fixtures.Address("another provider")},
+	)(validator)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	channel.Recipient = fixtures.Address("forwarder")
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), channel)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, Unauthenticated, err.(*PaymentError).Code)
+}
+
+func TestDiagnoseUnrelatedRecipient(t *testing.T) {
+	fixtures := newTestFixtures("recipient")
+	validator := validatorWithRecipientDelegations(fixtures)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	recipient := fixtures.Address("recipient")
+
+	report := validator.Diagnose(fixtures.Payment(42, 3, 12345), channel)
+
+	assert.False(t, report.Valid())
+	assert.Equal(t, ValidationReportEntry{Check: "recipient", Passed: false, Detail: "payment channel recipient " + blockchain.AddressToHex(&recipient) + " is not a payment address of the service"}, report.Entries[0])
+}
+
+func TestBlockchainChannelReaderAcceptsDelegatedRecipient(t *testing.T) {
+	fixtures := newTestFixtures("recipient")
+	reader := &BlockchainChannelReader{
+		readChannelFromBlockchain: func(channelID *big.Int) (*blockchain.MultiPartyEscrowChannel, bool, error) {
+			return &blockchain.MultiPartyEscrowChannel{
+				Recipient:  fixtures.Address("forwarder"),
+				Value:      big.NewInt(12345),
+				Nonce:      big.NewInt(3),
+				Expiration: big.NewInt(100),
+			}, true, nil
+		},
+		recipientPaymentAddress: func() common.Address { return fixtures.Address("provider") },
+	}
+	reader.AcceptDelegatedRecipients(RecipientDelegations{fixtures.Address("forwarder"): fixtures.Address("provider")})
+
+	channel, ok, err := reader.GetChannelStateFromBlockchain(&PaymentChannelKey{ID: big.NewInt(42)})
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.True(t, ok)
+	assert.Equal(t, fixtures.Address("forwarder"), channel.Recipient)
+}
@@ -0,0 +1,85 @@
+package escrow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerializePaymentRoundTrip(t *testing.T) {
+	payment := newTestFixtures("serialize").Payment(42, 3, 12345)
+
+	serialized, err := serialize(payment)
+	assert.Nil(t, err)
+	deserialized := &Payment{}
+	err = deserialize(serialized, deserialized)
+
+	assert.Nil(t, err)
+	assert.Equal(t, payment, deserialized)
+}
+
+func TestSerializePaymentChannelDataRoundTrip(t *testing.T) {
+	channel := newTestFixtures("serialize").Channel(42, 3, 12345, 12300, 100)
+	channel.Signature = []byte{0x1, 0x2, 0xFE, 0xFF}
+
+	serialized, err := serialize(channel)
+	assert.Nil(t, err)
+	deserialized := &PaymentChannelData{}
+	err = deserialize(serialized, deserialized)
+
+	assert.Nil(t, err)
+	assert.Equal(t, channel, deserialized)
+}
+
+// Benchmarks below measure gob based serialization which is used by all
+// storages. Serialized values are compared by AtomicStorage.CompareAndSwap,
+// so serialization format cannot be changed without migration of the data
+// already kept in storage.
+
+func BenchmarkSerializePayment(b *testing.B) {
+	payment := newTestFixtures("serialize").Payment(42, 3, 12345)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := serialize(payment); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDeserializePayment(b *testing.B) {
+	serialized, err := serialize(newTestFixtures("serialize").Payment(42, 3, 12345))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := deserialize(serialized, &Payment{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSerializePaymentChannelData(b *testing.B) {
+	channel := newTestFixtures("serialize").Channel(42, 3, 12345, 12300, 100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := serialize(channel); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDeserializePaymentChannelData(b *testing.B) {
+	serialized, err := serialize(newTestFixtures("serialize").Channel(42, 3, 12345, 12300, 100))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := deserialize(serialized, &PaymentChannelData{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package escrow
+
+import (
+	"bytes"
+	"math/big"
+)
+
+// eip155MinV is a minimal value of V encoded according to EIP-155:
+// V = 35 + 2 * chainID + recoveryID.
+const eip155MinV = 35
+
+// maxSignatureVLength is a maximum number of bytes of big-endian encoded V
+// which is accepted, it is enough to encode V for any 256 bit chain id.
+const maxSignatureVLength = 32
+
+// decodeEIP155Signature returns signature in [R || S || V] format where V
+// is 27 or 28. If signature V is encoded according to EIP-155 then chain id
+// is extracted from V and compared with expectedChainID, nil
+// expectedChainID means EIP-155 signatures are not accepted. V longer than
+// one byte is expected to be big-endian encoded after S. Signatures with
+// legacy V are returned as is.
+func decodeEIP155Signature(signature []byte, expectedChainID *big.Int) ([]byte, error) {
+	if len(signature) < 65 || len(signature) > 64+maxSignatureVLength {
+		return signature, nil
+	}
+
+	v := new(big.Int).SetBytes(signature[64:])
+	if v.Cmp(big.NewInt(eip155MinV)) < 0 {
+		if len(signature) != 65 {
+			return nil, NewPaymentError(MalformedSignature, "payment signature V component %v is not canonical", v)
+		}
+		return signature, nil
+	}
+
+	if expectedChainID == nil {
+		return nil, NewPaymentError(MalformedSignature, "payment signature V component %v is EIP-155 encoded but chain id is not configured", v)
+	}
+	v.Sub(v, big.NewInt(eip155MinV))
+	recoveryID := v.Bit(0)
+	chainID := v.Rsh(v, 1)
+	if chainID.Cmp(expectedChainID) != 0 {
+		return nil, NewPaymentError(MalformedSignature, "payment signature chain id %v does not match expected chain id %v", chainID, expectedChainID)
+	}
+
+	decoded := make([]byte, 65)
+	copy(decoded, signature[0:64])
+	decoded[64] = byte(27 + recoveryID)
+	return decoded, nil
+}
+
+// withDecodedSignature returns payment with signature V decoded by
+// decodeEIP155Signature, original payment is returned if signature is not
+// changed.
+func withDecodedSignature(payment *Payment, expectedChainID *big.Int) (*Payment, error) {
+	signature, err := decodeEIP155Signature(payment.Signature, expectedChainID)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(signature, payment.Signature) {
+		return payment, nil
+	}
+	decoded := *payment
+	decoded.Signature = signature
+	return &decoded, nil
+}
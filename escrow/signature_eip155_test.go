@@ -0,0 +1,80 @@
+package escrow
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// eip155Payment returns payment signed by "signer" key with V encoded
+// according to EIP-155 for the chainID.
+func eip155Payment(fixtures *testFixtures, chainID int64) *Payment {
+	payment := fixtures.Payment(42, 3, 12345)
+	recoveryID := int64(payment.Signature[64] % 27)
+	v := big.NewInt(eip155MinV + 2*chainID + recoveryID)
+	payment.Signature = append(payment.Signature[0:64:64], v.Bytes()...)
+	return payment
+}
+
+func eip155Validator(chainID int64) *ChannelPaymentValidator {
+	validator := ChannelPaymentValidatorMock()
+	WithChainID(big.NewInt(chainID))(validator)
+	return validator
+}
+
+func TestEIP155SignatureSingleByteV(t *testing.T) {
+	fixtures := newTestFixtures("eip155")
+	payment := eip155Payment(fixtures, 1)
+	assert.Equal(t, 65, len(payment.Signature))
+
+	err := eip155Validator(1).Validate(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestEIP155SignatureMultiByteV(t *testing.T) {
+	fixtures := newTestFixtures("eip155")
+	payment := eip155Payment(fixtures, 11155111)
+	signer := fixtures.Address("signer")
+
+	recovered, err := eip155Validator(11155111).getSignerAddressFromPayment(payment)
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.Equal(t, signer, *recovered)
+}
+
+func TestEIP155SignatureWrongChainID(t *testing.T) {
+	fixtures := newTestFixtures("eip155")
+
+	err := eip155Validator(1).Validate(eip155Payment(fixtures, 3), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(MalformedSignature, "payment signature chain id 3 does not match expected chain id 1"), err)
+}
+
+func TestEIP155SignatureChainIDIsNotConfigured(t *testing.T) {
+	fixtures := newTestFixtures("eip155")
+	payment := eip155Payment(fixtures, 1)
+
+	err := ChannelPaymentValidatorMock().Validate(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(MalformedSignature, "payment signature V component %v is EIP-155 encoded but chain id is not configured", payment.Signature[64]), err)
+}
+
+func TestEIP155SignatureLegacyVIsAccepted(t *testing.T) {
+	fixtures := newTestFixtures("eip155")
+
+	err := eip155Validator(1).Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestDecodeEIP155SignatureNonCanonicalLongV(t *testing.T) {
+	fixtures := newTestFixtures("eip155")
+	payment := fixtures.Payment(42, 3, 12345)
+	signature := append(payment.Signature[0:64:64], 0, 27)
+
+	_, err := decodeEIP155Signature(signature, big.NewInt(1))
+
+	assert.Equal(t, NewPaymentError(MalformedSignature, "payment signature V component 27 is not canonical"), err)
+}
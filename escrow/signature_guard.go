@@ -0,0 +1,174 @@
+package escrow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const signatureGuardStorageKeyPrefix = "/payment/signature"
+
+// SignatureGuard protects from replay of the payments by remembering
+// signatures of the accepted payments and rejecting payments which
+// signature was already used. Signatures are kept in AtomicStorage which is
+// the exact cache of the used signatures, each signature is remembered
+// using PutIfAbsent, so concurrent validators sharing the storage cannot
+// accept the same signature twice. Optional bloom filter is kept in memory
+// in front of the storage, it is filled by the signatures from the storage
+// on creation and allows Used to skip reading the storage for the
+// signatures which are definitely new. Bloom filter is local to the
+// process, so it should be enabled only when storage is not shared with
+// other validators.
+type SignatureGuard struct {
+	storage TypedAtomicStorage
+
+	bloomMutex sync.Mutex
+	bloom      *bloomFilter
+}
+
+// usedSignature is a record of the exact cache, it keeps payment which
+// signature was used to simplify investigation of the replays.
+type usedSignature struct {
+	ChannelID    *big.Int
+	ChannelNonce *big.Int
+}
+
+// NewSignatureGuard returns new instance of SignatureGuard which keeps
+// used signatures in the storage.
+func NewSignatureGuard(atomicStorage AtomicStorage) *SignatureGuard {
+	return &SignatureGuard{
+		storage: &TypedAtomicStorageImpl{
+			atomicStorage: &PrefixedAtomicStorage{
+				delegate:  atomicStorage,
+				keyPrefix: signatureGuardStorageKeyPrefix,
+			},
+			keySerializer:     serializeStringKey,
+			valueSerializer:   serialize,
+			valueDeserializer: deserialize,
+			valueType:         reflect.TypeOf(usedSignature{}),
+		},
+	}
+}
+
+// NewSignatureGuardWithBloomFilter returns new instance of SignatureGuard
+// with bloom filter front-end sized for expectedSignatures signatures and
+// falsePositiveRate probability of the storage read for a new signature.
+// Signatures which are already in the storage are added to the filter, so
+// it is correct after restart. falsePositiveRate should be greater than 0
+// and less than 1.
+func NewSignatureGuardWithBloomFilter(atomicStorage AtomicStorage, expectedSignatures uint, falsePositiveRate float64) (*SignatureGuard, error) {
+	if !(falsePositiveRate > 0 && falsePositiveRate < 1) {
+		return nil, fmt.Errorf("bloom filter false positive rate should be in (0, 1) range: %v", falsePositiveRate)
+	}
+
+	guard := NewSignatureGuard(atomicStorage)
+	guard.bloom = newBloomFilter(expectedSignatures, falsePositiveRate)
+
+	keys, err := guard.storage.GetKeysByPrefix("")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		hash, err := hex.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect used signature key: %q", key)
+		}
+		guard.bloom.add(hash)
+	}
+
+	return guard, nil
+}
+
+// signatureKey returns hash of the payment signature and storage key of
+// the signature.
+func signatureKey(payment *Payment) (hash []byte, key string) {
+	digest := sha256.Sum256(payment.Signature)
+	return digest[:], hex.EncodeToString(digest[:])
+}
+
+// CheckAndRemember returns true if signature of the payment was already
+// used, otherwise it remembers the signature and returns false.
+func (guard *SignatureGuard) CheckAndRemember(payment *Payment) (duplicate bool, err error) {
+	hash, key := signatureKey(payment)
+
+	ok, err := guard.storage.PutIfAbsent(key, &usedSignature{ChannelID: payment.ChannelID, ChannelNonce: payment.ChannelNonce})
+	if err != nil {
+		return false, err
+	}
+
+	if guard.bloom != nil {
+		guard.bloomMutex.Lock()
+		guard.bloom.add(hash)
+		guard.bloomMutex.Unlock()
+	}
+	return !ok, nil
+}
+
+// Used returns true if signature of the payment was already used, unlike
+// CheckAndRemember it doesn't remember the signature. Storage is not read
+// if bloom filter reports signature as definitely new.
+func (guard *SignatureGuard) Used(payment *Payment) (used bool, err error) {
+	hash, key := signatureKey(payment)
+
+	if guard.bloom != nil {
+		guard.bloomMutex.Lock()
+		mayContain := guard.bloom.mayContain(hash)
+		guard.bloomMutex.Unlock()
+		if !mayContain {
+			return false, nil
+		}
+	}
+
+	_, used, err = guard.storage.Get(key)
+	return used, err
+}
+
+// Forget removes signature of the payment from the used ones, so the
+// payment can be accepted again. It is called when payment which was
+// remembered is not committed, for instance transaction is rolled back.
+// Bloom filter cannot forget values, so it reports the signature as
+// probably used and Used reads the storage for it.
+func (guard *SignatureGuard) Forget(payment *Payment) (err error) {
+	_, key := signatureKey(payment)
+	return guard.storage.Delete(key)
+}
+
+// rememberSignature rejects payment which signature was already used and
+// remembers signature of the payment otherwise. In read-only mode signature
+// is checked but not remembered.
+func (validator *ChannelPaymentValidator) rememberSignature(payment *Payment) *PaymentError {
+	if validator.signatureGuard == nil {
+		return nil
+	}
+
+	var duplicate bool
+	var err error
+	if validator.readOnly {
+		duplicate, err = validator.signatureGuard.Used(payment)
+	} else {
+		duplicate, err = validator.signatureGuard.CheckAndRemember(payment)
+	}
+	if err != nil {
+		log.WithField("payment", payment).WithError(err).Error("Cannot check whether payment signature was used")
+		return NewPaymentError(Internal, "cannot check payment signature replay: %v", err)
+	}
+	if duplicate {
+		log.WithField("payment", payment).Warn("Payment signature is already used")
+		return NewPaymentError(Unauthenticated, "payment signature is already used")
+	}
+	return nil
+}
+
+// forgetSignature removes signature of the payment remembered by
+// rememberSignature.
+func (validator *ChannelPaymentValidator) forgetSignature(payment *Payment) error {
+	if validator.signatureGuard == nil || validator.readOnly {
+		return nil
+	}
+	return validator.signatureGuard.Forget(payment)
+}
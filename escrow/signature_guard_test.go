@@ -0,0 +1,264 @@
+package escrow
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingWritesAtomicStorage fails all writes with err
+type failingWritesAtomicStorage struct {
+	AtomicStorage
+	err error
+}
+
+func (storage *failingWritesAtomicStorage) Put(key string, value string) (err error) {
+	return storage.err
+}
+
+func (storage *failingWritesAtomicStorage) PutIfAbsent(key string, value string) (ok bool, err error) {
+	return false, storage.err
+}
+
+func (storage *failingWritesAtomicStorage) CompareAndSwap(key string, prevValue string, newValue string) (ok bool, err error) {
+	return false, storage.err
+}
+
+func (storage *failingWritesAtomicStorage) Delete(key string) (err error) {
+	return storage.err
+}
+
+func newTestSignatureGuardWithBloomFilter(t *testing.T, storage AtomicStorage) *SignatureGuard {
+	guard, err := NewSignatureGuardWithBloomFilter(storage, 100, 0.01)
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	return guard
+}
+
+func signatureGuardPayments(count int) []*Payment {
+	fixtures := newTestFixtures("signature guard")
+	payments := make([]*Payment, count)
+	for i := range payments {
+		payments[i] = fixtures.Payment(42, 3, int64(12345+i))
+	}
+	return payments
+}
+
+func TestSignatureGuardDetectsDuplicate(t *testing.T) {
+	for _, guard := range []*SignatureGuard{
+		NewSignatureGuard(NewMemStorage()),
+		newTestSignatureGuardWithBloomFilter(t, NewMemStorage()),
+	} {
+		payment := signatureGuardPayments(1)[0]
+
+		duplicate, err := guard.CheckAndRemember(payment)
+		assert.Nil(t, err)
+		assert.False(t, duplicate)
+
+		duplicate, err = guard.CheckAndRemember(payment)
+		assert.Nil(t, err)
+		assert.True(t, duplicate)
+	}
+}
+
+func TestSignatureGuardWithBloomFilterHasNoFalseNegatives(t *testing.T) {
+	guard := newTestSignatureGuardWithBloomFilter(t, NewMemStorage())
+	payments := signatureGuardPayments(500)
+	for _, payment := range payments {
+		duplicate, err := guard.CheckAndRemember(payment)
+		assert.Nil(t, err)
+		assert.False(t, duplicate)
+	}
+
+	for _, payment := range payments {
+		duplicate, err := guard.CheckAndRemember(payment)
+		assert.Nil(t, err)
+		assert.True(t, duplicate, "Replay is not detected: %v", payment)
+	}
+}
+
+func TestSignatureGuardBloomFilterMemory(t *testing.T) {
+	storage := NewMemStorage()
+	guard, err := NewSignatureGuardWithBloomFilter(storage, 1000, 0.01)
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	for _, payment := range signatureGuardPayments(1000) {
+		_, err := guard.CheckAndRemember(payment)
+		assert.Nil(t, err)
+	}
+
+	exactCacheSize := 0
+	for key, value := range storage.data {
+		exactCacheSize += len(key) + len(value)
+	}
+	bloomSize := guard.bloom.sizeInBytes()
+
+	t.Logf("bloom filter: %v bytes, exact cache: %v bytes", bloomSize, exactCacheSize)
+	assert.True(t, bloomSize*10 < exactCacheSize, "bloom filter: %v bytes, exact cache: %v bytes", bloomSize, exactCacheSize)
+}
+
+func TestSignatureGuardStorageError(t *testing.T) {
+	storage := &failingWritesAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage error")}
+	guard := newTestSignatureGuardWithBloomFilter(t, storage)
+
+	_, err := guard.CheckAndRemember(signatureGuardPayments(1)[0])
+
+	assert.Equal(t, errors.New("storage error"), err)
+}
+
+func TestSignatureGuardWithBloomFilterIncorrectFalsePositiveRate(t *testing.T) {
+	for _, rate := range []float64{0, -0.1, 1, 1.5, math.NaN()} {
+		guard, err := NewSignatureGuardWithBloomFilter(NewMemStorage(), 100, rate)
+
+		assert.Nil(t, guard)
+		assert.Equal(t, fmt.Errorf("bloom filter false positive rate should be in (0, 1) range: %v", rate), err)
+	}
+}
+
+func TestSignatureGuardWithBloomFilterDetectsReplayAfterRestart(t *testing.T) {
+	storage := NewMemStorage()
+	payments := signatureGuardPayments(10)
+	for _, payment := range payments {
+		_, err := newTestSignatureGuardWithBloomFilter(t, storage).CheckAndRemember(payment)
+		assert.Nil(t, err)
+	}
+
+	restarted := newTestSignatureGuardWithBloomFilter(t, storage)
+
+	for _, payment := range payments {
+		used, err := restarted.Used(payment)
+		assert.Nil(t, err)
+		assert.True(t, used, "Used signature is not found after restart: %v", payment)
+		duplicate, err := restarted.CheckAndRemember(payment)
+		assert.Nil(t, err)
+		assert.True(t, duplicate, "Replay is not detected after restart: %v", payment)
+	}
+}
+
+func TestSignatureGuardWithBloomFilterSharedStorage(t *testing.T) {
+	storage := NewMemStorage()
+	first := newTestSignatureGuardWithBloomFilter(t, storage)
+	second := newTestSignatureGuardWithBloomFilter(t, storage)
+	payment := signatureGuardPayments(1)[0]
+
+	duplicate, err := first.CheckAndRemember(payment)
+	assert.Nil(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = second.CheckAndRemember(payment)
+	assert.Nil(t, err)
+	assert.True(t, duplicate)
+}
+
+func TestSignatureGuardUsedDoesNotRemember(t *testing.T) {
+	guard := NewSignatureGuard(NewMemStorage())
+	payment := signatureGuardPayments(1)[0]
+
+	used, err := guard.Used(payment)
+	assert.Nil(t, err)
+	assert.False(t, used)
+
+	duplicate, err := guard.CheckAndRemember(payment)
+	assert.Nil(t, err)
+	assert.False(t, duplicate)
+
+	used, err = guard.Used(payment)
+	assert.Nil(t, err)
+	assert.True(t, used)
+}
+
+func TestSignatureGuardForget(t *testing.T) {
+	for _, guard := range []*SignatureGuard{
+		NewSignatureGuard(NewMemStorage()),
+		newTestSignatureGuardWithBloomFilter(t, NewMemStorage()),
+	} {
+		payment := signatureGuardPayments(1)[0]
+		guard.CheckAndRemember(payment)
+
+		err := guard.Forget(payment)
+
+		assert.Nil(t, err)
+		used, err := guard.Used(payment)
+		assert.Nil(t, err)
+		assert.False(t, used)
+		duplicate, err := guard.CheckAndRemember(payment)
+		assert.Nil(t, err)
+		assert.False(t, duplicate)
+	}
+}
+
+func TestValidateRejectsReplayedSignature(t *testing.T) {
+	fixtures := newTestFixtures("signature guard")
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureGuard(newTestSignatureGuardWithBloomFilter(t, NewMemStorage()))(validator)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+	assert.Nil(t, err, "Unexpected error: %v", err)
+
+	err = validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment signature is already used"), err)
+}
+
+func TestValidateDoesNotRememberRejectedPayment(t *testing.T) {
+	fixtures := newTestFixtures("signature guard")
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureGuard(NewSignatureGuard(NewMemStorage()))(validator)
+	payment := fixtures.Payment(42, 3, 12345)
+
+	err := validator.Validate(payment, fixtures.Channel(42, 3, 12300, 12300, 100))
+	assert.NotNil(t, err)
+
+	err = validator.Validate(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestValidateForgetsSignatureOfPaymentRejectedAfterGuard(t *testing.T) {
+	fixtures := newTestFixtures("signature guard")
+	validator := ChannelPaymentValidatorMock()
+	guard := NewSignatureGuard(NewMemStorage())
+	WithSignatureGuard(guard)(validator)
+	WithPaymentPersistence(NewPaymentStorage(&failingWritesAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage error")}))(validator)
+	payment := fixtures.Payment(42, 3, 12345)
+
+	err := validator.Validate(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot save payment: storage error"), err)
+	used, e := guard.Used(payment)
+	assert.Nil(t, e)
+	assert.False(t, used)
+}
+
+func TestValidateReleasedPaymentCanBeRetried(t *testing.T) {
+	fixtures := newTestFixtures("signature guard")
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureGuard(NewSignatureGuard(NewMemStorage()))(validator)
+	payment := fixtures.Payment(42, 3, 12345)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+
+	err := validator.Validate(payment, channel)
+	assert.Nil(t, err, "Unexpected error: %v", err)
+
+	err = validator.ReleasePayment(payment, channel)
+	assert.Nil(t, err, "Unexpected error: %v", err)
+
+	err = validator.Validate(payment, channel)
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestValidateReadOnlyChecksSignatureWithoutRemembering(t *testing.T) {
+	fixtures := newTestFixtures("signature guard")
+	guard := NewSignatureGuard(NewMemStorage())
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureGuard(guard)(validator)
+	WithReadOnly()(validator)
+	payment := fixtures.Payment(42, 3, 12345)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+
+	assert.Nil(t, validator.Validate(payment, channel))
+	assert.Nil(t, validator.Validate(payment, channel))
+
+	guard.CheckAndRemember(payment)
+	err := validator.Validate(payment, channel)
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment signature is already used"), err)
+}
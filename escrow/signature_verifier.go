@@ -0,0 +1,140 @@
+package escrow
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+// SignatureVerifier recovers address of the signer from the signature. It
+// allows verifying signatures outside of the daemon process, for instance
+// in HSM or remote KMS.
+type SignatureVerifier interface {
+	// RecoverSigner returns address of the key which was used to sign hash.
+	// Signature is expected to be in Ethereum [R || S || V] format.
+	RecoverSigner(hash, signature []byte) (signer common.Address, err error)
+}
+
+type localVerifier struct{}
+
+// localSignatureVerifier recovers signer using go-ethereum crypto
+// implementation, it is used by default.
+var localSignatureVerifier SignatureVerifier = &localVerifier{}
+
+// NewLocalSignatureVerifier returns SignatureVerifier which recovers signer
+// in the daemon process.
+func NewLocalSignatureVerifier() SignatureVerifier {
+	return localSignatureVerifier
+}
+
+func (verifier *localVerifier) RecoverSigner(hash, signature []byte) (signer common.Address, err error) {
+	v, _, _, e := blockchain.ParseSignature(signature)
+	if e != nil {
+		log.WithError(e).Warn("Error parsing signature")
+		return common.Address{}, errors.New("incorrect signature length")
+	}
+
+	modifiedSignature := bytes.Join([][]byte{signature[0:64], {v % 27}}, nil)
+	publicKey, e := crypto.SigToPub(hash, modifiedSignature)
+	if e != nil {
+		log.WithError(e).WithField("modifiedSignature", modifiedSignature).Warn("Incorrect signature")
+		return common.Address{}, errors.New("incorrect signature data")
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+type p256Verifier struct{}
+
+// localP256SignatureVerifier recovers signer of the payments which are signed
+// using P256 curve keys.
+var localP256SignatureVerifier SignatureVerifier = &p256Verifier{}
+
+// NewP256SignatureVerifier returns SignatureVerifier which recovers signer
+// from signature made by P256 (secp256r1) key. Signer address is calculated
+// from public key in the same way as Ethereum address.
+func NewP256SignatureVerifier() SignatureVerifier {
+	return localP256SignatureVerifier
+}
+
+func (verifier *p256Verifier) RecoverSigner(hash, signature []byte) (signer common.Address, err error) {
+	if len(signature) != 65 {
+		return common.Address{}, errors.New("incorrect signature length")
+	}
+
+	publicKey, err := recoverP256PublicKey(hash, signature[0:32], signature[32:64], signature[64])
+	if err != nil {
+		return common.Address{}, err
+	}
+	return p256PubkeyToAddress(publicKey), nil
+}
+
+// recoverP256PublicKey recovers public key from the signature as described
+// in SEC 1 v2 section 4.1.6. recoveryID is a parity of the R point Y
+// coordinate, Ethereum style 27 and 28 values are accepted as well.
+func recoverP256PublicKey(hash, rBytes, sBytes []byte, recoveryID byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+	params := curve.Params()
+
+	r := new(big.Int).SetBytes(rBytes)
+	s := new(big.Int).SetBytes(sBytes)
+	if r.Sign() == 0 || r.Cmp(params.N) >= 0 || s.Sign() == 0 || s.Cmp(params.N) >= 0 {
+		return nil, errors.New("incorrect signature data")
+	}
+	if recoveryID >= 27 {
+		recoveryID -= 27
+	}
+	if recoveryID > 1 {
+		return nil, fmt.Errorf("incorrect recovery id: %v", recoveryID)
+	}
+
+	// y^2 = x^3 - 3x + b, P256 p = 3 mod 4 so sqrt(a) = a^((p+1)/4)
+	x := new(big.Int).Set(r)
+	ySquare := new(big.Int).Exp(x, big.NewInt(3), params.P)
+	ySquare.Sub(ySquare, new(big.Int).Mul(x, big.NewInt(3)))
+	ySquare.Add(ySquare, params.B)
+	ySquare.Mod(ySquare, params.P)
+	exponent := new(big.Int).Add(params.P, big.NewInt(1))
+	exponent.Rsh(exponent, 2)
+	y := new(big.Int).Exp(ySquare, exponent, params.P)
+	if new(big.Int).Exp(y, big.NewInt(2), params.P).Cmp(ySquare) != 0 {
+		return nil, errors.New("incorrect signature data")
+	}
+	if y.Bit(0) != uint(recoveryID) {
+		y.Sub(params.P, y)
+	}
+
+	// Q = r^-1 * (s*R - e*G)
+	e := new(big.Int).SetBytes(hash)
+	sRx, sRy := curve.ScalarMult(x, y, s.Bytes())
+	eGx, eGy := curve.ScalarBaseMult(e.Bytes())
+	eGy.Sub(params.P, eGy)
+	qx, qy := curve.Add(sRx, sRy, eGx, eGy)
+	rInverse := new(big.Int).ModInverse(r, params.N)
+	qx, qy = curve.ScalarMult(qx, qy, rInverse.Bytes())
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, errors.New("incorrect signature data")
+	}
+
+	publicKey := &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}
+	if !ecdsa.Verify(publicKey, hash, r, s) {
+		return nil, errors.New("incorrect signature data")
+	}
+	return publicKey, nil
+}
+
+// p256PubkeyToAddress returns last 20 bytes of Keccak256 hash of the public
+// key coordinates, the same way Ethereum address is calculated.
+func p256PubkeyToAddress(publicKey *ecdsa.PublicKey) common.Address {
+	coordinates := append(common.LeftPadBytes(publicKey.X.Bytes(), 32), common.LeftPadBytes(publicKey.Y.Bytes(), 32)...)
+	return common.BytesToAddress(crypto.Keccak256(coordinates)[12:])
+}
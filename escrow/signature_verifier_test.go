@@ -0,0 +1,158 @@
+package escrow
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+type signatureVerifierMock struct {
+	signer common.Address
+	err    error
+	hashes [][]byte
+}
+
+func (verifier *signatureVerifierMock) RecoverSigner(hash, signature []byte) (common.Address, error) {
+	verifier.hashes = append(verifier.hashes, hash)
+	return verifier.signer, verifier.err
+}
+
+func TestLocalSignatureVerifier(t *testing.T) {
+	privateKey := GenerateTestPrivateKey()
+	hash := crypto.Keccak256([]byte("message"))
+	signature, err := crypto.Sign(hash, privateKey)
+	assert.Nil(t, err)
+	signature[64] += 27
+
+	signer, err := NewLocalSignatureVerifier().RecoverSigner(hash, signature)
+
+	assert.Nil(t, err)
+	assert.Equal(t, crypto.PubkeyToAddress(privateKey.PublicKey), signer)
+}
+
+func TestLocalSignatureVerifierIncorrectLength(t *testing.T) {
+	_, err := NewLocalSignatureVerifier().RecoverSigner(crypto.Keccak256([]byte("message")), blockchain.HexToBytes("0x0000"))
+
+	assert.Equal(t, errors.New("incorrect signature length"), err)
+}
+
+func TestValidatorUsesSignatureVerifier(t *testing.T) {
+	fixtures := newTestFixtures("verifier")
+	verifier := &signatureVerifierMock{signer: fixtures.Address("signer")}
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureVerifier(verifier)(validator)
+	payment := fixtures.Payment(42, 3, 12345)
+	payment.Signature = bytes.Repeat([]byte{1}, 65)
+
+	err := validator.Validate(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.Equal(t, 1, len(verifier.hashes))
+}
+
+func TestValidatorSignatureVerifierError(t *testing.T) {
+	fixtures := newTestFixtures("verifier")
+	verifier := &signatureVerifierMock{err: errors.New("kms is not available")}
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureVerifier(verifier)(validator)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment signature is not valid"), err)
+}
+
+// signTestPaymentP256 signs payment using P256 private key, recovery id is
+// found by trying both possible values.
+func signTestPaymentP256(payment *Payment, privateKey *ecdsa.PrivateKey) {
+	message, err := getPaymentMessage(payment)
+	if err != nil {
+		panic(fmt.Sprintf("Cannot sign incorrect test payment: %v", err))
+	}
+	hash := crypto.Keccak256(blockchain.HashPrefix32Bytes, crypto.Keccak256(message))
+
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hash)
+	if err != nil {
+		panic(fmt.Sprintf("Cannot sign test payment: %v", err))
+	}
+	rBytes, sBytes := common.LeftPadBytes(r.Bytes(), 32), common.LeftPadBytes(s.Bytes(), 32)
+	for recoveryID := byte(0); recoveryID < 2; recoveryID++ {
+		publicKey, err := recoverP256PublicKey(hash, rBytes, sBytes, recoveryID)
+		if err == nil && publicKey.X.Cmp(privateKey.X) == 0 && publicKey.Y.Cmp(privateKey.Y) == 0 {
+			payment.Signature = bytes.Join([][]byte{rBytes, sBytes, {recoveryID + 27}}, nil)
+			payment.CurveType = P256
+			return
+		}
+	}
+	panic("Cannot find recovery id of P256 signature")
+}
+
+func TestP256SignatureVerifier(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	payment := validTestPayment()
+	signTestPaymentP256(payment, privateKey)
+	message, _ := getPaymentMessage(payment)
+	hash := crypto.Keccak256(blockchain.HashPrefix32Bytes, crypto.Keccak256(message))
+
+	signer, err := NewP256SignatureVerifier().RecoverSigner(hash, payment.Signature)
+
+	assert.Nil(t, err)
+	assert.Equal(t, p256PubkeyToAddress(&privateKey.PublicKey), signer)
+}
+
+func TestP256SignatureVerifierIncorrectSignature(t *testing.T) {
+	hash := crypto.Keccak256([]byte("message"))
+
+	_, err := NewP256SignatureVerifier().RecoverSigner(hash, bytes.Repeat([]byte{0xFF}, 65))
+
+	assert.NotNil(t, err)
+}
+
+func TestValidateP256Payment(t *testing.T) {
+	fixtures := newTestFixtures("p256")
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	payment := fixtures.Payment(42, 3, 12345)
+	signTestPaymentP256(payment, privateKey)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	channel.Signer = p256PubkeyToAddress(&privateKey.PublicKey)
+
+	err = ChannelPaymentValidatorMock().Validate(payment, channel)
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+func TestValidateP256PaymentAsSecp256k1(t *testing.T) {
+	fixtures := newTestFixtures("p256")
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	payment := fixtures.Payment(42, 3, 12345)
+	signTestPaymentP256(payment, privateKey)
+	payment.CurveType = Secp256k1
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	channel.Signer = p256PubkeyToAddress(&privateKey.PublicKey)
+
+	err = ChannelPaymentValidatorMock().Validate(payment, channel)
+
+	assert.NotNil(t, err)
+}
+
+func TestValidateUnsupportedCurveType(t *testing.T) {
+	fixtures := newTestFixtures("p256")
+	payment := fixtures.Payment(42, 3, 12345)
+	payment.CurveType = CurveType(100)
+
+	err := ChannelPaymentValidatorMock().Validate(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "unsupported payment curve type: 100"), err)
+}
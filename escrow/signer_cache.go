@@ -0,0 +1,148 @@
+package escrow
+
+import (
+	"container/list"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// signerCache keeps signers recovered from payments grouped by channel, so
+// signature of the same payment is not recovered twice. Cache key is built
+// from signed message and signature, so different payments never share the
+// same entry. Cache keeps at most size entries, least recently used entry
+// is evicted when cache is full.
+type signerCache struct {
+	mutex    sync.Mutex
+	size     int
+	lru      *list.List
+	channels map[string]map[string]*list.Element
+}
+
+type signerCacheEntry struct {
+	channelID string
+	key       string
+	signer    common.Address
+}
+
+func newSignerCache(size int) *signerCache {
+	return &signerCache{
+		size:     size,
+		lru:      list.New(),
+		channels: make(map[string]map[string]*list.Element),
+	}
+}
+
+func signerCacheKey(payment *Payment) (key string, err error) {
+	message, err := getPaymentMessage(payment)
+	if err != nil {
+		return
+	}
+	return fmt.Sprintf("%v/%x/%x", payment.CurveType, message, payment.Signature), nil
+}
+
+func (cache *signerCache) get(payment *Payment) (signer common.Address, ok bool) {
+	key, err := signerCacheKey(payment)
+	if err != nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.channels[payment.ChannelID.String()][key]
+	if !ok {
+		return
+	}
+	cache.lru.MoveToFront(element)
+	return element.Value.(*signerCacheEntry).signer, true
+}
+
+func (cache *signerCache) put(payment *Payment, signer common.Address) {
+	key, err := signerCacheKey(payment)
+	if err != nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	channelID := payment.ChannelID.String()
+	channel, ok := cache.channels[channelID]
+	if !ok {
+		channel = make(map[string]*list.Element)
+		cache.channels[channelID] = channel
+	}
+	if element, ok := channel[key]; ok {
+		element.Value.(*signerCacheEntry).signer = signer
+		cache.lru.MoveToFront(element)
+		return
+	}
+	channel[key] = cache.lru.PushFront(&signerCacheEntry{channelID: channelID, key: key, signer: signer})
+
+	for cache.lru.Len() > cache.size {
+		cache.remove(cache.lru.Back())
+	}
+}
+
+func (cache *signerCache) invalidate(channelID *big.Int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for _, element := range cache.channels[channelID.String()] {
+		cache.remove(element)
+	}
+}
+
+func (cache *signerCache) remove(element *list.Element) {
+	entry := cache.lru.Remove(element).(*signerCacheEntry)
+	channel := cache.channels[entry.channelID]
+	delete(channel, entry.key)
+	if len(channel) == 0 {
+		delete(cache.channels, entry.channelID)
+	}
+}
+
+// WarmCaches recovers signers of the recent payments kept in the storage
+// and puts them into the signer cache, so validation of these payments
+// after restart doesn't recover signatures again. Payments of the latest
+// nonce of each channel are considered recent. Payments which signer cannot
+// be recovered are skipped. It does nothing if validator is created without
+// WithSignerCache option.
+func (validator *ChannelPaymentValidator) WarmCaches(storage *PaymentStorage) error {
+	if validator.signerCache == nil {
+		return nil
+	}
+
+	payments, err := storage.GetAll()
+	if err != nil {
+		return err
+	}
+
+	recent := make(map[string][]*Payment)
+	for _, payment := range payments {
+		channelID := payment.ChannelID.String()
+		if latest := recent[channelID]; len(latest) > 0 {
+			cmp := payment.ChannelNonce.Cmp(latest[0].ChannelNonce)
+			if cmp < 0 {
+				continue
+			}
+			if cmp > 0 {
+				recent[channelID] = nil
+			}
+		}
+		recent[channelID] = append(recent[channelID], payment)
+	}
+
+	for _, channelPayments := range recent {
+		for _, payment := range channelPayments {
+			if _, e := validator.getSignerAddressFromPayment(payment); e != nil {
+				log.WithField("payment", payment).WithError(e).Warn("Cannot recover signer of the stored payment")
+			}
+		}
+	}
+	return nil
+}
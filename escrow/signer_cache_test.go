@@ -0,0 +1,139 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignerCacheInvalidateChannel(t *testing.T) {
+	fixtures := newTestFixtures("signer-cache")
+	validator := ChannelPaymentValidatorMock()
+	WithSignerCache(16)(validator)
+	oldSignerPayment := fixtures.Payment(42, 3, 12345)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	assert.Nil(t, validator.Validate(oldSignerPayment, channel))
+
+	channel.Signer = fixtures.Address("new signer")
+	validator.InvalidateChannel(big.NewInt(42))
+	newSignerPayment := fixtures.Payment(42, 3, 12345)
+	SignTestPayment(newSignerPayment, fixtures.PrivateKey("new signer"))
+
+	assert.Nil(t, validator.Validate(newSignerPayment, channel))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), validator.Validate(oldSignerPayment, channel))
+}
+
+func TestSignerCacheGetPut(t *testing.T) {
+	fixtures := newTestFixtures("signer-cache")
+	cache := newSignerCache(16)
+	payment := fixtures.Payment(42, 3, 12345)
+	another := fixtures.Payment(42, 3, 12346)
+
+	cache.put(payment, fixtures.Address("signer"))
+
+	signer, ok := cache.get(payment)
+	assert.True(t, ok)
+	assert.Equal(t, fixtures.Address("signer"), signer)
+	_, ok = cache.get(another)
+	assert.False(t, ok)
+}
+
+func TestSignerCacheInvalidateKeepsOtherChannels(t *testing.T) {
+	fixtures := newTestFixtures("signer-cache")
+	cache := newSignerCache(16)
+	paymentA := fixtures.Payment(42, 3, 12345)
+	paymentB := fixtures.Payment(43, 3, 12345)
+	cache.put(paymentA, fixtures.Address("signer"))
+	cache.put(paymentB, fixtures.Address("signer"))
+
+	cache.invalidate(big.NewInt(42))
+
+	_, ok := cache.get(paymentA)
+	assert.False(t, ok)
+	_, ok = cache.get(paymentB)
+	assert.True(t, ok)
+}
+
+func TestSignerCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	fixtures := newTestFixtures("signer-cache")
+	cache := newSignerCache(2)
+	paymentA := fixtures.Payment(42, 3, 12345)
+	paymentB := fixtures.Payment(43, 3, 12345)
+	paymentC := fixtures.Payment(42, 3, 12346)
+	cache.put(paymentA, fixtures.Address("signer"))
+	cache.put(paymentB, fixtures.Address("signer"))
+	cache.get(paymentA)
+
+	cache.put(paymentC, fixtures.Address("signer"))
+
+	_, ok := cache.get(paymentA)
+	assert.True(t, ok)
+	_, ok = cache.get(paymentB)
+	assert.False(t, ok)
+	_, ok = cache.get(paymentC)
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.lru.Len())
+	assert.Equal(t, 1, len(cache.channels))
+}
+
+func TestSignerCacheInvalidateFreesSpace(t *testing.T) {
+	fixtures := newTestFixtures("signer-cache")
+	cache := newSignerCache(2)
+	cache.put(fixtures.Payment(42, 3, 12345), fixtures.Address("signer"))
+	cache.put(fixtures.Payment(42, 3, 12346), fixtures.Address("signer"))
+
+	cache.invalidate(big.NewInt(42))
+
+	assert.Equal(t, 0, cache.lru.Len())
+	assert.Empty(t, cache.channels)
+}
+
+func TestWarmCaches(t *testing.T) {
+	fixtures := newTestFixtures("signer-cache")
+	storage := NewPaymentStorage(NewMemStorage())
+	old := fixtures.Payment(42, 2, 12000)
+	recent := fixtures.Payment(42, 3, 12345)
+	another := fixtures.Payment(43, 1, 100)
+	for _, payment := range []*Payment{old, recent, another} {
+		assert.Nil(t, storage.Put(payment))
+	}
+	verifier := &signatureVerifierMock{signer: fixtures.Address("signer")}
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureVerifier(verifier)(validator)
+	WithSignerCache(16)(validator)
+
+	err := validator.WarmCaches(storage)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(verifier.hashes))
+	assert.Nil(t, validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100)))
+	assert.Nil(t, validator.Validate(fixtures.Payment(43, 1, 100), fixtures.Channel(43, 1, 100, 0, 100)))
+	assert.Equal(t, 2, len(verifier.hashes))
+	assert.Nil(t, validator.Validate(fixtures.Payment(42, 2, 12000), fixtures.Channel(42, 2, 12000, 11000, 100)))
+	assert.Equal(t, 3, len(verifier.hashes))
+}
+
+func TestWarmCachesWithoutSignerCache(t *testing.T) {
+	fixtures := newTestFixtures("signer-cache")
+	storage := NewPaymentStorage(NewMemStorage())
+	assert.Nil(t, storage.Put(fixtures.Payment(42, 3, 12345)))
+	verifier := &signatureVerifierMock{signer: fixtures.Address("signer")}
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureVerifier(verifier)(validator)
+
+	err := validator.WarmCaches(storage)
+
+	assert.Nil(t, err)
+	assert.Empty(t, verifier.hashes)
+}
+
+func TestWarmCachesStorageError(t *testing.T) {
+	validator := ChannelPaymentValidatorMock()
+	WithSignerCache(16)(validator)
+
+	err := validator.WarmCaches(NewPaymentStorage(&failingReadsAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage is unavailable")}))
+
+	assert.Equal(t, errors.New("storage is unavailable"), err)
+}
@@ -0,0 +1,36 @@
+package escrow
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DelegateResolver returns addresses which are currently authorized to sign
+// payments on behalf of the channel signer, for instance using on-chain
+// registry.
+type DelegateResolver interface {
+	// Delegates returns authorized delegates of the signer
+	Delegates(signer common.Address) (delegates []common.Address, err error)
+}
+
+// isChannelSigner returns true if payment signer is the channel payment
+// signer or one of its delegates returned by DelegateResolver.
+func (validator *ChannelPaymentValidator) isChannelSigner(signer *common.Address, channel *PaymentChannelData) (ok bool, err error) {
+	channelSigner := channel.PaymentSignerAddress()
+	if *signer == channelSigner {
+		return true, nil
+	}
+	if validator.delegateResolver == nil {
+		return false, nil
+	}
+
+	delegates, err := validator.delegateResolver.Delegates(channelSigner)
+	if err != nil {
+		return false, err
+	}
+	for _, delegate := range delegates {
+		if delegate == *signer {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,98 @@
+package escrow
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type delegateRegistryMock struct {
+	delegates map[common.Address][]common.Address
+	err       error
+}
+
+func (registry *delegateRegistryMock) Delegates(signer common.Address) ([]common.Address, error) {
+	return registry.delegates[signer], registry.err
+}
+
+func (registry *delegateRegistryMock) authorize(signer, delegate common.Address) {
+	registry.delegates[signer] = append(registry.delegates[signer], delegate)
+}
+
+func (registry *delegateRegistryMock) deauthorize(signer, delegate common.Address) {
+	delegates := registry.delegates[signer][:0]
+	for _, authorized := range registry.delegates[signer] {
+		if authorized != delegate {
+			delegates = append(delegates, authorized)
+		}
+	}
+	registry.delegates[signer] = delegates
+}
+
+type SignerDelegationSuite struct {
+	suite.Suite
+
+	fixtures  *testFixtures
+	registry  *delegateRegistryMock
+	validator *ChannelPaymentValidator
+	channel   *PaymentChannelData
+}
+
+func TestSignerDelegationSuite(t *testing.T) {
+	suite.Run(t, new(SignerDelegationSuite))
+}
+
+func (suite *SignerDelegationSuite) SetupTest() {
+	suite.fixtures = newTestFixtures("delegation")
+	suite.registry = &delegateRegistryMock{delegates: map[common.Address][]common.Address{}}
+	suite.validator = ChannelPaymentValidatorMock()
+	WithDelegateResolver(suite.registry)(suite.validator)
+	// payments are signed by "signer" fixture
+	suite.channel = suite.fixtures.Channel(42, 3, 12345, 12300, 100)
+	suite.channel.Signer = suite.fixtures.Address("owner")
+}
+
+func (suite *SignerDelegationSuite) TestPaymentSignedByAuthorizedDelegate() {
+	suite.registry.authorize(suite.fixtures.Address("owner"), suite.fixtures.Address("signer"))
+
+	err := suite.validator.Validate(suite.fixtures.Payment(42, 3, 12345), suite.channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *SignerDelegationSuite) TestPaymentSignedByDeauthorizedDelegate() {
+	suite.registry.authorize(suite.fixtures.Address("owner"), suite.fixtures.Address("signer"))
+	suite.registry.deauthorize(suite.fixtures.Address("owner"), suite.fixtures.Address("signer"))
+
+	err := suite.validator.Validate(suite.fixtures.Payment(42, 3, 12345), suite.channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func (suite *SignerDelegationSuite) TestPaymentSignedByDelegateOfAnotherSigner() {
+	suite.registry.authorize(suite.fixtures.Address("another owner"), suite.fixtures.Address("signer"))
+
+	err := suite.validator.Validate(suite.fixtures.Payment(42, 3, 12345), suite.channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func (suite *SignerDelegationSuite) TestResolverError() {
+	suite.registry.err = errors.New("registry is not available")
+
+	err := suite.validator.Validate(suite.fixtures.Payment(42, 3, 12345), suite.channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot resolve signer delegates: registry is not available"), err)
+}
+
+func (suite *SignerDelegationSuite) TestResolverIsNotCalledForChannelSigner() {
+	suite.registry.err = errors.New("registry is not available")
+	suite.channel.Signer = suite.fixtures.Address("signer")
+
+	err := suite.validator.Validate(suite.fixtures.Payment(42, 3, 12345), suite.channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
@@ -0,0 +1,96 @@
+package escrow
+
+import (
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const signerRotationStorageKeyPrefix = "/payment/signer-rotation"
+
+// RotationWindow describes rotation of the channel payment signer key.
+// Before EffectiveBlock only payments signed by OldSigner are accepted.
+// Starting from EffectiveBlock payments signed by both keys are accepted
+// during the rotation window, after the window is over only NewSigner is
+// accepted.
+type RotationWindow struct {
+	OldSigner      common.Address
+	NewSigner      common.Address
+	EffectiveBlock *big.Int
+}
+
+// acceptedSigners returns signers which are accepted at the block, window
+// is a length of the rotation window in blocks.
+func (rotation *RotationWindow) acceptedSigners(block *big.Int, window int64) []common.Address {
+	if block.Cmp(rotation.EffectiveBlock) < 0 {
+		return []common.Address{rotation.OldSigner}
+	}
+	windowEnd := new(big.Int).Add(rotation.EffectiveBlock, big.NewInt(window))
+	if block.Cmp(windowEnd) < 0 {
+		return []common.Address{rotation.OldSigner, rotation.NewSigner}
+	}
+	return []common.Address{rotation.NewSigner}
+}
+
+func (rotation *RotationWindow) accepts(signer *common.Address, block *big.Int, window int64) bool {
+	for _, accepted := range rotation.acceptedSigners(block, window) {
+		if accepted == *signer {
+			return true
+		}
+	}
+	return false
+}
+
+// SignerRotationStorage keeps signer rotation windows by channel id.
+type SignerRotationStorage struct {
+	delegate TypedAtomicStorage
+}
+
+// NewSignerRotationStorage returns new instance of SignerRotationStorage
+func NewSignerRotationStorage(atomicStorage AtomicStorage) *SignerRotationStorage {
+	return &SignerRotationStorage{
+		delegate: &TypedAtomicStorageImpl{
+			atomicStorage: &PrefixedAtomicStorage{
+				delegate:  atomicStorage,
+				keyPrefix: signerRotationStorageKeyPrefix,
+			},
+			keySerializer:     serializeStringKey,
+			valueSerializer:   serialize,
+			valueDeserializer: deserialize,
+			valueType:         reflect.TypeOf(RotationWindow{}),
+		},
+	}
+}
+
+// Get returns rotation window of the channel, ok is false if channel signer
+// is not being rotated.
+func (storage *SignerRotationStorage) Get(channelID *big.Int) (rotation *RotationWindow, ok bool, err error) {
+	value, ok, err := storage.delegate.Get(channelID.String())
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return value.(*RotationWindow), true, nil
+}
+
+// Put starts rotation of the channel signer, previous rotation of the
+// channel is replaced.
+func (storage *SignerRotationStorage) Put(channelID *big.Int, rotation *RotationWindow) (err error) {
+	return storage.delegate.Put(channelID.String(), rotation)
+}
+
+// Delete removes rotation window of the channel, it is called when rotation
+// is finished and channel signer is updated.
+func (storage *SignerRotationStorage) Delete(channelID *big.Int) (err error) {
+	return storage.delegate.Delete(channelID.String())
+}
+
+// signerRotation returns rotation window of the channel or nil if rotation
+// storage is not set or channel signer is not being rotated.
+func (validator *ChannelPaymentValidator) signerRotation(channel *PaymentChannelData) (rotation *RotationWindow, err error) {
+	if validator.signerRotations == nil {
+		return nil, nil
+	}
+	rotation, _, err = validator.signerRotations.Get(channel.ChannelID)
+	return
+}
@@ -0,0 +1,132 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+func signerRotationFixture(t *testing.T) (fixtures *testFixtures, validator *ChannelPaymentValidator) {
+	fixtures = newTestFixtures("rotation")
+	rotations := NewSignerRotationStorage(NewMemStorage())
+	err := rotations.Put(big.NewInt(42), &RotationWindow{
+		OldSigner:      fixtures.Address("old signer"),
+		NewSigner:      fixtures.Address("new signer"),
+		EffectiveBlock: big.NewInt(100),
+	})
+	assert.Nil(t, err, "Unexpected error: %v", err)
+
+	validator = ChannelPaymentValidatorMock()
+	WithSignerRotations(rotations, 10)(validator)
+	return
+}
+
+func paymentSignedBy(fixtures *testFixtures, signer string) *Payment {
+	payment := fixtures.Payment(42, 3, 12345)
+	SignTestPayment(payment, fixtures.PrivateKey(signer))
+	return payment
+}
+
+func TestSignerRotationStorage(t *testing.T) {
+	fixtures := newTestFixtures("rotation")
+	rotations := NewSignerRotationStorage(NewMemStorage())
+	rotation := &RotationWindow{
+		OldSigner:      fixtures.Address("old signer"),
+		NewSigner:      fixtures.Address("new signer"),
+		EffectiveBlock: big.NewInt(100),
+	}
+
+	assert.Nil(t, rotations.Put(big.NewInt(42), rotation))
+	stored, ok, err := rotations.Get(big.NewInt(42))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, rotation, stored)
+
+	assert.Nil(t, rotations.Delete(big.NewInt(42)))
+	_, ok, err = rotations.Get(big.NewInt(42))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestSignerRotationBeforeWindow(t *testing.T) {
+	fixtures, validator := signerRotationFixture(t)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 1000)
+
+	assert.Nil(t, validator.ValidateAtBlock(paymentSignedBy(fixtures, "old signer"), channel, big.NewInt(99)))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment is not signed by channel signer"),
+		validator.ValidateAtBlock(paymentSignedBy(fixtures, "new signer"), channel, big.NewInt(99)))
+}
+
+func TestSignerRotationDuringWindow(t *testing.T) {
+	fixtures, validator := signerRotationFixture(t)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 1000)
+
+	for _, block := range []int64{100, 109} {
+		assert.Nil(t, validator.ValidateAtBlock(paymentSignedBy(fixtures, "old signer"), channel, big.NewInt(block)))
+		assert.Nil(t, validator.ValidateAtBlock(paymentSignedBy(fixtures, "new signer"), channel, big.NewInt(block)))
+	}
+}
+
+func TestSignerRotationAfterWindow(t *testing.T) {
+	fixtures, validator := signerRotationFixture(t)
+	channel := fixtures.Channel(42, 3, 12345, 12300, 1000)
+
+	assert.Nil(t, validator.ValidateAtBlock(paymentSignedBy(fixtures, "new signer"), channel, big.NewInt(110)))
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment is not signed by channel signer"),
+		validator.ValidateAtBlock(paymentSignedBy(fixtures, "old signer"), channel, big.NewInt(110)))
+}
+
+func TestSignerRotationReplacesChannelSigner(t *testing.T) {
+	fixtures, validator := signerRotationFixture(t)
+
+	err := validator.ValidateAtBlock(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(105))
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func TestSignerRotationIsNotAppliedToOtherChannels(t *testing.T) {
+	fixtures, validator := signerRotationFixture(t)
+
+	err := validator.ValidateAtBlock(fixtures.Payment(43, 3, 12345), fixtures.Channel(43, 3, 12345, 12300, 1000), big.NewInt(105))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
+
+type failingGetAtomicStorage struct {
+	AtomicStorage
+	err error
+}
+
+func (storage *failingGetAtomicStorage) Get(key string) (value string, ok bool, err error) {
+	return "", false, storage.err
+}
+
+func TestSignerRotationStorageError(t *testing.T) {
+	fixtures := newTestFixtures("rotation")
+	validator := ChannelPaymentValidatorMock()
+	storage := &failingGetAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage is not available")}
+	WithSignerRotations(NewSignerRotationStorage(storage), 10)(validator)
+
+	err := validator.ValidateAtBlock(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 1000), big.NewInt(105))
+
+	assert.Equal(t, NewPaymentError(Internal, "cannot read signer rotation window: storage is not available"), err)
+}
+
+func TestDiagnoseRotatedSigner(t *testing.T) {
+	fixtures, validator := signerRotationFixture(t)
+	oldSigner := fixtures.Address("old signer")
+	newSigner := fixtures.Address("new signer")
+
+	report := validator.Diagnose(paymentSignedBy(fixtures, "new signer"), fixtures.Channel(42, 3, 12345, 12300, 1000))
+
+	assert.Equal(t, ValidationReportEntry{
+		Check:  "signer",
+		Passed: false,
+		Detail: "payment is not signed by channel signer, payment signer: " + blockchain.AddressToHex(&newSigner) +
+			", signer is rotated from " + blockchain.AddressToHex(&oldSigner) + " to " + blockchain.AddressToHex(&newSigner) + " at block 100, current block: 99",
+	}, report.Entries[2])
+}
@@ -0,0 +1,177 @@
+package escrow
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+const spendingCapStorageKeyPrefix = "/payment/signer-spending"
+
+// SpendingCapTracker keeps total amount authorized by each payment signer
+// across all channels and limits it by the cap. It allows operators to limit
+// exposure to a single signer which opens many channels.
+type SpendingCapTracker struct {
+	storage TypedAtomicStorage
+	limit   *big.Int
+}
+
+// signerSpending is a record of the tracker storage.
+type signerSpending struct {
+	Authorized *big.Int
+}
+
+// NewSpendingCapTracker returns new instance of SpendingCapTracker which
+// keeps totals in the storage and does not allow them to exceed the limit.
+func NewSpendingCapTracker(atomicStorage AtomicStorage, limit *big.Int) *SpendingCapTracker {
+	return &SpendingCapTracker{
+		storage: &TypedAtomicStorageImpl{
+			atomicStorage: &PrefixedAtomicStorage{
+				delegate:  atomicStorage,
+				keyPrefix: spendingCapStorageKeyPrefix,
+			},
+			keySerializer:     serializeStringKey,
+			valueSerializer:   serialize,
+			valueDeserializer: deserialize,
+			valueType:         reflect.TypeOf(signerSpending{}),
+		},
+		limit: limit,
+	}
+}
+
+// Spent returns total amount authorized by the signer.
+func (tracker *SpendingCapTracker) Spent(signer common.Address) (spent *big.Int, err error) {
+	spending, ok, err := tracker.get(signer)
+	if err != nil || !ok {
+		return big.NewInt(0), err
+	}
+	return spending.Authorized, nil
+}
+
+// Authorize adds increment to the total amount authorized by the signer.
+// Total is not changed and exceeded is true if new total would exceed the
+// cap. total contains the current total in both cases. Increment should be
+// positive.
+func (tracker *SpendingCapTracker) Authorize(signer common.Address, increment *big.Int) (total *big.Int, exceeded bool, err error) {
+	if increment.Sign() <= 0 {
+		return nil, false, fmt.Errorf("spending increment %v is not positive", increment)
+	}
+	key := blockchain.AddressToHex(&signer)
+	for {
+		spending, ok, e := tracker.get(signer)
+		if e != nil {
+			return nil, false, e
+		}
+
+		var spent = big.NewInt(0)
+		if ok {
+			spent = spending.Authorized
+		}
+		total = new(big.Int).Add(spent, increment)
+		if total.Cmp(tracker.limit) > 0 {
+			return spent, true, nil
+		}
+
+		updated := &signerSpending{Authorized: total}
+		if ok {
+			ok, e = tracker.storage.CompareAndSwap(key, spending, updated)
+		} else {
+			ok, e = tracker.storage.PutIfAbsent(key, updated)
+		}
+		if e != nil {
+			return nil, false, e
+		}
+		if ok {
+			return total, false, nil
+		}
+	}
+}
+
+// Refund subtracts amount from the total authorized by the signer, it is
+// used when authorized payment is not committed. Total never becomes
+// negative. Amount should be positive.
+func (tracker *SpendingCapTracker) Refund(signer common.Address, amount *big.Int) (err error) {
+	if amount.Sign() <= 0 {
+		return fmt.Errorf("refund amount %v is not positive", amount)
+	}
+	key := blockchain.AddressToHex(&signer)
+	for {
+		spending, ok, e := tracker.get(signer)
+		if e != nil || !ok {
+			return e
+		}
+
+		total := new(big.Int).Sub(spending.Authorized, amount)
+		if total.Sign() < 0 {
+			total = big.NewInt(0)
+		}
+		ok, e = tracker.storage.CompareAndSwap(key, spending, &signerSpending{Authorized: total})
+		if e != nil || ok {
+			return e
+		}
+	}
+}
+
+// exceeds returns true if adding increment to the total amount authorized by
+// the signer would exceed the cap, total is not changed.
+func (tracker *SpendingCapTracker) exceeds(signer common.Address, increment *big.Int) (exceeded bool, err error) {
+	spent, err := tracker.Spent(signer)
+	if err != nil {
+		return false, err
+	}
+	return new(big.Int).Add(spent, increment).Cmp(tracker.limit) > 0, nil
+}
+
+func (tracker *SpendingCapTracker) get(signer common.Address) (spending *signerSpending, ok bool, err error) {
+	value, ok, err := tracker.storage.Get(blockchain.AddressToHex(&signer))
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return value.(*signerSpending), true, nil
+}
+
+// chargeSpendingCap adds payment increment to the total authorized by the
+// signer, payment is rejected if total would exceed the cap. In read-only
+// mode the cap is checked but total is not changed. Payment which does not
+// increase channel authorized amount is not charged.
+func (validator *ChannelPaymentValidator) chargeSpendingCap(signer *common.Address, payment *Payment, channel *PaymentChannelData) *PaymentError {
+	if validator.spendingCaps == nil {
+		return nil
+	}
+
+	increment := new(big.Int).Sub(payment.Amount, channel.AuthorizedAmount)
+	if increment.Sign() <= 0 {
+		return nil
+	}
+	var exceeded bool
+	var err error
+	if validator.readOnly {
+		exceeded, err = validator.spendingCaps.exceeds(*signer, increment)
+	} else {
+		_, exceeded, err = validator.spendingCaps.Authorize(*signer, increment)
+	}
+	if err != nil {
+		return NewPaymentError(Internal, "cannot read signer spending: %v", err)
+	}
+	if exceeded {
+		return NewPaymentError(SpendingCapExceeded, "payment signer %v exceeds spending cap %v", blockchain.AddressToHex(signer), validator.spendingCaps.limit)
+	}
+	return nil
+}
+
+// refundSpendingCap returns payment increment charged by chargeSpendingCap
+// to the signer total.
+func (validator *ChannelPaymentValidator) refundSpendingCap(signer *common.Address, payment *Payment, channel *PaymentChannelData) error {
+	if validator.spendingCaps == nil || validator.readOnly {
+		return nil
+	}
+	increment := new(big.Int).Sub(payment.Amount, channel.AuthorizedAmount)
+	if increment.Sign() <= 0 {
+		return nil
+	}
+	return validator.spendingCaps.Refund(*signer, increment)
+}
@@ -0,0 +1,136 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendingCapTrackerAuthorize(t *testing.T) {
+	signer := newTestFixtures("spending").Address("signer")
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+
+	total, exceeded, err := tracker.Authorize(signer, big.NewInt(60))
+	assert.Nil(t, err)
+	assert.False(t, exceeded)
+	assert.Equal(t, big.NewInt(60), total)
+
+	total, exceeded, err = tracker.Authorize(signer, big.NewInt(41))
+	assert.Nil(t, err)
+	assert.True(t, exceeded)
+	assert.Equal(t, big.NewInt(60), total)
+
+	total, exceeded, err = tracker.Authorize(signer, big.NewInt(40))
+	assert.Nil(t, err)
+	assert.False(t, exceeded)
+	assert.Equal(t, big.NewInt(100), total)
+}
+
+func TestSpendingCapTrackerAuthorizeNonPositiveIncrement(t *testing.T) {
+	signer := newTestFixtures("spending").Address("signer")
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+	_, _, err := tracker.Authorize(signer, big.NewInt(60))
+	assert.Nil(t, err)
+
+	_, _, errZero := tracker.Authorize(signer, big.NewInt(0))
+	_, _, errNegative := tracker.Authorize(signer, big.NewInt(-20))
+
+	assert.Equal(t, errors.New("spending increment 0 is not positive"), errZero)
+	assert.Equal(t, errors.New("spending increment -20 is not positive"), errNegative)
+	spent, _ := tracker.Spent(signer)
+	assert.Equal(t, big.NewInt(60), spent)
+}
+
+func TestSpendingCapTrackerKeepsSignersSeparately(t *testing.T) {
+	fixtures := newTestFixtures("spending")
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+
+	_, _, err := tracker.Authorize(fixtures.Address("first"), big.NewInt(100))
+	assert.Nil(t, err)
+	_, exceeded, err := tracker.Authorize(fixtures.Address("second"), big.NewInt(100))
+
+	assert.Nil(t, err)
+	assert.False(t, exceeded)
+}
+
+func TestSpendingCapTrackerRefund(t *testing.T) {
+	signer := newTestFixtures("spending").Address("signer")
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+	_, _, err := tracker.Authorize(signer, big.NewInt(60))
+	assert.Nil(t, err)
+
+	err = tracker.Refund(signer, big.NewInt(20))
+	assert.Nil(t, err)
+	spent, _ := tracker.Spent(signer)
+	assert.Equal(t, big.NewInt(40), spent)
+
+	err = tracker.Refund(signer, big.NewInt(50))
+	assert.Nil(t, err)
+	spent, _ = tracker.Spent(signer)
+	assert.Equal(t, big.NewInt(0), spent)
+}
+
+func TestSpendingCapTrackerRefundNonPositiveAmount(t *testing.T) {
+	signer := newTestFixtures("spending").Address("signer")
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+	_, _, err := tracker.Authorize(signer, big.NewInt(60))
+	assert.Nil(t, err)
+
+	errZero := tracker.Refund(signer, big.NewInt(0))
+	errNegative := tracker.Refund(signer, big.NewInt(-20))
+
+	assert.Equal(t, errors.New("refund amount 0 is not positive"), errZero)
+	assert.Equal(t, errors.New("refund amount -20 is not positive"), errNegative)
+	spent, _ := tracker.Spent(signer)
+	assert.Equal(t, big.NewInt(60), spent)
+}
+
+func TestSpendingCapTrackerRefundUnknownSigner(t *testing.T) {
+	signer := newTestFixtures("spending").Address("signer")
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+
+	err := tracker.Refund(signer, big.NewInt(20))
+
+	assert.Nil(t, err)
+	spent, _ := tracker.Spent(signer)
+	assert.Equal(t, big.NewInt(0), spent)
+}
+
+func TestSpendingCapTrackerSpentOfUnknownSigner(t *testing.T) {
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+
+	spent, err := tracker.Spent(newTestFixtures("spending").Address("signer"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(0), spent)
+}
+
+func TestSpendingCapTrackerAuthorizeConcurrently(t *testing.T) {
+	signer := newTestFixtures("spending").Address("signer")
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+
+	var mutex sync.Mutex
+	accepted := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, exceeded, err := tracker.Authorize(signer, big.NewInt(10))
+			assert.Nil(t, err)
+			if !exceeded {
+				mutex.Lock()
+				accepted++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, accepted)
+	spent, _ := tracker.Spent(signer)
+	assert.Equal(t, big.NewInt(100), spent)
+}
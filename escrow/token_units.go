@@ -0,0 +1,94 @@
+package escrow
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultTokenDecimals is a number of decimal places of AGI token. Prices in
+// daemon configuration are expressed in cogs of this token.
+const DefaultTokenDecimals = 8
+
+// CogsToToken converts amount in cogs into the decimal string in tokens.
+// decimals is a number of decimal places of the token, for instance AGI
+// token has 8 decimals. Trailing zeros of fractional part are removed.
+func CogsToToken(amount *big.Int, decimals int) string {
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	digits := new(big.Int).Abs(amount).String()
+	if decimals <= 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	integer := digits[:len(digits)-decimals]
+	fraction := strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if fraction == "" {
+		return sign + integer
+	}
+	return sign + integer + "." + fraction
+}
+
+// TokenToCogs converts decimal string in tokens into amount in cogs. It
+// returns error if string is not a decimal number or if it has more
+// fractional digits than decimals.
+func TokenToCogs(s string, decimals int) (*big.Int, error) {
+	if decimals < 0 {
+		return nil, fmt.Errorf("incorrect number of decimals: %v", decimals)
+	}
+
+	number := s
+	negative := strings.HasPrefix(number, "-")
+	if negative {
+		number = number[1:]
+	}
+
+	integer, fraction := number, ""
+	if index := strings.Index(number, "."); index >= 0 {
+		integer, fraction = number[:index], number[index+1:]
+	}
+	if (integer == "" && fraction == "") || !isDecimalDigits(integer) || !isDecimalDigits(fraction) {
+		return nil, fmt.Errorf("incorrect token amount: \"%v\"", s)
+	}
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("too many decimal places in token amount: \"%v\", maximum: %v", s, decimals)
+	}
+
+	cogs, _ := new(big.Int).SetString(integer+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+	if negative {
+		cogs.Neg(cogs)
+	}
+	return cogs, nil
+}
+
+func isDecimalDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareTokenAmounts compares amount a expressed in token with aDecimals
+// decimal places with amount b expressed in token with bDecimals decimal
+// places. Amounts are scaled to the larger number of decimals so no
+// precision is lost. Result is -1, 0 or 1 as for big.Int.Cmp.
+func CompareTokenAmounts(a *big.Int, aDecimals int, b *big.Int, bDecimals int) int {
+	if aDecimals < bDecimals {
+		a = scaleTokenAmount(a, bDecimals-aDecimals)
+	} else if bDecimals < aDecimals {
+		b = scaleTokenAmount(b, aDecimals-bDecimals)
+	}
+	return a.Cmp(b)
+}
+
+func scaleTokenAmount(amount *big.Int, decimals int) *big.Int {
+	multiplier := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Int).Mul(amount, multiplier)
+}
@@ -0,0 +1,86 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bigIntFromString(s string) *big.Int {
+	value, _ := new(big.Int).SetString(s, 10)
+	return value
+}
+
+func TestCogsToToken(t *testing.T) {
+	assert.Equal(t, "1.23456789", CogsToToken(big.NewInt(123456789), 8))
+	assert.Equal(t, "1", CogsToToken(big.NewInt(100000000), 8))
+	assert.Equal(t, "0.5", CogsToToken(big.NewInt(50000000), 8))
+	assert.Equal(t, "0.00000001", CogsToToken(big.NewInt(1), 8))
+	assert.Equal(t, "0", CogsToToken(big.NewInt(0), 8))
+	assert.Equal(t, "-0.5", CogsToToken(big.NewInt(-50000000), 8))
+	assert.Equal(t, "12345", CogsToToken(big.NewInt(12345), 0))
+	assert.Equal(t, "1000000000000000000000.000000000000000001", CogsToToken(bigIntFromString("1000000000000000000000000000000000000001"), 18))
+}
+
+func TestTokenToCogs(t *testing.T) {
+	for s, expected := range map[string]*big.Int{
+		"1.23456789": big.NewInt(123456789),
+		"1":          big.NewInt(100000000),
+		"1.":         big.NewInt(100000000),
+		".5":         big.NewInt(50000000),
+		"0.00000001": big.NewInt(1),
+		"-0.5":       big.NewInt(-50000000),
+	} {
+		cogs, err := TokenToCogs(s, 8)
+
+		assert.Nil(t, err, "Unexpected error for %v: %v", s, err)
+		assert.Equal(t, expected, cogs, "Incorrect result for %v", s)
+	}
+}
+
+func TestTokenToCogsRoundTrip(t *testing.T) {
+	for _, amount := range []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(123456789), big.NewInt(-42), bigIntFromString("1000000000000000000000000000000000000001")} {
+		cogs, err := TokenToCogs(CogsToToken(amount, 18), 18)
+
+		assert.Nil(t, err)
+		assert.Equal(t, amount, cogs)
+	}
+}
+
+func TestTokenToCogsTooManyDecimalPlaces(t *testing.T) {
+	_, err := TokenToCogs("0.000000001", 8)
+
+	assert.Equal(t, errors.New("too many decimal places in token amount: \"0.000000001\", maximum: 8"), err)
+}
+
+func TestTokenToCogsInvalidInput(t *testing.T) {
+	for _, s := range []string{"", ".", "-", "1.2.3", "1e8", "+1", "1,5", " 1", "0x10", "--1"} {
+		_, err := TokenToCogs(s, 8)
+
+		assert.Equal(t, errors.New("incorrect token amount: \""+s+"\""), err)
+	}
+}
+
+func TestTokenToCogsNegativeDecimals(t *testing.T) {
+	_, err := TokenToCogs("1", -1)
+
+	assert.Equal(t, errors.New("incorrect number of decimals: -1"), err)
+}
+
+func TestCompareTokenAmounts(t *testing.T) {
+	assert.Equal(t, 0, CompareTokenAmounts(big.NewInt(10), 8, bigIntFromString("100000000000"), 18))
+	assert.Equal(t, 0, CompareTokenAmounts(bigIntFromString("100000000000"), 18, big.NewInt(10), 8))
+	assert.Equal(t, -1, CompareTokenAmounts(big.NewInt(10), 18, big.NewInt(10), 8))
+	assert.Equal(t, 1, CompareTokenAmounts(big.NewInt(10), 8, big.NewInt(10), 18))
+	assert.Equal(t, 0, CompareTokenAmounts(big.NewInt(10), 8, big.NewInt(10), 8))
+}
+
+func TestCompareTokenAmountsDoesNotModifyArguments(t *testing.T) {
+	a := big.NewInt(10)
+
+	CompareTokenAmounts(a, 8, big.NewInt(10), 18)
+
+	assert.Equal(t, big.NewInt(10), a)
+}
@@ -2,13 +2,16 @@ package escrow
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
-	"errors"
+	"fmt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"math/big"
+	"sync"
+	"time"
 
 	"github.com/singnet/snet-daemon/blockchain"
 )
@@ -17,58 +20,1301 @@ import (
 type ChannelPaymentValidator struct {
 	currentBlock               func() (currentBlock *big.Int, err error)
 	paymentExpirationThreshold func() (threshold *big.Int)
+	// pricePerCall is optional, when set payment amount should be incremented
+	// at least on the price of the call. Price is expressed in cogs and is
+	// normalized to the channel token decimals before comparison.
+	pricePerCall func() (price *big.Int)
+	// thresholdCache is optional, when set paymentExpirationThreshold result
+	// is memoized until InvalidateExpirationThreshold is called.
+	thresholdCache *cachedThreshold
+	// signerAllowlist is optional, when it is not empty payment signer should
+	// be in the list in addition to be equal to the channel signer.
+	signerAllowlist []common.Address
+	// deltaAmounts is optional, when it is true payment amount is treated as
+	// increment of the channel authorized amount.
+	deltaAmounts bool
+	// currentBlockSlots is optional, when set it limits number of concurrent
+	// currentBlock calls.
+	currentBlockSlots chan struct{}
+	// failFast defines whether validation fails immediately or waits when
+	// all currentBlockSlots are in use.
+	failFast bool
+	// metrics contains validation counters, see MetricsSnapshot.
+	metrics *validationMetrics
+	// paymentStorage is optional, when set each valid payment is saved into
+	// it.
+	paymentStorage *PaymentStorage
+	// confirmations is a number of blocks which are subtracted from the
+	// current block before comparing it with channel expiration.
+	confirmations int64
+	// signatureVerifier is optional, when set it is used to recover payment
+	// signer instead of local implementation.
+	signatureVerifier SignatureVerifier
+	// tracer is optional, when set validation steps are traced using it.
+	tracer ValidationTracer
+	// maxExpirationHorizon is optional, when set channels which expire later
+	// than current block plus horizon are rejected.
+	maxExpirationHorizon *big.Int
+	// signerCache is optional, when set signers recovered from payments are
+	// memoized until InvalidateChannel is called.
+	signerCache *signerCache
+	// pendingStorage is optional, when set each valid payment is recorded as
+	// pending to be committed or rolled back later.
+	pendingStorage *PendingPaymentStorage
+	// claimStorage is optional, when set nonce which follows the latest
+	// claimed one is expected if it is greater than channel nonce.
+	claimStorage *PaymentStorage
+	// signaturePrefix is optional, when set it replaces Ethereum prefix of
+	// the signed message hash.
+	signaturePrefix []byte
+	// nonceLag is a number of nonces after the channel one which are
+	// accepted in addition to the channel nonce.
+	nonceLag int64
+	// claimStorageFailurePolicy defines how validator handles errors of the
+	// claim storage reads.
+	claimStorageFailurePolicy ClaimStorageFailurePolicy
+	// auditSink is optional, when set event is recorded for each accepted
+	// payment.
+	auditSink AuditSink
+	// channelStateProvider is optional, it is required to validate payments
+	// using ValidateAtHistoricalBlock.
+	channelStateProvider ChannelStateProvider
+	// readOnly is true when validator must not write into storages, so
+	// payment persistence and pending payments are skipped.
+	readOnly bool
+	// groupExpirationThreshold is optional, when set it overrides
+	// paymentExpirationThreshold for the channel groups it knows.
+	groupExpirationThreshold GroupExpirationThreshold
+	// blockchainReader is optional, when set signatures of the channel
+	// signers which are contracts are verified using EIP-1271.
+	blockchainReader BlockchainReader
+	// delegateResolver is optional, when set payments signed by delegates of
+	// the channel signer are accepted.
+	delegateResolver DelegateResolver
+	// minRemainingCapacity is optional, when set payments which leave less
+	// than minRemainingCapacity of the channel amount are rejected.
+	minRemainingCapacity *big.Int
+	// allowedGroupIDs is optional, when it is not empty payments of the
+	// channels of other groups are rejected.
+	allowedGroupIDs map[[32]byte]bool
+	// queue is optional, when set it limits number of concurrent validations
+	// and queues the rest, see WithValidationQueue.
+	queue *validationQueue
+	// signerRotations is optional, when set channels which signer is being
+	// rotated accept payment signers according to the rotation window.
+	signerRotations *SignerRotationStorage
+	// signerRotationWindow is a number of blocks during which both old and
+	// new signers are accepted.
+	signerRotationWindow int64
+	// proofOfFunds is optional, when set it verifies proof of funds
+	// attached to the payment.
+	proofOfFunds ProofOfFundsVerifier
+	// hmacSecret is optional, when set payment signature is checked as
+	// HMAC of the payment message instead of recovering signer.
+	hmacSecret []byte
+	// expirationThresholdPolicies are optional, when set channel should
+	// pass each of them in addition to the default threshold, so the
+	// strictest threshold is applied.
+	expirationThresholdPolicies []func() (threshold *big.Int)
+	// chainID is optional, when set payment signatures with EIP-155 encoded
+	// V are accepted if V contains this chain id.
+	chainID *big.Int
+	// signatureGuard is optional, when set payments which signature was
+	// already accepted are rejected.
+	signatureGuard *SignatureGuard
+	// pendingChannels is optional, when set payments with nonce ahead of
+	// the channel nonce are validated against confirmed pending channel
+	// state.
+	pendingChannels PendingChannelLookup
+	// blockSkewTolerance is a number of blocks the current block may differ
+	// from the one seen by peers, it widens acceptable expiration window.
+	blockSkewTolerance int64
+	// spendingCaps is optional, when set total amount authorized by each
+	// payment signer across channels is limited.
+	spendingCaps *SpendingCapTracker
+	// recipientPaymentAddress is optional, when set payments of the channels
+	// which recipient is not the payment address of the service and is not
+	// delegated to it are rejected.
+	recipientPaymentAddress func() common.Address
+	// recipientDelegations maps delegated channel recipients to the payment
+	// addresses they forward funds to.
+	recipientDelegations RecipientDelegations
+	// unknownChannelPolicy defines how ValidateByChannelID handles payments
+	// of the channels which are not found by lookup.
+	unknownChannelPolicy UnknownChannelPolicy
+	// chainChannels is used to fetch unknown channels from blockchain when
+	// unknownChannelPolicy is FetchUnknownChannelFromChain.
+	chainChannels ChainChannelReader
+	// pendingExtensions is optional, when set payments of the channels which
+	// are near to be expired are validated against expiration set by the
+	// mined extension transaction.
+	pendingExtensions BlockchainReader
+	// fraudScorer is optional, when set payments which score is above
+	// fraudThreshold are rejected.
+	fraudScorer    FraudScorer
+	fraudThreshold float64
+	// allowedSenders is optional, when it is not empty payments of the
+	// channels which sender is not in the set are rejected.
+	allowedSenders map[common.Address]bool
+}
+
+// GroupExpirationThreshold returns expiration threshold of the channels of
+// the group, ok is false if group has no specific threshold.
+type GroupExpirationThreshold func(groupID [32]byte) (threshold *big.Int, ok bool)
+
+// ClaimStorageFailurePolicy defines how validator handles error when it
+// cannot read the claim storage. It is applied to the claim storage only,
+// read errors of the other optional storages (signer rotations, spending caps,
+// signature guard) always reject payment because ignoring them would allow
+// replaying or overspending.
+type ClaimStorageFailurePolicy int
+
+const (
+	// FailClosed rejects payment with Internal error when claim storage
+	// cannot be read, it is used by default.
+	FailClosed ClaimStorageFailurePolicy = 0
+	// FailOpen ignores claim storage read error and validates payment using
+	// the channel nonce instead of the latest claimed one.
+	FailOpen ClaimStorageFailurePolicy = 1
+)
+
+// UnknownChannelPolicy defines how validator handles payment when there is
+// no state of the payment channel, see ValidateByChannelID.
+type UnknownChannelPolicy int
+
+const (
+	// RejectUnknownChannel rejects payment of the unknown channel with
+	// Unauthenticated error, it is used by default.
+	RejectUnknownChannel UnknownChannelPolicy = 0
+	// FetchUnknownChannelFromChain reads channel state from blockchain and
+	// validates payment against it, payment is rejected if channel is not
+	// found on-chain either.
+	FetchUnknownChannelFromChain UnknownChannelPolicy = 1
+)
+
+// ChainChannelReader reads payment channel state from blockchain, it is
+// implemented by BlockchainChannelReader.
+type ChainChannelReader interface {
+	GetChannelStateFromBlockchain(key *PaymentChannelKey) (channel *PaymentChannelData, ok bool, err error)
+}
+
+// ChannelPaymentValidatorOption is an optional setting which can be passed to
+// NewChannelPaymentValidator.
+type ChannelPaymentValidatorOption func(validator *ChannelPaymentValidator)
+
+// WithPriceIncrementCheck returns option which makes validator to check that
+// payment amount is greater or equal to the channel authorized amount plus
+// price of the call.
+func WithPriceIncrementCheck(pricePerCall func() *big.Int) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.pricePerCall = pricePerCall
+	}
+}
+
+// WithSignerAllowlist returns option which makes validator to accept only
+// payments signed by one of the passed addresses. Signer should be equal to
+// the channel signer as well. Empty list disables the check.
+func WithSignerAllowlist(signers ...common.Address) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.signerAllowlist = signers
+	}
+}
+
+// WithDeltaAmounts returns option which makes validator to interpret
+// payment amount sent by client as a delta over the channel authorized
+// amount. Cumulative amount is reconstructed before signature verification
+// and payment is expected to be signed using the cumulative amount, see
+// ValidateCumulative.
+func WithDeltaAmounts() ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.deltaAmounts = true
+	}
+}
+
+// CumulativeFromDelta returns cumulative amount which is authorized by payment
+// which increments channel authorized amount on delta.
+func CumulativeFromDelta(authorizedAmount, delta *big.Int) *big.Int {
+	return new(big.Int).Add(authorizedAmount, delta)
+}
+
+// NextExpected returns nonce and cumulative amount of the next payment
+// which is accepted for the channel when price of the call is pricePerCall
+// cogs. Price is converted to the channel token units rounding up, so the
+// returned amount always covers the price.
+func NextExpected(channel *PaymentChannelData, pricePerCall *big.Int) (nonce, amount *big.Int) {
+	authorized := channel.AuthorizedAmount
+	if authorized == nil {
+		authorized = big.NewInt(0)
+	}
+	price := pricePerCall
+	if decimals := channel.tokenDecimals(); decimals > DefaultTokenDecimals {
+		price = scaleTokenAmount(price, decimals-DefaultTokenDecimals)
+	} else if decimals < DefaultTokenDecimals {
+		divisor := scaleTokenAmount(big.NewInt(1), DefaultTokenDecimals-decimals)
+		price = new(big.Int).Add(price, new(big.Int).Sub(divisor, big.NewInt(1)))
+		price.Div(price, divisor)
+	}
+	return new(big.Int).Set(channel.Nonce), new(big.Int).Add(authorized, price)
+}
+
+// WithConcurrencyLimit returns option which limits number of concurrent
+// requests to the blockchain made by validator to maxInFlight. When limit is
+// reached validation waits for the free slot until context is done or fails
+// immediately if failFast is true.
+func WithConcurrencyLimit(maxInFlight int, failFast bool) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.currentBlockSlots = make(chan struct{}, maxInFlight)
+		validator.failFast = failFast
+	}
+}
+
+// WithExpirationThresholdCache returns option which makes validator to call
+// payment expiration threshold function only once and reuse its result. It is
+// useful when threshold function does I/O. Use
+// ChannelPaymentValidator.InvalidateExpirationThreshold to reread the value.
+// Option should be passed after options which replace threshold function.
+func WithExpirationThresholdCache() ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.thresholdCache = newCachedThreshold(validator.paymentExpirationThreshold)
+		validator.paymentExpirationThreshold = validator.thresholdCache.get
+	}
+}
+
+// WithPaymentPersistence returns option which makes validator to put each
+// successfully validated payment into the storage. Payment which cannot be
+// saved is reported as Internal error.
+func WithPaymentPersistence(storage *PaymentStorage) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.paymentStorage = storage
+	}
+}
+
+// WithBlockConfirmations returns option which makes validator to compare
+// channel expiration with the latest confirmed block which is current block
+// minus confirmations. It allows ignoring blocks which can be reverted by
+// reorganization of the chain.
+func WithBlockConfirmations(confirmations int64) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.confirmations = confirmations
+	}
+}
+
+// WithSignatureVerifier returns option which makes validator to recover
+// payment signer using passed verifier, for instance one which is backed by
+// HSM or remote KMS.
+func WithSignatureVerifier(verifier SignatureVerifier) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.signatureVerifier = verifier
+	}
+}
+
+// WithTracer returns option which makes validator to create span for each
+// validation and child span for the current block request. Use
+// oteltracing.NewValidationTracer to trace using OpenTelemetry.
+func WithTracer(tracer ValidationTracer) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.tracer = tracer
+	}
+}
+
+// WithMaxExpirationHorizon returns option which makes validator to reject
+// channels which expiration is after current block plus horizon. Such
+// expiration is implausible and means that channel state is corrupted.
+func WithMaxExpirationHorizon(horizon *big.Int) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.maxExpirationHorizon = horizon
+	}
+}
+
+// WithSignerCache returns option which makes validator to memoize signers
+// recovered from payment signatures. At most size signers are kept, least
+// recently used ones are evicted. Use
+// ChannelPaymentValidator.InvalidateChannel to drop cached signers when
+// channel is updated.
+func WithSignerCache(size int) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.signerCache = newSignerCache(size)
+	}
+}
+
+// WithPendingPayments returns option which makes validator to record each
+// successfully validated payment as pending. Caller should either commit or
+// roll it back using PendingPaymentStorage. Payment which cannot be recorded
+// is reported as Internal error.
+func WithPendingPayments(storage *PendingPaymentStorage) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.pendingStorage = storage
+	}
+}
+
+// WithClaimedNonceDetection returns option which makes validator to detect
+// channel nonce advanced by claims. Each claim increments channel nonce in
+// the contract, so when claimStorage contains claim with nonce which is
+// greater or equal to the channel nonce then the nonce next to the latest
+// claimed one is expected from client.
+func WithClaimedNonceDetection(claimStorage *PaymentStorage) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.claimStorage = claimStorage
+	}
+}
+
+// WithSignaturePrefix returns option which makes validator to use prefix
+// instead of blockchain.HashPrefix32Bytes when signed message hash is
+// calculated. It allows accepting payments signed by non-Ethereum tools.
+func WithSignaturePrefix(prefix []byte) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.signaturePrefix = prefix
+	}
+}
+
+// WithNonceLag returns option which makes validator to accept payment nonce
+// within [channel nonce, channel nonce + lag]. It allows accepting payments
+// when daemon's view of the channel lags behind the client's one because of
+// reorganization of the chain.
+func WithNonceLag(lag int64) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.nonceLag = lag
+	}
+}
+
+// WithClaimStorageFailurePolicy returns option which sets how validator
+// handles claim storage read errors. Errors of the other storages and errors
+// of writes, for instance payment persistence, are always reported regardless
+// of the policy.
+func WithClaimStorageFailurePolicy(policy ClaimStorageFailurePolicy) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.claimStorageFailurePolicy = policy
+	}
+}
+
+// WithAuditSink returns option which makes validator to record AuditEvent
+// into sink for each successfully validated payment.
+func WithAuditSink(sink AuditSink) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.auditSink = sink
+	}
+}
+
+// WithChannelStateProvider returns option which sets provider of the
+// historical channel states used by ValidateAtHistoricalBlock.
+func WithChannelStateProvider(provider ChannelStateProvider) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.channelStateProvider = provider
+	}
+}
+
+// WithReadOnly returns option which makes validator to skip optional
+// writes: payment persistence and pending payments. It is intended to be
+// used on read replicas, see also ReadOnlyAtomicStorage.
+func WithReadOnly() ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.readOnly = true
+	}
+}
+
+// WithGroupExpirationThresholds returns option which makes validator to
+// resolve expiration threshold using channel GroupID. Default threshold is
+// used for groups which are not known by thresholds.
+func WithGroupExpirationThresholds(thresholds GroupExpirationThreshold) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.groupExpirationThreshold = thresholds
+	}
+}
+
+// WithExpirationThresholdPolicies returns option which adds expiration
+// threshold policies applied in addition to the default or group threshold.
+// Channel is considered near to be expired if any of the policies considers
+// it so, i.e. the largest threshold is used. It allows running old and new
+// threshold policies side by side during migration.
+func WithExpirationThresholdPolicies(policies ...func() *big.Int) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.expirationThresholdPolicies = append(validator.expirationThresholdPolicies, policies...)
+	}
+}
+
+// WithBlockSkewTolerance returns option which makes validator to tolerate
+// current block being up to skew blocks ahead or behind of the block seen by
+// peers. Expiration threshold is decreased by skew (but not below zero) and
+// maximum expiration horizon is increased by skew, so payments near the
+// boundary are not rejected and accepted alternately.
+func WithBlockSkewTolerance(skew int64) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.blockSkewTolerance = skew
+	}
+}
+
+// WithChainID returns option which makes validator to accept payment
+// signatures which V component is encoded according to EIP-155 as
+// 35 + 2 * chainID + recoveryID. Signatures with other chain id are
+// rejected as malformed.
+func WithChainID(chainID *big.Int) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.chainID = chainID
+	}
+}
+
+// WithSignatureGuard returns option which makes validator to reject
+// payments which signature was already accepted, see SignatureGuard.
+// Signature is remembered after all other checks are passed, it is
+// forgotten if payment is rejected later or released by ReleasePayment. In
+// read-only mode signature is checked but not remembered.
+func WithSignatureGuard(guard *SignatureGuard) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.signatureGuard = guard
+	}
+}
+
+// WithPendingChannelLookup returns option which makes validator to consult
+// lookup when payment nonce is ahead of the channel nonce instead of
+// rejecting the payment with IncorrectNonce error immediately. Payment is
+// validated against pending channel state once it is confirmed, until then
+// IncorrectNonce error is returned so client can retry.
+func WithPendingChannelLookup(lookup PendingChannelLookup) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.pendingChannels = lookup
+	}
+}
+
+// WithContractSignatures returns option which makes validator to verify
+// payment signature by calling EIP-1271 isValidSignature method when channel
+// signer is a contract, for instance smart-contract wallet which cannot
+// produce ECDSA signatures.
+func WithContractSignatures(reader BlockchainReader) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.blockchainReader = reader
+	}
+}
+
+// WithDelegateResolver returns option which makes validator to accept
+// payments signed by delegates of the channel signer returned by resolver.
+func WithDelegateResolver(resolver DelegateResolver) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.delegateResolver = resolver
+	}
+}
+
+// WithMinRemainingCapacity returns option which makes validator to reject
+// payments which leave less than minCapacity of the channel full amount
+// unspent. Such payments are rejected with LowRemainingCapacity error to
+// signal client that channel should be topped up before the next call.
+func WithMinRemainingCapacity(minCapacity *big.Int) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.minRemainingCapacity = minCapacity
+	}
+}
+
+// WithAllowedGroupIDs returns option which makes validator to reject
+// payments of the channels which GroupID is not in the list with
+// GroupNotAllowed error. It allows temporarily disabling some of the groups
+// served by daemon.
+func WithAllowedGroupIDs(groupIDs ...[32]byte) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.allowedGroupIDs = make(map[[32]byte]bool, len(groupIDs))
+		for _, groupID := range groupIDs {
+			validator.allowedGroupIDs[groupID] = true
+		}
+	}
+}
+
+// WithValidationQueue returns option which limits number of concurrently
+// running validations to maxRunning. Validations above the limit wait in the
+// queue of the given depth. When queue is full validation waits up to
+// timeout for the place in the queue and fails with Internal "validation
+// queue full" error if it doesn't become free. Validation waiting in the
+// queue fails when context is done.
+func WithValidationQueue(maxRunning int, depth int, timeout time.Duration) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.queue = newValidationQueue(maxRunning, depth, timeout)
+	}
+}
+
+// WithSignerRotations returns option which makes validator to accept
+// payment signers according to the rotation windows kept in the storage.
+// When channel has rotation window its signers replace the channel signer
+// and old and new signers are both accepted during window blocks starting
+// from the rotation EffectiveBlock.
+func WithSignerRotations(rotations *SignerRotationStorage, window int64) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.signerRotations = rotations
+		validator.signerRotationWindow = window
+	}
+}
+
+// WithProofOfFunds returns option which makes validator to verify proof of
+// funds attached to the payment using verifier, see
+// NewBlockchainProofOfFundsVerifier.
+func WithProofOfFunds(verifier ProofOfFundsVerifier) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.proofOfFunds = verifier
+	}
+}
+
+// WithHMACAuthentication returns option which makes validator to
+// authenticate payments using HMAC-SHA256 of the payment message with
+// shared secret instead of ECDSA signature, see ComputePaymentMAC. It is
+// intended for trusted internal services which share the secret with the
+// daemon. Payments signed by ECDSA keys are rejected by such validator.
+func WithHMACAuthentication(secret []byte) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.hmacSecret = secret
+	}
+}
+
+// WithSpendingCaps returns option which makes validator to limit total
+// amount authorized by each payment signer across all channels. Payments
+// which would exceed the cap are rejected with SpendingCapExceeded error.
+// Total is increased when payment is validated, so the tracker should be
+// shared by all validators of the service.
+func WithSpendingCaps(tracker *SpendingCapTracker) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.spendingCaps = tracker
+	}
+}
+
+// WithRecipientDelegations returns option which makes validator to check
+// that channel recipient is the payment address of the service or a
+// recipient which is delegated to it according to the delegations.
+func WithRecipientDelegations(paymentAddress func() common.Address, delegations RecipientDelegations) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.recipientPaymentAddress = paymentAddress
+		validator.recipientDelegations = delegations
+	}
+}
+
+// WithUnknownChannelPolicy returns option which sets how validator handles
+// payments of the channels which state is not found. reader is used by
+// FetchUnknownChannelFromChain policy only and can be nil otherwise, payment
+// of the unknown channel is rejected with Internal error if the policy is
+// set without reader.
+func WithUnknownChannelPolicy(policy UnknownChannelPolicy, reader ChainChannelReader) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.unknownChannelPolicy = policy
+		validator.chainChannels = reader
+	}
+}
+
+// WithPendingExtensions returns option which makes validator to consult
+// extension transactions which are mined but not yet reflected in the
+// channel state before rejecting payment of the channel which is near to be
+// expired.
+func WithPendingExtensions(reader BlockchainReader) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.pendingExtensions = reader
+	}
+}
+
+// WithFraudScorer returns option which makes validator to score each
+// payment which passed all other checks using scorer. Payments which score
+// is above the threshold are rejected with SuspectedFraud error.
+func WithFraudScorer(scorer FraudScorer, threshold float64) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.fraudScorer = scorer
+		validator.fraudThreshold = threshold
+	}
+}
+
+// WithAllowedSenders returns option which makes validator to reject
+// payments of the channels which Sender is not in the list. It allows
+// restricting service to the known customers. Empty list disables the check.
+func WithAllowedSenders(senders ...common.Address) ChannelPaymentValidatorOption {
+	return func(validator *ChannelPaymentValidator) {
+		validator.allowedSenders = make(map[common.Address]bool, len(senders))
+		for _, sender := range senders {
+			validator.allowedSenders[sender] = true
+		}
+	}
 }
 
 // NewChannelPaymentValidator returns new payment validator instance
-func NewChannelPaymentValidator(processor *blockchain.Processor, cfg *viper.Viper, metadata *blockchain.ServiceMetadata) *ChannelPaymentValidator {
-	return &ChannelPaymentValidator{
+func NewChannelPaymentValidator(processor *blockchain.Processor, cfg *viper.Viper, metadata *blockchain.ServiceMetadata, options ...ChannelPaymentValidatorOption) *ChannelPaymentValidator {
+	validator := &ChannelPaymentValidator{
 		currentBlock: processor.CurrentBlock,
 		paymentExpirationThreshold: func() *big.Int {
 			return metadata.GetPaymentExpirationThreshold()
 		},
+		metrics: newValidationMetrics(),
+	}
+	for _, option := range options {
+		option(validator)
+	}
+	return validator
+}
+
+// InvalidateExpirationThreshold drops memoized payment expiration threshold
+// value, so it is read again on the next validation. It does nothing if
+// validator is created without WithExpirationThresholdCache option.
+func (validator *ChannelPaymentValidator) InvalidateExpirationThreshold() {
+	if validator.thresholdCache != nil {
+		validator.thresholdCache.invalidate()
+	}
+}
+
+// InvalidateChannel drops all cached state of the channel. It should be
+// called when channel is changed, for instance when channel signer is
+// updated. It does nothing if validator is created without WithSignerCache
+// option.
+func (validator *ChannelPaymentValidator) InvalidateChannel(channelID *big.Int) {
+	if validator.signerCache != nil {
+		validator.signerCache.invalidate(channelID)
 	}
 }
 
 // Validate returns instance of PaymentError as error if validation fails, nil
-// otherwise.
+// otherwise. Payment is not modified, use ValidateCumulative to get the
+// cumulative amount when validator is created using WithDeltaAmounts option.
 func (validator *ChannelPaymentValidator) Validate(payment *Payment, channel *PaymentChannelData) (err error) {
+	return validator.ValidateContext(context.Background(), payment, channel)
+}
+
+// ValidateCumulative is the same as Validate but it also returns cumulative
+// amount authorized by payment. If validator is created using
+// WithDeltaAmounts option then it is the payment amount added to the channel
+// authorized amount, otherwise it is the payment amount.
+func (validator *ChannelPaymentValidator) ValidateCumulative(payment *Payment, channel *PaymentChannelData) (amount *big.Int, err error) {
+	return validator.validateQueued(context.Background(), payment, channel)
+}
+
+// ValidateByChannelID fetches payment channel using payment channel id and
+// nonce and validates payment against it. lookup should return nil channel
+// and nil error if channel is not found. Not found channel is handled
+// according to UnknownChannelPolicy and reported as Unauthenticated error by
+// default while lookup error is reported as Internal one.
+func (validator *ChannelPaymentValidator) ValidateByChannelID(payment *Payment, lookup func(channelID, nonce *big.Int) (*PaymentChannelData, error)) error {
+	channel, err := lookup(payment.ChannelID, payment.ChannelNonce)
+	if err != nil {
+		log.WithField("payment", payment).WithError(err).Error("Cannot get payment channel")
+		return NewPaymentError(Internal, "payment channel error: %v", err)
+	}
+	if channel == nil && validator.unknownChannelPolicy == FetchUnknownChannelFromChain {
+		if validator.chainChannels == nil {
+			log.WithField("payment", payment).Error("Unknown channel policy requires blockchain channel reader")
+			return NewPaymentError(Internal, "blockchain channel reader is not configured")
+		}
+		var ok bool
+		channel, ok, err = validator.chainChannels.GetChannelStateFromBlockchain(&PaymentChannelKey{ID: payment.ChannelID})
+		if err != nil {
+			log.WithField("payment", payment).WithError(err).Error("Cannot fetch payment channel from blockchain")
+			return NewPaymentError(Internal, "cannot fetch payment channel from blockchain: %v", err)
+		}
+		if !ok {
+			channel = nil
+		}
+	}
+	if channel == nil {
+		log.WithField("payment", payment).Warn("Payment channel not found")
+		return NewPaymentError(Unauthenticated, "payment channel \"%v\" not found", payment.ChannelID)
+	}
+	return validator.Validate(payment, channel)
+}
+
+// ValidateContext is the same as Validate but it stops waiting for the
+// blockchain request slot or for the place in the validation queue when
+// context is done, see WithConcurrencyLimit and WithValidationQueue.
+func (validator *ChannelPaymentValidator) ValidateContext(ctx context.Context, payment *Payment, channel *PaymentChannelData) (err error) {
+	_, err = validator.validateQueued(ctx, payment, channel)
+	return
+}
+
+// validateQueued validates payment against current block after waiting for
+// the place in the validation queue.
+func (validator *ChannelPaymentValidator) validateQueued(ctx context.Context, payment *Payment, channel *PaymentChannelData) (amount *big.Int, err error) {
+	if validator.queue != nil {
+		if err = validator.queue.acquire(ctx); err != nil {
+			validator.metrics.record(err)
+			return nil, err
+		}
+		defer validator.queue.release()
+	}
+	return validator.validate(ctx, payment, channel, nil)
+}
+
+// ValidateAtBlock is the same as Validate but it uses passed current block
+// instead of requesting it from blockchain. It is useful for tests and
+// offline validation. Block confirmations are applied to the passed block
+// as well.
+func (validator *ChannelPaymentValidator) ValidateAtBlock(payment *Payment, channel *PaymentChannelData, currentBlock *big.Int) (err error) {
+	_, err = validator.validate(context.Background(), payment, channel, currentBlock)
+	return
+}
+
+// ReleasePayment undoes side effects of the successful validation of the
+// payment which is not committed, for instance when payment transaction is
+// rolled back: signature of the payment is forgotten by the signature
+// guard, so client can retry the payment, and payment increment is refunded
+// to the signer spending cap. channel should be the one payment was
+// validated against and payment amount should be the cumulative one, see
+// ValidateCumulative.
+func (validator *ChannelPaymentValidator) ReleasePayment(payment *Payment, channel *PaymentChannelData) (err error) {
+	var log = log.WithField("payment", payment)
+	if e := validator.forgetSignature(payment); e != nil {
+		log.WithError(e).Error("Cannot forget signature of the released payment")
+		return NewPaymentError(Internal, "cannot release payment signature: %v", e)
+	}
+
+	if validator.spendingCaps == nil || validator.readOnly {
+		return nil
+	}
+	signer, e := validator.getPaymentSigner(payment, channel)
+	if e != nil {
+		log.WithError(e).Error("Cannot get signer of the released payment")
+		return NewPaymentError(Internal, "cannot refund signer spending: %v", e)
+	}
+	if e = validator.refundSpendingCap(signer, payment, channel); e != nil {
+		log.WithError(e).Error("Cannot refund signer spending of the released payment")
+		return NewPaymentError(Internal, "cannot refund signer spending: %v", e)
+	}
+	return nil
+}
+
+// validate validates payment, if pinnedBlock is nil then current block is
+// requested from blockchain. It returns cumulative amount authorized by
+// payment, payment itself is not modified.
+func (validator *ChannelPaymentValidator) validate(ctx context.Context, payment *Payment, channel *PaymentChannelData, pinnedBlock *big.Int) (amount *big.Int, err error) {
+	defer func() { validator.metrics.record(err) }()
+
+	ctx, span := validator.getTracer().StartSpan(ctx, "ChannelPaymentValidator.Validate", []SpanAttribute{
+		{Key: "channelID", Value: payment.ChannelID.String()},
+		{Key: "nonce", Value: payment.ChannelNonce.String()},
+	})
+	defer func() { endValidationSpan(span, err) }()
+
+	if e := checkMissingFields(payment, channel); e != nil {
+		log.WithField("payment", payment).WithField("channel", channel).Error("Payment or channel field is missing")
+		return nil, e
+	}
+
+	channel, err = validator.resolvePendingChannel(payment, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	if validator.deltaAmounts {
+		cumulative := *payment
+		cumulative.Amount = CumulativeFromDelta(channel.AuthorizedAmount, payment.Amount)
+		payment = &cumulative
+	}
+
 	var log = log.WithField("payment", payment).WithField("channel", channel)
 
-	if payment.ChannelNonce.Cmp(channel.Nonce) != 0 {
+	if len(validator.allowedGroupIDs) > 0 && !validator.allowedGroupIDs[channel.GroupID] {
+		log.Warn("Payment channel group is not allowed")
+		return nil, NewPaymentError(GroupNotAllowed, "payment channel group %v is not allowed", hex.EncodeToString(channel.GroupID[:]))
+	}
+
+	if len(validator.allowedSenders) > 0 && !validator.allowedSenders[channel.Sender] {
+		log.Warn("Payment channel sender is not allowed")
+		return nil, NewPaymentError(SenderNotAllowed, "payment channel sender %v is not allowed", blockchain.AddressToHex(&channel.Sender))
+	}
+
+	if !validator.isAcceptedRecipient(channel) {
+		log.Warn("Payment channel recipient is not accepted")
+		return nil, validator.recipientError(channel)
+	}
+
+	expectedNonce, err := validator.expectedNonce(channel)
+	if err != nil {
+		log.WithError(err).Error("Cannot read latest claimed nonce")
+		return nil, NewPaymentError(Internal, "cannot read latest claimed nonce: %v", err)
+	}
+	if !validator.isAcceptableNonce(payment.ChannelNonce, expectedNonce) {
 		log.Warn("Incorrect nonce is sent by client")
-		return NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: %v, sent: %v", channel.Nonce, payment.ChannelNonce)
+		return nil, validator.incorrectNonceError(payment.ChannelNonce, expectedNonce)
 	}
 
-	signerAddress, err := getSignerAddressFromPayment(payment)
+	signerAddress, err := validator.getPaymentSigner(payment, channel)
 	if err != nil {
-		return NewPaymentError(Unauthenticated, "payment signature is not valid")
+		if paymentErr, ok := err.(*PaymentError); ok {
+			return nil, paymentErr
+		}
+		return nil, NewPaymentError(Unauthenticated, "payment signature is not valid")
 	}
 
 	log = log.WithField("signerAddress", blockchain.AddressToHex(signerAddress))
-	if *signerAddress != channel.Signer {
-		log.WithField("signerAddress", blockchain.AddressToHex(signerAddress)).Warn("Channel signer is not equal to payment signer")
-		return NewPaymentError(Unauthenticated, "payment is not signed by channel signer")
+	rotation, err := validator.signerRotation(channel)
+	if err != nil {
+		log.WithError(err).Error("Cannot read signer rotation window")
+		return nil, NewPaymentError(Internal, "cannot read signer rotation window: %v", err)
 	}
-	currentBlock, e := validator.currentBlock()
-	if e != nil {
-		return NewPaymentError(Internal, "cannot determine current block")
+	if rotation == nil {
+		isChannelSigner, err := validator.isChannelSigner(signerAddress, channel)
+		if err != nil {
+			log.WithError(err).Error("Cannot resolve delegates of channel signer")
+			return nil, NewPaymentError(Internal, "cannot resolve signer delegates: %v", err)
+		}
+		if !isChannelSigner {
+			log.WithField("signerAddress", blockchain.AddressToHex(signerAddress)).Warn("Channel signer is not equal to payment signer")
+			return nil, NewPaymentError(Unauthenticated, "payment is not signed by channel signer")
+		}
+	}
+	if !validator.isSignerAllowed(signerAddress) {
+		log.Warn("Payment signer is not in the allowlist")
+		return nil, NewPaymentError(Unauthenticated, "payment signer is not in the allowlist")
 	}
-	expirationThreshold := validator.paymentExpirationThreshold()
+	currentBlock := pinnedBlock
+	if currentBlock == nil {
+		blockCtx, blockSpan := validator.getTracer().StartSpan(ctx, "ChannelPaymentValidator.currentBlock", nil)
+		currentBlock, err = validator.limitedCurrentBlock(blockCtx)
+		endValidationSpan(blockSpan, err)
+		if err != nil {
+			return nil, err
+		}
+	}
+	currentBlock = validator.confirmedBlock(currentBlock)
+	if rotation != nil && !rotation.accepts(signerAddress, currentBlock, validator.signerRotationWindow) {
+		log.WithField("currentBlock", currentBlock).WithField("rotation", rotation).Warn("Payment signer is not accepted by signer rotation window")
+		return nil, NewPaymentError(Unauthenticated, "payment is not signed by channel signer")
+	}
+	expirationThreshold := validator.expirationThreshold(channel)
 	currentBlockWithThreshold := new(big.Int).Add(currentBlock, expirationThreshold)
 	if currentBlockWithThreshold.Cmp(channel.Expiration) >= 0 {
-		log.WithField("currentBlock", currentBlock).WithField("expirationThreshold", expirationThreshold).Warn("Channel expiration time is after expiration threshold")
-		return NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: %v, current block: %v, expiration threshold: %v", channel.Expiration, currentBlock, expirationThreshold)
+		extended, e := validator.extendByPendingExtension(channel, currentBlockWithThreshold)
+		if e != nil {
+			return nil, e
+		}
+		if extended == nil {
+			log.WithField("currentBlock", currentBlock).WithField("expirationThreshold", expirationThreshold).Warn("Channel expiration time is after expiration threshold")
+			return nil, NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: %v, current block: %v, expiration threshold: %v", channel.Expiration, currentBlock, expirationThreshold)
+		}
+		channel = extended
+	}
+	if maxExpirationHorizon := validator.expirationHorizon(); maxExpirationHorizon != nil {
+		maxExpiration := new(big.Int).Add(currentBlock, maxExpirationHorizon)
+		if channel.Expiration.Cmp(maxExpiration) > 0 {
+			log.WithField("currentBlock", currentBlock).WithField("maxExpirationHorizon", maxExpirationHorizon).Error("Channel expiration is too far in the future")
+			return nil, NewPaymentError(Internal, "implausible channel expiration")
+		}
+	}
+
+	if e := checkCallDeadline(payment, channel); e != nil {
+		log.WithField("callDeadline", payment.CallDeadline).Warn("Channel expires before call deadline")
+		return nil, e
 	}
 
 	if channel.FullAmount.Cmp(payment.Amount) < 0 {
 		log.Warn("Not enough tokens on payment channel")
-		return NewPaymentError(Unauthenticated, "not enough tokens on payment channel, channel amount: %v, payment amount: %v", channel.FullAmount, payment.Amount)
+		return nil, NewPaymentError(Unauthenticated, "not enough tokens on payment channel, channel amount: %v, payment amount: %v", channel.FullAmount, payment.Amount)
 	}
 
-	return
+	if validator.pricePerCall != nil {
+		price := validator.pricePerCall()
+		increment := new(big.Int).Sub(payment.Amount, channel.AuthorizedAmount)
+		if CompareTokenAmounts(increment, channel.tokenDecimals(), price, DefaultTokenDecimals) < 0 {
+			log.WithField("price", loggedAmount(price)).Warn("Payment amount is incremented on less than price")
+			return nil, NewPaymentError(InsufficientIncrement, "payment amount is incremented on less than price, authorized amount: %v, price: %v, payment amount: %v", channel.AuthorizedAmount, price, payment.Amount)
+		}
+	}
+
+	if validator.minRemainingCapacity != nil {
+		remaining := new(big.Int).Sub(channel.FullAmount, payment.Amount)
+		if remaining.Cmp(validator.minRemainingCapacity) < 0 {
+			log.WithField("remainingCapacity", loggedAmount(remaining)).Warn("Payment leaves channel remaining capacity below minimum")
+			return nil, NewPaymentError(LowRemainingCapacity, "remaining channel capacity %v is below minimum %v, channel should be topped up", remaining, validator.minRemainingCapacity)
+		}
+	}
+
+	if e := validator.verifyProofOfFunds(payment, channel, currentBlock); e != nil {
+		log.WithField("proof", payment.ProofOfFunds).WithError(e).Warn("Proof of funds is not accepted")
+		return nil, e
+	}
+
+	if e := validator.checkFraudScore(payment, channel); e != nil {
+		log.WithError(e).Warn("Payment is rejected by fraud scorer")
+		return nil, e
+	}
+
+	if e := validator.rememberSignature(payment); e != nil {
+		return nil, e
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if e := validator.forgetSignature(payment); e != nil {
+			log.WithError(e).Error("Cannot forget signature of the rejected payment")
+		}
+	}()
+
+	if e := validator.chargeSpendingCap(signerAddress, payment, channel); e != nil {
+		log.WithError(e).Warn("Payment is rejected by signer spending cap")
+		return nil, e
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if e := validator.refundSpendingCap(signerAddress, payment, channel); e != nil {
+			log.WithError(e).Error("Cannot refund signer spending of the rejected payment")
+		}
+	}()
+
+	if validator.paymentStorage != nil && !validator.readOnly {
+		if e := validator.paymentStorage.Put(payment); e != nil {
+			log.WithError(e).Error("Cannot save valid payment")
+			return nil, NewPaymentError(Internal, "cannot save payment: %v", e)
+		}
+	}
+
+	if validator.pendingStorage != nil && !validator.readOnly {
+		if e := validator.pendingStorage.Put(payment); e != nil {
+			log.WithError(e).Error("Cannot save pending payment")
+			return nil, NewPaymentError(Internal, "cannot save pending payment: %v", e)
+		}
+	}
+
+	validator.recordAudit(payment, signerAddress)
+
+	return payment.Amount, nil
+}
+
+// checkCallDeadline returns error if channel expires at or before the call
+// deadline requested by client.
+func checkCallDeadline(payment *Payment, channel *PaymentChannelData) *PaymentError {
+	if payment.CallDeadline == nil || channel.Expiration.Cmp(payment.CallDeadline) > 0 {
+		return nil
+	}
+	return NewPaymentError(ChannelExtensionRequired, "payment channel expires at block %v which is not after call deadline %v, please extend the channel", channel.Expiration, payment.CallDeadline)
+}
+
+// checkMissingFields returns error if one of the big.Int fields of the
+// payment or of the channel used by validation is nil. It prevents validator
+// from panicking on incomplete data read from storage or blockchain.
+func checkMissingFields(payment *Payment, channel *PaymentChannelData) *PaymentError {
+	fields := []struct {
+		name  string
+		value *big.Int
+	}{
+		{"payment.ChannelID", payment.ChannelID},
+		{"payment.ChannelNonce", payment.ChannelNonce},
+		{"payment.Amount", payment.Amount},
+		{"channel.Nonce", channel.Nonce},
+		{"channel.FullAmount", channel.FullAmount},
+		{"channel.AuthorizedAmount", channel.AuthorizedAmount},
+		{"channel.Expiration", channel.Expiration},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			return NewPaymentError(Internal, "missing payment field: %v", field.name)
+		}
+	}
+	return nil
+}
+
+// expirationThreshold returns the largest of the channel base threshold and
+// thresholds of the additional policies.
+func (validator *ChannelPaymentValidator) expirationThreshold(channel *PaymentChannelData) *big.Int {
+	threshold := validator.baseExpirationThreshold(channel)
+	for _, policy := range validator.expirationThresholdPolicies {
+		if policyThreshold := policy(); policyThreshold.Cmp(threshold) > 0 {
+			threshold = policyThreshold
+		}
+	}
+	if validator.blockSkewTolerance > 0 {
+		threshold = new(big.Int).Sub(threshold, big.NewInt(validator.blockSkewTolerance))
+		if threshold.Sign() < 0 {
+			threshold = big.NewInt(0)
+		}
+	}
+	return threshold
+}
+
+// expirationHorizon returns maximum expiration horizon widened by block skew
+// tolerance, nil if horizon is not limited.
+func (validator *ChannelPaymentValidator) expirationHorizon() *big.Int {
+	if validator.maxExpirationHorizon == nil || validator.blockSkewTolerance <= 0 {
+		return validator.maxExpirationHorizon
+	}
+	return new(big.Int).Add(validator.maxExpirationHorizon, big.NewInt(validator.blockSkewTolerance))
+}
+
+// baseExpirationThreshold returns expiration threshold of the channel group
+// or default one if group has no specific threshold.
+func (validator *ChannelPaymentValidator) baseExpirationThreshold(channel *PaymentChannelData) *big.Int {
+	if validator.groupExpirationThreshold != nil {
+		if threshold, ok := validator.groupExpirationThreshold(channel.GroupID); ok {
+			return threshold
+		}
+	}
+	return validator.paymentExpirationThreshold()
+}
+
+// isAcceptableNonce returns true if nonce is within
+// [expectedNonce, expectedNonce + nonceLag].
+func (validator *ChannelPaymentValidator) isAcceptableNonce(nonce, expectedNonce *big.Int) bool {
+	if nonce.Cmp(expectedNonce) < 0 {
+		return false
+	}
+	maxNonce := new(big.Int).Add(expectedNonce, big.NewInt(validator.nonceLag))
+	return nonce.Cmp(maxNonce) <= 0
+}
+
+func (validator *ChannelPaymentValidator) incorrectNonceError(nonce, expectedNonce *big.Int) *PaymentError {
+	if validator.nonceLag > 0 {
+		return NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: %v, sent: %v, acceptable lag: %v", expectedNonce, nonce, validator.nonceLag)
+	}
+	return NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: %v, sent: %v", expectedNonce, nonce)
+}
+
+// expectedNonce returns nonce which payment should have. It is a channel
+// nonce unless claim storage contains claim which advanced the nonce.
+func (validator *ChannelPaymentValidator) expectedNonce(channel *PaymentChannelData) (nonce *big.Int, err error) {
+	if validator.claimStorage == nil {
+		return channel.Nonce, nil
+	}
+
+	claimedNonce, ok, err := validator.claimStorage.LatestNonce(channel.ChannelID)
+	if err != nil {
+		if validator.claimStorageFailurePolicy == FailOpen {
+			log.WithError(err).WithField("channelID", channel.ChannelID).Warn("Cannot read latest claimed nonce, channel nonce is used")
+			return channel.Nonce, nil
+		}
+		return
+	}
+	if !ok || claimedNonce.Cmp(channel.Nonce) < 0 {
+		return channel.Nonce, nil
+	}
+	return new(big.Int).Add(claimedNonce, big.NewInt(1)), nil
+}
+
+func (validator *ChannelPaymentValidator) limitedCurrentBlock(ctx context.Context) (currentBlock *big.Int, err error) {
+	if validator.currentBlockSlots != nil {
+		if validator.failFast {
+			select {
+			case validator.currentBlockSlots <- struct{}{}:
+			default:
+				return nil, NewPaymentError(Internal, "too many concurrent validations")
+			}
+		} else {
+			select {
+			case validator.currentBlockSlots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, NewPaymentError(Internal, "validation is cancelled: %v", ctx.Err())
+			}
+		}
+		defer func() { <-validator.currentBlockSlots }()
+	}
+
+	currentBlock, e := validator.currentBlock()
+	if e != nil {
+		return nil, NewPaymentError(Internal, "cannot determine current block")
+	}
+	return currentBlock, nil
+}
+
+// confirmedBlock returns latest block which has required number of
+// confirmations, it is never less than zero.
+func (validator *ChannelPaymentValidator) confirmedBlock(currentBlock *big.Int) *big.Int {
+	if validator.confirmations <= 0 {
+		return currentBlock
+	}
+	confirmedBlock := new(big.Int).Sub(currentBlock, big.NewInt(validator.confirmations))
+	if confirmedBlock.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	return confirmedBlock
+}
+
+// VerifyChannelSignature checks that channel Signature is a signature of the
+// payment which authorizes channel AuthorizedAmount, and that it is signed by
+// channel payment signer, see PaymentChannelData.PaymentSignerAddress.
+// Channel state doesn't keep address of MultiPartyEscrow contract, so it
+// should be passed by caller. Nil signature means that no payments were made
+// on the current channel nonce and it is accepted.
+func VerifyChannelSignature(channel *PaymentChannelData, mpeContractAddress common.Address) error {
+	if channel.Signature == nil {
+		return nil
+	}
+
+	payment := getPaymentFromChannel(channel)
+	payment.MpeContractAddress = mpeContractAddress
+	signer, err := getSignerAddressFromPayment(payment)
+	if err != nil {
+		return fmt.Errorf("channel signature is not valid: %v", err)
+	}
+	if *signer != channel.PaymentSignerAddress() {
+		return fmt.Errorf("channel signature is not signed by channel signer, signer: %v", blockchain.AddressToHex(signer))
+	}
+
+	return nil
+}
+
+func (validator *ChannelPaymentValidator) isSignerAllowed(signer *common.Address) bool {
+	if len(validator.signerAllowlist) == 0 {
+		return true
+	}
+	for _, allowed := range validator.signerAllowlist {
+		if allowed == *signer {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedThreshold memoizes result of the threshold function. Function is
+// called once per invalidation even if value is requested concurrently.
+type cachedThreshold struct {
+	threshold func() *big.Int
+	mutex     sync.Mutex
+	entry     *cachedThresholdEntry
+}
+
+type cachedThresholdEntry struct {
+	once  sync.Once
+	value *big.Int
+}
+
+func newCachedThreshold(threshold func() *big.Int) *cachedThreshold {
+	return &cachedThreshold{
+		threshold: threshold,
+		entry:     &cachedThresholdEntry{},
+	}
+}
+
+func (cache *cachedThreshold) get() *big.Int {
+	cache.mutex.Lock()
+	entry := cache.entry
+	cache.mutex.Unlock()
+
+	entry.once.Do(func() {
+		entry.value = cache.threshold()
+	})
+	return entry.value
+}
+
+func (cache *cachedThreshold) invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entry = &cachedThresholdEntry{}
+}
+
+func (validator *ChannelPaymentValidator) getSignaturePrefix() []byte {
+	if validator.signaturePrefix == nil {
+		return blockchain.HashPrefix32Bytes
+	}
+	return validator.signaturePrefix
+}
+
+// getSignatureVerifier returns verifier for the curve of the payment key.
+// Verifier passed using WithSignatureVerifier is used for Secp256k1 only.
+func (validator *ChannelPaymentValidator) getSignatureVerifier(curve CurveType) (SignatureVerifier, error) {
+	if curve == Secp256k1 && validator.signatureVerifier != nil {
+		return validator.signatureVerifier, nil
+	}
+	return getLocalSignatureVerifier(curve)
+}
+
+func getLocalSignatureVerifier(curve CurveType) (SignatureVerifier, error) {
+	switch curve {
+	case Secp256k1:
+		return localSignatureVerifier, nil
+	case P256:
+		return localP256SignatureVerifier, nil
+	default:
+		return nil, NewPaymentError(Unauthenticated, "unsupported payment curve type: %v", curve)
+	}
+}
+
+func (validator *ChannelPaymentValidator) getSignerAddressFromPayment(payment *Payment) (signer *common.Address, err error) {
+	if validator.signerCache != nil {
+		if cached, ok := validator.signerCache.get(payment); ok {
+			return &cached, nil
+		}
+	}
+
+	verifier, err := validator.getSignatureVerifier(payment.CurveType)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := withDecodedSignature(payment, validator.chainID)
+	if err != nil {
+		return nil, err
+	}
+	signer, err = getSignerAddressFromPaymentWith(verifier, validator.getSignaturePrefix(), decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if validator.signerCache != nil {
+		validator.signerCache.put(payment, *signer)
+	}
+	return signer, nil
 }
 
 func getSignerAddressFromPayment(payment *Payment) (signer *common.Address, err error) {
+	verifier, err := getLocalSignatureVerifier(payment.CurveType)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := withDecodedSignature(payment, nil)
+	if err != nil {
+		return nil, err
+	}
+	return getSignerAddressFromPaymentWith(verifier, blockchain.HashPrefix32Bytes, decoded)
+}
+
+func getSignerAddressFromPaymentWith(verifier SignatureVerifier, prefix []byte, payment *Payment) (signer *common.Address, err error) {
+	if err = checkSignatureComponents(payment.Signature); err != nil {
+		log.WithField("payment", payment).WithError(err).Error("Malformed payment signature")
+		return nil, err
+	}
+
+	message, err := getPaymentMessage(payment)
+	if err != nil {
+		log.WithField("payment", payment).WithError(err).Error("Cannot build payment message")
+		return nil, err
+	}
+
+	signer, err = getSignerAddressFromMessageWith(verifier, prefix, message, payment.Signature)
+	if err != nil {
+		log.WithField("payment", payment).WithError(err).Error("Cannot get signer from payment")
+		return nil, err
+	}
+
+	if err = checkRecoveredSigner(signer); err != nil {
+		log.WithField("payment", payment).WithError(err).Error("Incorrect signer is recovered from payment")
+		return nil, err
+	}
+
+	return signer, err
+}
+
+// checkRecoveredSigner rejects zero address which can be returned when
+// signature recovery fails silently and which could match zero channel
+// signer.
+func checkRecoveredSigner(signer *common.Address) error {
+	if *signer == (common.Address{}) {
+		return NewPaymentError(Unauthenticated, "recovered signer is zero address")
+	}
+	return nil
+}
+
+// getPaymentMessage returns message which is signed by payment signer. Each
+// number is encoded canonically as 32 bytes big-endian unsigned integer, so
+// numbers which don't fit into 256 bits and negative numbers are rejected:
+// otherwise they are truncated or lose sign and signature of one channel
+// could be accepted for another one. ContextBytes are appended when payment
+// uses ContextBoundPreimage scheme.
+func getPaymentMessage(payment *Payment) ([]byte, error) {
+	fields := []struct {
+		name  string
+		value *big.Int
+	}{
+		{"channel id", payment.ChannelID},
+		{"channel nonce", payment.ChannelNonce},
+		{"amount", payment.Amount},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			return nil, NewPaymentError(Unauthenticated, "payment %v is not set", field.name)
+		}
+		if field.value.Sign() < 0 {
+			return nil, NewPaymentError(Unauthenticated, "payment %v is negative", field.name)
+		}
+		if field.value.BitLen() > 256 {
+			return nil, NewPaymentError(Unauthenticated, "payment %v doesn't fit into 256 bits", field.name)
+		}
+	}
+
 	message := bytes.Join([][]byte{
 		payment.MpeContractAddress.Bytes(),
 		bigIntToBytes(payment.ChannelID),
@@ -76,47 +1322,75 @@ func getSignerAddressFromPayment(payment *Payment) (signer *common.Address, err
 		bigIntToBytes(payment.Amount),
 	}, nil)
 
-	signer, err = getSignerAddressFromMessage(message, payment.Signature)
-	if err != nil {
-		log.WithField("payment", payment).WithError(err).Error("Cannot get signer from payment")
-		return nil, err
+	switch payment.PreimageScheme {
+	case DefaultPreimage:
+		if len(payment.ContextBytes) > 0 {
+			return nil, NewPaymentError(Unauthenticated, "payment context bytes are not signed by default preimage scheme")
+		}
+		return message, nil
+	case ContextBoundPreimage:
+		return append(message, payment.ContextBytes...), nil
+	default:
+		return nil, NewPaymentError(Unauthenticated, "unsupported payment preimage scheme: %v", payment.PreimageScheme)
 	}
+}
 
-	return signer, err
+// checkSignatureComponents rejects signatures with zero R or S component.
+// Such signatures are never valid but are not rejected explicitly by all
+// recovery implementations. Signatures of incorrect length are left to be
+// rejected by recovery.
+func checkSignatureComponents(signature []byte) error {
+	if len(signature) != 65 {
+		return nil
+	}
+	if isZeroBytes(signature[0:32]) {
+		return NewPaymentError(MalformedSignature, "payment signature R component is zero")
+	}
+	if isZeroBytes(signature[32:64]) {
+		return NewPaymentError(MalformedSignature, "payment signature S component is zero")
+	}
+	return nil
+}
+
+func isZeroBytes(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
 }
 
 func getSignerAddressFromMessage(message, signature []byte) (signer *common.Address, err error) {
+	return getSignerAddressFromMessageWith(localSignatureVerifier, blockchain.HashPrefix32Bytes, message, signature)
+}
+
+// getSignerAddressFromMessageWith recovers signer of the message, prefix is
+// prepended to the message hash before hashing it again.
+func getSignerAddressFromMessageWith(verifier SignatureVerifier, prefix, message, signature []byte) (signer *common.Address, err error) {
 	log := log.WithFields(log.Fields{
-		"message":   blockchain.BytesToBase64(message),
-		"signature": blockchain.BytesToBase64(signature),
+		"message":   loggedMessage(message),
+		"signature": loggedSignature(signature),
 	})
 
 	messageHash := crypto.Keccak256(
-		blockchain.HashPrefix32Bytes,
+		prefix,
 		crypto.Keccak256(message),
 	)
 	log = log.WithField("messageHash", hex.EncodeToString(messageHash))
 
-	v, _, _, e := blockchain.ParseSignature(signature)
-	if e != nil {
-		log.WithError(e).Warn("Error parsing signature")
-		return nil, errors.New("incorrect signature length")
-	}
-
-	modifiedSignature := bytes.Join([][]byte{signature[0:64], {v % 27}}, nil)
-	publicKey, e := crypto.SigToPub(messageHash, modifiedSignature)
-	if e != nil {
-		log.WithError(e).WithField("modifiedSignature", modifiedSignature).Warn("Incorrect signature")
-		return nil, errors.New("incorrect signature data")
+	keyOwnerAddress, err := verifier.RecoverSigner(messageHash, signature)
+	if err != nil {
+		log.WithError(err).Warn("Cannot recover signer")
+		return nil, err
 	}
-	log = log.WithField("publicKey", publicKey)
-
-	keyOwnerAddress := crypto.PubkeyToAddress(*publicKey)
 	log.WithField("keyOwnerAddress", keyOwnerAddress).Debug("Message signature parsed")
 
 	return &keyOwnerAddress, nil
 }
 
+// bigIntToBytes encodes value as 32 bytes big-endian left-padded by zeros.
+// Value is expected to be non-negative and fit into 256 bits.
 func bigIntToBytes(value *big.Int) []byte {
 	return common.BigToHash(value).Bytes()
 }
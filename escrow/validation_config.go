@@ -0,0 +1,81 @@
+package escrow
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ChannelPaymentValidatorConfig contains settings of ChannelPaymentValidator.
+// CurrentBlock and PaymentExpirationThreshold are required, other fields are
+// optional and zero values keep the default behavior.
+type ChannelPaymentValidatorConfig struct {
+	// CurrentBlock returns current block of the blockchain, required.
+	CurrentBlock func() (currentBlock *big.Int, err error)
+	// PaymentExpirationThreshold returns number of blocks before channel
+	// expiration when payments are not accepted anymore, required.
+	PaymentExpirationThreshold func() (threshold *big.Int)
+	// PricePerCall is optional, see WithPriceIncrementCheck.
+	PricePerCall func() (price *big.Int)
+	// BlockConfirmations is optional, see WithBlockConfirmations.
+	BlockConfirmations int64
+	// NonceLag is optional, see WithNonceLag.
+	NonceLag int64
+	// BlockSkewTolerance is optional, see WithBlockSkewTolerance.
+	BlockSkewTolerance int64
+	// MaxExpirationHorizon is optional, see WithMaxExpirationHorizon.
+	MaxExpirationHorizon *big.Int
+	// Options are applied after the settings above, they allow setting
+	// parameters which have no dedicated field in the config.
+	Options []ChannelPaymentValidatorOption
+}
+
+// validate returns error describing the first incorrect field of the config.
+func (cfg *ChannelPaymentValidatorConfig) validate() error {
+	if cfg.CurrentBlock == nil {
+		return errors.New("current block function is required")
+	}
+	if cfg.PaymentExpirationThreshold == nil {
+		return errors.New("payment expiration threshold function is required")
+	}
+	numbers := []struct {
+		name  string
+		value int64
+	}{
+		{"block confirmations", cfg.BlockConfirmations},
+		{"nonce lag", cfg.NonceLag},
+		{"block skew tolerance", cfg.BlockSkewTolerance},
+	}
+	for _, number := range numbers {
+		if number.value < 0 {
+			return fmt.Errorf("%v is negative: %v", number.name, number.value)
+		}
+	}
+	if cfg.MaxExpirationHorizon != nil && cfg.MaxExpirationHorizon.Sign() <= 0 {
+		return fmt.Errorf("max expiration horizon is not positive: %v", cfg.MaxExpirationHorizon)
+	}
+	return nil
+}
+
+// NewChannelPaymentValidatorFromConfig returns new payment validator
+// instance configured by cfg, or error if config is incorrect.
+func NewChannelPaymentValidatorFromConfig(cfg ChannelPaymentValidatorConfig) (*ChannelPaymentValidator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("incorrect payment validator config: %v", err)
+	}
+
+	validator := &ChannelPaymentValidator{
+		currentBlock:               cfg.CurrentBlock,
+		paymentExpirationThreshold: cfg.PaymentExpirationThreshold,
+		metrics:                    newValidationMetrics(),
+		pricePerCall:               cfg.PricePerCall,
+		confirmations:              cfg.BlockConfirmations,
+		nonceLag:                   cfg.NonceLag,
+		blockSkewTolerance:         cfg.BlockSkewTolerance,
+		maxExpirationHorizon:       cfg.MaxExpirationHorizon,
+	}
+	for _, option := range cfg.Options {
+		option(validator)
+	}
+	return validator, nil
+}
@@ -0,0 +1,61 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validTestValidatorConfig() ChannelPaymentValidatorConfig {
+	return ChannelPaymentValidatorConfig{
+		CurrentBlock:               func() (*big.Int, error) { return big.NewInt(99), nil },
+		PaymentExpirationThreshold: func() *big.Int { return big.NewInt(0) },
+	}
+}
+
+func TestNewChannelPaymentValidatorFromConfig(t *testing.T) {
+	fixtures := newTestFixtures("config")
+	cfg := validTestValidatorConfig()
+	cfg.PricePerCall = func() *big.Int { return big.NewInt(45) }
+	cfg.NonceLag = 1
+	cfg.Options = []ChannelPaymentValidatorOption{WithSignerAllowlist(fixtures.Address("signer"))}
+
+	validator, err := NewChannelPaymentValidatorFromConfig(cfg)
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	assert.Nil(t, validator.Validate(fixtures.Payment(42, 4, 12345), fixtures.Channel(42, 3, 12345, 12300, 100)))
+	assert.Equal(t, InsufficientIncrement, validator.Validate(fixtures.Payment(42, 3, 12344), fixtures.Channel(42, 3, 12345, 12300, 100)).(*PaymentError).Code)
+}
+
+func TestNewChannelPaymentValidatorFromIncorrectConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch func(cfg *ChannelPaymentValidatorConfig)
+		err   error
+	}{
+		{"no current block", func(cfg *ChannelPaymentValidatorConfig) { cfg.CurrentBlock = nil },
+			errors.New("incorrect payment validator config: current block function is required")},
+		{"no expiration threshold", func(cfg *ChannelPaymentValidatorConfig) { cfg.PaymentExpirationThreshold = nil },
+			errors.New("incorrect payment validator config: payment expiration threshold function is required")},
+		{"negative block confirmations", func(cfg *ChannelPaymentValidatorConfig) { cfg.BlockConfirmations = -1 },
+			errors.New("incorrect payment validator config: block confirmations is negative: -1")},
+		{"negative nonce lag", func(cfg *ChannelPaymentValidatorConfig) { cfg.NonceLag = -2 },
+			errors.New("incorrect payment validator config: nonce lag is negative: -2")},
+		{"negative block skew tolerance", func(cfg *ChannelPaymentValidatorConfig) { cfg.BlockSkewTolerance = -3 },
+			errors.New("incorrect payment validator config: block skew tolerance is negative: -3")},
+		{"zero max expiration horizon", func(cfg *ChannelPaymentValidatorConfig) { cfg.MaxExpirationHorizon = big.NewInt(0) },
+			errors.New("incorrect payment validator config: max expiration horizon is not positive: 0")},
+	}
+
+	for _, test := range tests {
+		cfg := validTestValidatorConfig()
+		test.patch(&cfg)
+
+		validator, err := NewChannelPaymentValidatorFromConfig(cfg)
+
+		assert.Equal(t, test.err, err, test.name)
+		assert.Nil(t, validator, test.name)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build go1.18
+// +build go1.18
+
+package escrow
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzGetSignerAddressFromPayment(f *testing.F) {
+	fixtures := newTestFixtures("fuzz")
+	valid := fixtures.Payment(42, 3, 12345).Signature
+	f.Add(valid, uint8(Secp256k1))
+	f.Add(valid, uint8(P256))
+	f.Add([]byte{}, uint8(Secp256k1))
+	f.Add(valid[:64], uint8(Secp256k1))
+	f.Add(append(append([]byte{}, valid[:64]...), 0x00, 0x25), uint8(Secp256k1))
+	f.Add(bytes.Repeat([]byte{0xFF}, 65), uint8(P256))
+	f.Add(bytes.Repeat([]byte{0x00}, 65), uint8(Secp256k1))
+
+	f.Fuzz(func(t *testing.T, signature []byte, curve uint8) {
+		payment := fixtures.Payment(42, 3, 12345)
+		payment.Signature = signature
+		payment.CurveType = CurveType(curve)
+
+		signer, err := getSignerAddressFromPayment(payment)
+
+		if err != nil {
+			if signer != nil {
+				t.Fatalf("signer %v is returned with error %v", signer, err)
+			}
+			return
+		}
+		if len(signature) != 65 {
+			t.Fatalf("signer %v is recovered from signature of length %v", signer.Hex(), len(signature))
+		}
+		if curve > uint8(P256) {
+			t.Fatalf("signer %v is recovered for unsupported curve %v", signer.Hex(), curve)
+		}
+		if signer == nil || isZeroBytes(signer.Bytes()) {
+			t.Fatalf("zero signer is recovered without error")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package escrow
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// MetricsSnapshot is a point in time copy of the validator counters. It can
+// be serialized to JSON and published via expvar.
+type MetricsSnapshot struct {
+	// Validations is a total number of validated payments
+	Validations uint64 `json:"validations"`
+	// Failures contains number of failed validations per PaymentErrorCode
+	// name, errors which are not PaymentError are counted as Internal.
+	Failures map[string]uint64 `json:"failures"`
+}
+
+// validationMetrics keeps validation counters, all methods are safe for
+// concurrent use and nil receiver is ignored.
+type validationMetrics struct {
+	validations uint64
+	failures    sync.Map
+}
+
+func newValidationMetrics() *validationMetrics {
+	return &validationMetrics{}
+}
+
+func (metrics *validationMetrics) record(err error) {
+	if metrics == nil {
+		return
+	}
+
+	atomic.AddUint64(&metrics.validations, 1)
+	if err == nil {
+		return
+	}
+
+	counter, _ := metrics.failures.LoadOrStore(paymentErrorCode(err), new(uint64))
+	atomic.AddUint64(counter.(*uint64), 1)
+}
+
+// paymentErrorCode returns code of the PaymentError, other errors are
+// treated as Internal.
+func paymentErrorCode(err error) PaymentErrorCode {
+	if paymentErr, ok := err.(*PaymentError); ok {
+		return paymentErr.Code
+	}
+	return Internal
+}
+
+func (metrics *validationMetrics) snapshot() MetricsSnapshot {
+	snapshot := MetricsSnapshot{Failures: make(map[string]uint64)}
+	if metrics == nil {
+		return snapshot
+	}
+
+	snapshot.Validations = atomic.LoadUint64(&metrics.validations)
+	metrics.failures.Range(func(code, counter interface{}) bool {
+		snapshot.Failures[code.(PaymentErrorCode).String()] = atomic.LoadUint64(counter.(*uint64))
+		return true
+	})
+	return snapshot
+}
+
+// MetricsSnapshot returns current values of the validation counters.
+// Validator created without NewChannelPaymentValidator returns empty
+// snapshot.
+func (validator *ChannelPaymentValidator) MetricsSnapshot() MetricsSnapshot {
+	return validator.metrics.snapshot()
+}
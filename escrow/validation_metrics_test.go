@@ -0,0 +1,55 @@
+package escrow
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsSnapshot(t *testing.T) {
+	fixtures := newTestFixtures("metrics")
+	validator := ChannelPaymentValidatorMock()
+	validator.metrics = newValidationMetrics()
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+
+	validator.Validate(fixtures.Payment(42, 3, 12345), channel)
+	validator.Validate(fixtures.Payment(42, 3, 12345), channel)
+	validator.Validate(fixtures.Payment(42, 2, 12345), channel)
+	validator.Validate(fixtures.Payment(42, 3, 12346), channel)
+
+	assert.Equal(t, MetricsSnapshot{
+		Validations: 4,
+		Failures: map[string]uint64{
+			"IncorrectNonce":  1,
+			"Unauthenticated": 1,
+		},
+	}, validator.MetricsSnapshot())
+}
+
+func TestMetricsSnapshotCountsOtherErrorsAsInternal(t *testing.T) {
+	metrics := newValidationMetrics()
+
+	metrics.record(errors.New("unexpected error"))
+
+	assert.Equal(t, MetricsSnapshot{Validations: 1, Failures: map[string]uint64{"Internal": 1}}, metrics.snapshot())
+}
+
+func TestMetricsSnapshotWithoutMetrics(t *testing.T) {
+	validator := ChannelPaymentValidatorMock()
+
+	validator.Validate(&Payment{ChannelNonce: big.NewInt(2)}, &PaymentChannelData{Nonce: big.NewInt(3)})
+
+	assert.Equal(t, MetricsSnapshot{Failures: map[string]uint64{}}, validator.MetricsSnapshot())
+}
+
+func TestMetricsSnapshotJSON(t *testing.T) {
+	snapshot := MetricsSnapshot{Validations: 2, Failures: map[string]uint64{"IncorrectNonce": 1}}
+
+	bytes, err := json.Marshal(snapshot)
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"validations":2,"failures":{"IncorrectNonce":1}}`, string(bytes))
+}
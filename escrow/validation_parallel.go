@@ -0,0 +1,70 @@
+package escrow
+
+import (
+	"runtime"
+	"sync"
+)
+
+// VerifyPaymentsParallel checks signatures of the payments using pool of
+// workers. It returns errors in the same order as payments were passed, error
+// is nil if signer address can be recovered from the payment signature. If
+// workers is not positive then number of CPUs is used.
+func VerifyPaymentsParallel(payments []*Payment, workers int) []error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	errs := make([]error, len(payments))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				_, errs[index] = getSignerAddressFromPayment(payments[index])
+			}
+		}()
+	}
+
+	for index := range payments {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
+
+// PaymentWithChannel is a payment accompanied by the state of its channel.
+type PaymentWithChannel struct {
+	Payment *Payment
+	Channel *PaymentChannelData
+}
+
+// VerifySignaturesAgainstChannels checks that each payment signature is
+// valid and is made by the payment signer of the corresponding channel, see
+// PaymentChannelData.PaymentSignerAddress. Neither nonce, amount nor
+// expiration are checked, so blockchain is not accessed. It returns errors in
+// the same order as pairs were passed, error is nil if signature is correct.
+func VerifySignaturesAgainstChannels(pairs []PaymentWithChannel) []error {
+	errs := make([]error, len(pairs))
+	for index, pair := range pairs {
+		errs[index] = verifySignatureAgainstChannel(pair.Payment, pair.Channel)
+	}
+	return errs
+}
+
+func verifySignatureAgainstChannel(payment *Payment, channel *PaymentChannelData) error {
+	signer, err := getSignerAddressFromPayment(payment)
+	if err != nil {
+		if paymentErr, ok := err.(*PaymentError); ok {
+			return paymentErr
+		}
+		return NewPaymentError(Unauthenticated, "payment signature is not valid")
+	}
+	if *signer != channel.PaymentSignerAddress() {
+		return NewPaymentError(Unauthenticated, "payment is not signed by channel signer")
+	}
+	return nil
+}
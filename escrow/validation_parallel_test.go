@@ -0,0 +1,102 @@
+package escrow
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPaymentsToVerify(count int) []*Payment {
+	privateKey := GenerateTestPrivateKey()
+	payments := make([]*Payment, count)
+	for i := range payments {
+		payment := validTestPayment()
+		payment.Amount = big.NewInt(int64(i))
+		SignTestPayment(payment, privateKey)
+		if i%3 == 0 {
+			payment.Signature = payment.Signature[:10]
+		}
+		payments[i] = payment
+	}
+	return payments
+}
+
+func verifyPaymentsSequential(payments []*Payment) []error {
+	errs := make([]error, len(payments))
+	for i, payment := range payments {
+		_, errs[i] = getSignerAddressFromPayment(payment)
+	}
+	return errs
+}
+
+func TestVerifyPaymentsParallel(t *testing.T) {
+	payments := testPaymentsToVerify(20)
+
+	errs := VerifyPaymentsParallel(payments, 4)
+
+	assert.Equal(t, verifyPaymentsSequential(payments), errs)
+	for i, err := range errs {
+		assert.Equal(t, i%3 == 0, err != nil, "payment %v", i)
+	}
+}
+
+func TestVerifyPaymentsParallelDefaultWorkers(t *testing.T) {
+	payments := testPaymentsToVerify(5)
+
+	errs := VerifyPaymentsParallel(payments, 0)
+
+	assert.Equal(t, verifyPaymentsSequential(payments), errs)
+}
+
+func BenchmarkVerifyPaymentsSequential(b *testing.B) {
+	payments := testPaymentsToVerify(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		verifyPaymentsSequential(payments)
+	}
+}
+
+func BenchmarkVerifyPaymentsParallel(b *testing.B) {
+	payments := testPaymentsToVerify(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		VerifyPaymentsParallel(payments, 0)
+	}
+}
+
+func TestVerifySignaturesAgainstChannels(t *testing.T) {
+	fixtures := newTestFixtures("verify signatures")
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	anotherChannel := fixtures.Channel(43, 3, 12345, 12300, 100)
+	anotherChannel.Signer = fixtures.Address("another signer")
+	truncated := fixtures.Payment(42, 3, 12345)
+	truncated.Signature = truncated.Signature[:10]
+
+	errs := VerifySignaturesAgainstChannels([]PaymentWithChannel{
+		{Payment: fixtures.Payment(42, 3, 12345), Channel: channel},
+		{Payment: fixtures.Payment(43, 3, 12345), Channel: anotherChannel},
+		{Payment: truncated, Channel: channel},
+		{Payment: fixtures.Payment(42, 3, 12400), Channel: channel},
+	})
+
+	assert.Equal(t, []error{
+		nil,
+		NewPaymentError(Unauthenticated, "payment is not signed by channel signer"),
+		NewPaymentError(Unauthenticated, "payment signature is not valid"),
+		nil,
+	}, errs)
+}
+
+func TestVerifySignaturesAgainstChannelsUsesPaymentSigner(t *testing.T) {
+	fixtures := newTestFixtures("verify signatures")
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	channel.Signer = fixtures.Address("sender")
+	channel.PaymentSigner = fixtures.Address("signer")
+
+	errs := VerifySignaturesAgainstChannels([]PaymentWithChannel{
+		{Payment: fixtures.Payment(42, 3, 12345), Channel: channel},
+	})
+
+	assert.Equal(t, []error{nil}, errs)
+}
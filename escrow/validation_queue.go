@@ -0,0 +1,70 @@
+package escrow
+
+import (
+	"context"
+	"time"
+)
+
+// validationQueue limits number of validations running concurrently and
+// keeps bounded number of validations waiting for the free slot. When queue
+// is full validation waits up to timeout for the place in the queue before
+// it is rejected.
+type validationQueue struct {
+	running chan struct{}
+	waiting chan struct{}
+	timeout time.Duration
+}
+
+func newValidationQueue(maxRunning int, depth int, timeout time.Duration) *validationQueue {
+	return &validationQueue{
+		running: make(chan struct{}, maxRunning),
+		waiting: make(chan struct{}, depth),
+		timeout: timeout,
+	}
+}
+
+// acquire returns nil when validation can be started, release should be
+// called when validation is finished.
+func (queue *validationQueue) acquire(ctx context.Context) error {
+	select {
+	case queue.running <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if err := queue.enqueue(ctx); err != nil {
+		return err
+	}
+	defer func() { <-queue.waiting }()
+
+	select {
+	case queue.running <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return NewPaymentError(Internal, "validation is cancelled: %v", ctx.Err())
+	}
+}
+
+func (queue *validationQueue) enqueue(ctx context.Context) error {
+	select {
+	case queue.waiting <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(queue.timeout)
+	defer timer.Stop()
+
+	select {
+	case queue.waiting <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return NewPaymentError(Internal, "validation queue full")
+	case <-ctx.Done():
+		return NewPaymentError(Internal, "validation is cancelled: %v", ctx.Err())
+	}
+}
+
+func (queue *validationQueue) release() {
+	<-queue.running
+}
@@ -0,0 +1,95 @@
+package escrow
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func queuedValidator(maxRunning, depth int, timeout time.Duration) (validator *ChannelPaymentValidator, started, release chan struct{}) {
+	started = make(chan struct{}, 100)
+	release = make(chan struct{})
+	validator = ChannelPaymentValidatorMock()
+	validator.currentBlock = func() (*big.Int, error) {
+		started <- struct{}{}
+		<-release
+		return big.NewInt(99), nil
+	}
+	WithValidationQueue(maxRunning, depth, timeout)(validator)
+	return
+}
+
+func waitQueueLength(t *testing.T, queue *validationQueue, length int) {
+	for i := 0; i < 1000 && len(queue.waiting) != length; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, length, len(queue.waiting))
+}
+
+func TestValidationQueueQueuesUnderLoad(t *testing.T) {
+	fixtures := newTestFixtures("queue")
+	validator, started, release := queuedValidator(1, 5, time.Millisecond)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 100000, 12300, 100))
+		}()
+	}
+	<-started
+	waitQueueLength(t, validator.queue, 5)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nil(t, err, "Unexpected error: %v", err)
+	}
+}
+
+func TestValidationQueueRejectsWhenFull(t *testing.T) {
+	fixtures := newTestFixtures("queue")
+	validator, started, release := queuedValidator(1, 1, 10*time.Millisecond)
+	done := make(chan error, 2)
+	go func() {
+		done <- validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 100000, 12300, 100))
+	}()
+	<-started
+	go func() {
+		done <- validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 100000, 12300, 100))
+	}()
+	waitQueueLength(t, validator.queue, 1)
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 100000, 12300, 100))
+
+	close(release)
+	assert.Equal(t, NewPaymentError(Internal, "validation queue full"), err)
+	assert.Nil(t, <-done)
+	assert.Nil(t, <-done)
+}
+
+func TestValidationQueueWaitsForPlaceInQueueUntilTimeout(t *testing.T) {
+	fixtures := newTestFixtures("queue")
+	validator, started, release := queuedValidator(1, 1, time.Minute)
+	done := make(chan error, 3)
+	validate := func() {
+		done <- validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 100000, 12300, 100))
+	}
+	go validate()
+	<-started
+	go validate()
+	waitQueueLength(t, validator.queue, 1)
+	go validate()
+
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, <-done)
+	}
+}
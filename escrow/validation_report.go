@@ -0,0 +1,253 @@
+package escrow
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+// ValidationReport explains which validation checks payment passed and
+// which failed. It is intended to be read by people who support clients.
+type ValidationReport struct {
+	// Entries contains results of the checks in order of execution
+	Entries []ValidationReportEntry
+}
+
+// ValidationReportEntry is a result of the single validation check
+type ValidationReportEntry struct {
+	// Check is a name of the check
+	Check string
+	// Passed is true if payment passed the check
+	Passed bool
+	// Detail is a human-readable explanation of the check result
+	Detail string
+}
+
+// Valid returns true if all checks are passed
+func (report *ValidationReport) Valid() bool {
+	for _, entry := range report.Entries {
+		if !entry.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (report *ValidationReport) String() string {
+	lines := make([]string, 0, len(report.Entries))
+	for _, entry := range report.Entries {
+		result := "FAIL"
+		if entry.Passed {
+			result = "PASS"
+		}
+		lines = append(lines, fmt.Sprintf("%v %v: %v", result, entry.Check, entry.Detail))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (report *ValidationReport) add(check string, passed bool, format string, args ...interface{}) {
+	report.Entries = append(report.Entries, ValidationReportEntry{
+		Check:  check,
+		Passed: passed,
+		Detail: fmt.Sprintf(format, args...),
+	})
+}
+
+// Diagnose runs all validation checks against the payment and returns
+// report which contains result of each check. Unlike Validate it doesn't
+// stop on the first failed check, doesn't modify payment and doesn't save
+// it. Checks which depend on the failed one are reported as failed.
+func (validator *ChannelPaymentValidator) Diagnose(payment *Payment, channel *PaymentChannelData) *ValidationReport {
+	report := &ValidationReport{}
+
+	if err := checkMissingFields(payment, channel); err != nil {
+		report.add("fields", false, "%v", err.Message)
+		return report
+	}
+
+	amount := payment.Amount
+	if validator.deltaAmounts {
+		amount = CumulativeFromDelta(channel.AuthorizedAmount, payment.Amount)
+	}
+
+	if len(validator.allowedGroupIDs) > 0 {
+		groupID := hex.EncodeToString(channel.GroupID[:])
+		if validator.allowedGroupIDs[channel.GroupID] {
+			report.add("group", true, "payment channel group %v is allowed", groupID)
+		} else {
+			report.add("group", false, "payment channel group %v is not allowed", groupID)
+		}
+	}
+
+	if len(validator.allowedSenders) > 0 {
+		sender := blockchain.AddressToHex(&channel.Sender)
+		if validator.allowedSenders[channel.Sender] {
+			report.add("sender", true, "payment channel sender %v is allowed", sender)
+		} else {
+			report.add("sender", false, "payment channel sender %v is not allowed", sender)
+		}
+	}
+
+	if validator.recipientPaymentAddress != nil {
+		if validator.isAcceptedRecipient(channel) {
+			report.add("recipient", true, "payment channel recipient %v is accepted", blockchain.AddressToHex(&channel.Recipient))
+		} else {
+			report.add("recipient", false, "%v", validator.recipientError(channel).Message)
+		}
+	}
+
+	expectedNonce, err := validator.expectedNonce(channel)
+	switch {
+	case err != nil:
+		report.add("nonce", false, "cannot read latest claimed nonce: %v", err)
+	case !validator.isAcceptableNonce(payment.ChannelNonce, expectedNonce):
+		report.add("nonce", false, "%v", validator.incorrectNonceError(payment.ChannelNonce, expectedNonce).Message)
+	case payment.ChannelNonce.Cmp(expectedNonce) != 0:
+		report.add("nonce", true, "payment nonce %v is within acceptable lag %v of channel nonce %v", payment.ChannelNonce, validator.nonceLag, expectedNonce)
+	default:
+		report.add("nonce", true, "payment nonce is equal to channel nonce %v", expectedNonce)
+	}
+
+	signed := *payment
+	signed.Amount = amount
+	signer, err := validator.getPaymentSigner(&signed, channel)
+	if err != nil {
+		report.add("signature", false, "payment signature is not valid: %v", err)
+		report.add("signer", false, "signer cannot be recovered from signature")
+	} else {
+		report.add("signature", true, "recovered signer: %v", blockchain.AddressToHex(signer))
+		validator.diagnoseSigner(report, signer, channel)
+	}
+
+	validator.diagnoseExpiration(report, channel)
+
+	if payment.CallDeadline != nil {
+		if err := checkCallDeadline(payment, channel); err != nil {
+			report.add("deadline", false, "%v", err.Message)
+		} else {
+			report.add("deadline", true, "payment channel expires at block %v after call deadline %v", channel.Expiration, payment.CallDeadline)
+		}
+	}
+
+	validator.diagnoseAmount(report, amount, channel)
+
+	if validator.proofOfFunds != nil {
+		validator.diagnoseProofOfFunds(report, &signed, channel)
+	}
+
+	if validator.fraudScorer != nil {
+		if err := validator.checkFraudScore(&signed, channel); err != nil {
+			report.add("fraud", false, "%v", err.Message)
+		} else {
+			report.add("fraud", true, "payment score is not above threshold %v", validator.fraudThreshold)
+		}
+	}
+
+	return report
+}
+
+func (validator *ChannelPaymentValidator) diagnoseSigner(report *ValidationReport, signer *common.Address, channel *PaymentChannelData) {
+	rotation, err := validator.signerRotation(channel)
+	if err != nil {
+		report.add("signer", false, "cannot read signer rotation window: %v", err)
+		return
+	}
+	if rotation != nil {
+		validator.diagnoseRotatedSigner(report, signer, rotation)
+		return
+	}
+
+	channelSigner := channel.PaymentSignerAddress()
+	isChannelSigner, err := validator.isChannelSigner(signer, channel)
+	switch {
+	case err != nil:
+		report.add("signer", false, "cannot resolve signer delegates: %v", err)
+	case !isChannelSigner:
+		report.add("signer", false, "payment is not signed by channel signer, payment signer: %v, channel signer: %v", blockchain.AddressToHex(signer), blockchain.AddressToHex(&channelSigner))
+	case !validator.isSignerAllowed(signer):
+		report.add("signer", false, "payment signer %v is not in the allowlist", blockchain.AddressToHex(signer))
+	case *signer != channelSigner:
+		report.add("signer", true, "payment is signed by delegate %v of channel signer %v", blockchain.AddressToHex(signer), blockchain.AddressToHex(&channelSigner))
+	default:
+		report.add("signer", true, "payment is signed by channel signer %v", blockchain.AddressToHex(signer))
+	}
+}
+
+func (validator *ChannelPaymentValidator) diagnoseRotatedSigner(report *ValidationReport, signer *common.Address, rotation *RotationWindow) {
+	currentBlock, err := validator.currentBlock()
+	if err != nil {
+		report.add("signer", false, "cannot determine current block: %v", err)
+		return
+	}
+	currentBlock = validator.confirmedBlock(currentBlock)
+	switch {
+	case !rotation.accepts(signer, currentBlock, validator.signerRotationWindow):
+		report.add("signer", false, "payment is not signed by channel signer, payment signer: %v, signer is rotated from %v to %v at block %v, current block: %v",
+			blockchain.AddressToHex(signer), blockchain.AddressToHex(&rotation.OldSigner), blockchain.AddressToHex(&rotation.NewSigner), rotation.EffectiveBlock, currentBlock)
+	case !validator.isSignerAllowed(signer):
+		report.add("signer", false, "payment signer %v is not in the allowlist", blockchain.AddressToHex(signer))
+	default:
+		report.add("signer", true, "payment is signed by channel signer %v accepted by rotation window", blockchain.AddressToHex(signer))
+	}
+}
+
+func (validator *ChannelPaymentValidator) diagnoseProofOfFunds(report *ValidationReport, payment *Payment, channel *PaymentChannelData) {
+	currentBlock, err := validator.currentBlock()
+	if err != nil {
+		report.add("funds", false, "cannot determine current block: %v", err)
+		return
+	}
+	if e := validator.verifyProofOfFunds(payment, channel, validator.confirmedBlock(currentBlock)); e != nil {
+		report.add("funds", false, "%v", e.Message)
+		return
+	}
+	report.add("funds", true, "proof of funds is accepted")
+}
+
+func (validator *ChannelPaymentValidator) diagnoseExpiration(report *ValidationReport, channel *PaymentChannelData) {
+	currentBlock, err := validator.currentBlock()
+	if err != nil {
+		report.add("expiration", false, "cannot determine current block: %v", err)
+		return
+	}
+	currentBlock = validator.confirmedBlock(currentBlock)
+	expirationThreshold := validator.expirationThreshold(channel)
+	maxExpirationHorizon := validator.expirationHorizon()
+
+	switch {
+	case new(big.Int).Add(currentBlock, expirationThreshold).Cmp(channel.Expiration) >= 0:
+		report.add("expiration", false, "payment channel is near to be expired, expiration time: %v, current block: %v, expiration threshold: %v", channel.Expiration, currentBlock, expirationThreshold)
+	case maxExpirationHorizon != nil && channel.Expiration.Cmp(new(big.Int).Add(currentBlock, maxExpirationHorizon)) > 0:
+		report.add("expiration", false, "implausible channel expiration %v, current block: %v, max expiration horizon: %v", channel.Expiration, currentBlock, maxExpirationHorizon)
+	default:
+		report.add("expiration", true, "channel expires at %v, current block: %v, expiration threshold: %v", channel.Expiration, currentBlock, expirationThreshold)
+	}
+}
+
+func (validator *ChannelPaymentValidator) diagnoseAmount(report *ValidationReport, amount *big.Int, channel *PaymentChannelData) {
+	if channel.FullAmount.Cmp(amount) < 0 {
+		report.add("amount", false, "not enough tokens on payment channel, channel amount: %v, payment amount: %v", channel.FullAmount, amount)
+		return
+	}
+	if validator.pricePerCall != nil {
+		price := validator.pricePerCall()
+		increment := new(big.Int).Sub(amount, channel.AuthorizedAmount)
+		if CompareTokenAmounts(increment, channel.tokenDecimals(), price, DefaultTokenDecimals) < 0 {
+			report.add("amount", false, "payment amount is incremented on less than price, authorized amount: %v, price: %v, payment amount: %v", channel.AuthorizedAmount, price, amount)
+			return
+		}
+	}
+	if validator.minRemainingCapacity != nil {
+		remaining := new(big.Int).Sub(channel.FullAmount, amount)
+		if remaining.Cmp(validator.minRemainingCapacity) < 0 {
+			report.add("amount", false, "remaining channel capacity %v is below minimum %v, channel should be topped up", remaining, validator.minRemainingCapacity)
+			return
+		}
+	}
+	report.add("amount", true, "payment amount %v is covered by channel amount %v", amount, channel.FullAmount)
+}
@@ -0,0 +1,97 @@
+package escrow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+func TestDiagnoseValidPayment(t *testing.T) {
+	fixtures := newTestFixtures("diagnose")
+	signer := fixtures.Address("signer")
+
+	report := ChannelPaymentValidatorMock().Diagnose(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.True(t, report.Valid())
+	assert.Equal(t, []ValidationReportEntry{
+		{Check: "nonce", Passed: true, Detail: "payment nonce is equal to channel nonce 3"},
+		{Check: "signature", Passed: true, Detail: "recovered signer: " + blockchain.AddressToHex(&signer)},
+		{Check: "signer", Passed: true, Detail: "payment is signed by channel signer " + blockchain.AddressToHex(&signer)},
+		{Check: "expiration", Passed: true, Detail: "channel expires at 100, current block: 99, expiration threshold: 0"},
+		{Check: "amount", Passed: true, Detail: "payment amount 12345 is covered by channel amount 12345"},
+	}, report.Entries)
+}
+
+func TestDiagnoseIncorrectSigner(t *testing.T) {
+	fixtures := newTestFixtures("diagnose")
+	payment := fixtures.Payment(42, 3, 12345)
+	SignTestPayment(payment, fixtures.PrivateKey("another signer"))
+	paymentSigner := fixtures.Address("another signer")
+	channelSigner := fixtures.Address("signer")
+
+	report := ChannelPaymentValidatorMock().Diagnose(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.False(t, report.Valid())
+	assert.Equal(t, ValidationReportEntry{
+		Check:  "signer",
+		Passed: false,
+		Detail: "payment is not signed by channel signer, payment signer: " + blockchain.AddressToHex(&paymentSigner) + ", channel signer: " + blockchain.AddressToHex(&channelSigner),
+	}, report.Entries[2])
+	for _, index := range []int{0, 1, 3, 4} {
+		assert.True(t, report.Entries[index].Passed, "Unexpected failed check: %v", report.Entries[index])
+	}
+}
+
+func TestDiagnoseInvalidSignature(t *testing.T) {
+	fixtures := newTestFixtures("diagnose")
+	payment := fixtures.Payment(42, 3, 12345)
+	payment.Signature = blockchain.HexToBytes("0x0000")
+
+	report := ChannelPaymentValidatorMock().Diagnose(payment, fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Equal(t, ValidationReportEntry{Check: "signature", Passed: false, Detail: "payment signature is not valid: incorrect signature length"}, report.Entries[1])
+	assert.Equal(t, ValidationReportEntry{Check: "signer", Passed: false, Detail: "signer cannot be recovered from signature"}, report.Entries[2])
+}
+
+func TestDiagnoseDisabledGroup(t *testing.T) {
+	fixtures := newTestFixtures("diagnose")
+	validator := ChannelPaymentValidatorMock()
+	WithAllowedGroupIDs([32]byte{1})(validator)
+
+	report := validator.Diagnose(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.False(t, report.Valid())
+	assert.Equal(t, ValidationReportEntry{Check: "group", Passed: false, Detail: "payment channel group 7b00000000000000000000000000000000000000000000000000000000000000 is not allowed"}, report.Entries[0])
+}
+
+func TestDiagnoseDisallowedSender(t *testing.T) {
+	fixtures := newTestFixtures("diagnose")
+	validator := ChannelPaymentValidatorMock()
+	WithAllowedSenders(fixtures.Address("other sender"))(validator)
+	sender := fixtures.Address("sender")
+
+	report := validator.Diagnose(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.False(t, report.Valid())
+	assert.Equal(t, ValidationReportEntry{Check: "sender", Passed: false, Detail: "payment channel sender " + blockchain.AddressToHex(&sender) + " is not allowed"}, report.Entries[0])
+}
+
+func TestDiagnosePaymentWithMissingField(t *testing.T) {
+	fixtures := newTestFixtures("missing")
+	channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+	channel.FullAmount = nil
+
+	report := ChannelPaymentValidatorMock().Diagnose(fixtures.Payment(42, 3, 12345), channel)
+
+	assert.Equal(t, []ValidationReportEntry{{Check: "fields", Passed: false, Detail: "missing payment field: channel.FullAmount"}}, report.Entries)
+}
+
+func TestValidationReportString(t *testing.T) {
+	report := &ValidationReport{}
+	report.add("nonce", true, "nonce is %v", 3)
+	report.add("signature", false, "signature is not valid")
+
+	assert.Equal(t, "PASS nonce: nonce is 3\nFAIL signature: signature is not valid", report.String())
+}
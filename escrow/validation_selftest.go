@@ -0,0 +1,113 @@
+package escrow
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/singnet/snet-daemon/blockchain"
+)
+
+// selfTestMpeContractAddress is an address of the MultiPartyEscrow contract
+// used in the synthetic payment of the self-test.
+var selfTestMpeContractAddress = common.HexToAddress("0x5e1f7e5700000000000000000000000000000001")
+
+// SelfTest signs synthetic payment by ephemeral key in the same way client
+// does and checks that validator recovers the right signer and accepts the
+// payment against synthetic channel. It is intended to be called at startup
+// to catch misconfiguration, for instance broken signature verifier.
+// Payment is signed using the signature prefix of the validator, see
+// WithSignaturePrefix. Self-test doesn't access blockchain and doesn't write
+// into storages.
+func (validator *ChannelPaymentValidator) SelfTest() (err error) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("validator self-test failed: cannot generate key: %v", err)
+	}
+	signer := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	selfTest := validator.withoutSideEffects()
+
+	price := big.NewInt(1)
+	if selfTest.pricePerCall != nil {
+		price = new(big.Int).Add(selfTest.pricePerCall(), price)
+	}
+	fullAmount := new(big.Int).Set(price)
+	if selfTest.minRemainingCapacity != nil {
+		fullAmount.Add(fullAmount, selfTest.minRemainingCapacity)
+	}
+	currentBlock := big.NewInt(selfTest.confirmations)
+	channel := &PaymentChannelData{
+		ChannelID:        big.NewInt(1),
+		Nonce:            big.NewInt(0),
+		Signer:           signer,
+		FullAmount:       fullAmount,
+		AuthorizedAmount: big.NewInt(0),
+	}
+	if selfTest.recipientPaymentAddress != nil {
+		channel.Recipient = selfTest.recipientPaymentAddress()
+	}
+	channel.Expiration = new(big.Int).Add(selfTest.expirationThreshold(channel), big.NewInt(1))
+	payment := &Payment{
+		MpeContractAddress: selfTestMpeContractAddress,
+		ChannelID:          channel.ChannelID,
+		ChannelNonce:       channel.Nonce,
+		Amount:             price,
+	}
+
+	message, err := getPaymentMessage(payment)
+	if err != nil {
+		return fmt.Errorf("validator self-test failed: %v", err)
+	}
+	payment.Signature, err = crypto.Sign(crypto.Keccak256(selfTest.getSignaturePrefix(), crypto.Keccak256(message)), privateKey)
+	if err != nil {
+		return fmt.Errorf("validator self-test failed: cannot sign payment: %v", err)
+	}
+
+	recovered, err := selfTest.getSignerAddressFromPayment(payment)
+	if err != nil {
+		return fmt.Errorf("validator self-test failed: cannot recover signer: %v", err)
+	}
+	if *recovered != signer {
+		return fmt.Errorf("validator self-test failed: recovered signer %v is not equal to expected %v", blockchain.AddressToHex(recovered), blockchain.AddressToHex(&signer))
+	}
+
+	if selfTest.hmacSecret != nil {
+		if payment.Signature, err = ComputePaymentMAC(payment, selfTest.hmacSecret); err != nil {
+			return fmt.Errorf("validator self-test failed: cannot compute payment MAC: %v", err)
+		}
+	}
+
+	if err = selfTest.ValidateAtBlock(payment, channel, currentBlock); err != nil {
+		return fmt.Errorf("validator self-test failed: synthetic payment is rejected: %v", err)
+	}
+	return nil
+}
+
+// withoutSideEffects returns validator which has only settings of the
+// validator affecting signature verification and payment acceptance. It
+// doesn't write into storages, doesn't record metrics and audit events and
+// doesn't call external services. Settings are copied explicitly, so a new
+// setting is not used by self-test unless it is added here.
+func (validator *ChannelPaymentValidator) withoutSideEffects() *ChannelPaymentValidator {
+	return &ChannelPaymentValidator{
+		currentBlock:                validator.currentBlock,
+		paymentExpirationThreshold:  validator.paymentExpirationThreshold,
+		expirationThresholdPolicies: validator.expirationThresholdPolicies,
+		pricePerCall:                validator.pricePerCall,
+		deltaAmounts:                validator.deltaAmounts,
+		confirmations:               validator.confirmations,
+		blockSkewTolerance:          validator.blockSkewTolerance,
+		nonceLag:                    validator.nonceLag,
+		minRemainingCapacity:        validator.minRemainingCapacity,
+		signatureVerifier:           validator.signatureVerifier,
+		signaturePrefix:             validator.signaturePrefix,
+		chainID:                     validator.chainID,
+		hmacSecret:                  validator.hmacSecret,
+		recipientPaymentAddress:     validator.recipientPaymentAddress,
+		recipientDelegations:        validator.recipientDelegations,
+		readOnly:                    true,
+	}
+}
@@ -0,0 +1,94 @@
+package escrow
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTest(t *testing.T) {
+	validator := ChannelPaymentValidatorMock()
+
+	assert.Nil(t, validator.SelfTest())
+}
+
+func TestSelfTestWithOptions(t *testing.T) {
+	storage := NewPaymentStorage(NewMemStorage())
+	validator := ChannelPaymentValidatorMock()
+	validator.paymentExpirationThreshold = func() *big.Int { return big.NewInt(100) }
+	WithPriceIncrementCheck(func() *big.Int { return big.NewInt(10) })(validator)
+	WithMinRemainingCapacity(big.NewInt(5))(validator)
+	WithBlockConfirmations(12)(validator)
+	WithDeltaAmounts()(validator)
+	WithPaymentPersistence(storage)(validator)
+
+	assert.Nil(t, validator.SelfTest())
+
+	payments, err := storage.GetAll()
+	assert.Nil(t, err)
+	assert.Empty(t, payments)
+}
+
+func TestSelfTestHasNoSideEffects(t *testing.T) {
+	memoryStorage := NewMemStorage()
+	sink := &capturingAuditSink{}
+	validator := ChannelPaymentValidatorMock()
+	validator.metrics = newValidationMetrics()
+	WithPaymentPersistence(NewPaymentStorage(memoryStorage))(validator)
+	WithPendingPayments(NewPendingPaymentStorage(memoryStorage, NewPaymentStorage(memoryStorage)))(validator)
+	WithSignatureGuard(NewSignatureGuard(memoryStorage))(validator)
+	WithSpendingCaps(NewSpendingCapTracker(memoryStorage, big.NewInt(100)))(validator)
+	WithAuditSink(sink)(validator)
+	WithSignerCache(16)(validator)
+
+	assert.Nil(t, validator.SelfTest())
+
+	assert.Empty(t, memoryStorage.data)
+	assert.Empty(t, sink.events)
+	assert.Equal(t, 0, validator.signerCache.lru.Len())
+	assert.Equal(t, uint64(0), validator.MetricsSnapshot().Validations)
+}
+
+func TestSelfTestWithExpirationThresholdPolicies(t *testing.T) {
+	validator := ChannelPaymentValidatorMock()
+	WithExpirationThresholdPolicies(func() *big.Int { return big.NewInt(30) })(validator)
+
+	assert.Nil(t, validator.SelfTest())
+}
+
+func TestSelfTestWithRecipientDelegations(t *testing.T) {
+	fixtures := newTestFixtures("self-test")
+	validator := ChannelPaymentValidatorMock()
+	WithRecipientDelegations(func() common.Address { return fixtures.Address("recipient") }, RecipientDelegations{})(validator)
+
+	assert.Nil(t, validator.SelfTest())
+}
+
+func TestSelfTestWithSignaturePrefix(t *testing.T) {
+	validator := ChannelPaymentValidatorMock()
+	WithSignaturePrefix([]byte("\x19Custom Signed Message:\n32"))(validator)
+
+	assert.Nil(t, validator.SelfTest())
+}
+
+func TestSelfTestFailsWhenSignatureVerifierRecoversWrongSigner(t *testing.T) {
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureVerifier(&signatureVerifierMock{signer: common.HexToAddress("0x1")})(validator)
+
+	err := validator.SelfTest()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "validator self-test failed: recovered signer 0x0000000000000000000000000000000000000001 is not equal to expected")
+}
+
+func TestSelfTestFailsWhenSignatureVerifierIsBroken(t *testing.T) {
+	validator := ChannelPaymentValidatorMock()
+	WithSignatureVerifier(&signatureVerifierMock{err: errors.New("KMS is not available")})(validator)
+
+	err := validator.SelfTest()
+
+	assert.Equal(t, errors.New("validator self-test failed: cannot recover signer: KMS is not available"), err)
+}
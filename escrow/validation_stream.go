@@ -0,0 +1,64 @@
+package escrow
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// ValidationResult is a result of validation of the single payment from the
+// stream. Payment is nil if payment cannot be decoded from the stream.
+type ValidationResult struct {
+	// Payment is a decoded payment
+	Payment *Payment
+	// Err is nil if payment is valid, otherwise it contains decoding, channel
+	// lookup or validation error.
+	Err error
+}
+
+// ValidateStream decodes payments from the reader one by one and validates each
+// of them against the channel returned by channelLookup. Reader should contain
+// payments encoded by single gob.Encoder. Results are sent to the returned
+// channel in order of payments in the stream, channel is closed after the end
+// of the stream or after the first decoding error. Caller should read all
+// results from the channel.
+func (validator *ChannelPaymentValidator) ValidateStream(r io.Reader, channelLookup func(channelID *big.Int) (*PaymentChannelData, error)) (<-chan ValidationResult, error) {
+	if r == nil {
+		return nil, errors.New("reader is not set")
+	}
+	if channelLookup == nil {
+		return nil, errors.New("channel lookup function is not set")
+	}
+
+	results := make(chan ValidationResult)
+	go func() {
+		defer close(results)
+
+		decoder := gob.NewDecoder(r)
+		for {
+			payment := &Payment{}
+			err := decoder.Decode(payment)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				results <- ValidationResult{Err: err}
+				return
+			}
+
+			results <- ValidationResult{
+				Payment: payment,
+				Err:     validator.validateWithLookup(payment, channelLookup),
+			}
+		}
+	}()
+
+	return results, nil
+}
+
+func (validator *ChannelPaymentValidator) validateWithLookup(payment *Payment, channelLookup func(*big.Int) (*PaymentChannelData, error)) error {
+	return validator.ValidateByChannelID(payment, func(channelID, nonce *big.Int) (*PaymentChannelData, error) {
+		return channelLookup(channelID)
+	})
+}
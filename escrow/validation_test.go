@@ -2,11 +2,16 @@ package escrow
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
+	"encoding/gob"
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -24,12 +29,19 @@ func ChannelPaymentValidatorMock() *ChannelPaymentValidator {
 }
 
 func SignTestPayment(payment *Payment, privateKey *ecdsa.PrivateKey) {
+	if err := payment.Validate(); err != nil {
+		panic(fmt.Sprintf("Cannot sign incorrect test payment: %v", err))
+	}
+
 	message := bytes.Join([][]byte{
 		payment.MpeContractAddress.Bytes(),
 		bigIntToBytes(payment.ChannelID),
 		bigIntToBytes(payment.ChannelNonce),
 		bigIntToBytes(payment.Amount),
 	}, nil)
+	if payment.PreimageScheme == ContextBoundPreimage {
+		message = append(message, payment.ContextBytes...)
+	}
 
 	payment.Signature = getSignature(message, privateKey)
 }
@@ -132,6 +144,55 @@ func (suite *ValidationTestSuite) TestValidatePaymentChannelNonce() {
 	assert.Equal(suite.T(), NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 2"), err)
 }
 
+func (suite *ValidationTestSuite) paymentWithNonce(nonce int64) *Payment {
+	payment := suite.payment()
+	payment.ChannelNonce = big.NewInt(nonce)
+	SignTestPayment(payment, suite.signerPrivateKey)
+	return payment
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentNonceAtUpperEdgeOfLag() {
+	validator := suite.validator
+	WithNonceLag(2)(&validator)
+
+	err := validator.Validate(suite.paymentWithNonce(5), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentNonceAtLowerEdgeOfLag() {
+	validator := suite.validator
+	WithNonceLag(2)(&validator)
+
+	err := validator.Validate(suite.paymentWithNonce(3), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentNonceBeyondLag() {
+	validator := suite.validator
+	WithNonceLag(2)(&validator)
+
+	err := validator.Validate(suite.paymentWithNonce(6), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 6, acceptable lag: 2"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentNonceBelowChannelNonceWithLag() {
+	validator := suite.validator
+	WithNonceLag(2)(&validator)
+
+	err := validator.Validate(suite.paymentWithNonce(2), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 2, acceptable lag: 2"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentNextNonceWithoutLag() {
+	err := suite.validator.Validate(suite.paymentWithNonce(4), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 4"), err)
+}
+
 func (suite *ValidationTestSuite) TestValidatePaymentIncorrectSignatureLength() {
 	payment := suite.payment()
 	payment.Signature = blockchain.HexToBytes("0x0000")
@@ -237,3 +298,1373 @@ func (suite *ValidationTestSuite) TestGetPublicKeyFromPayment2() {
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), blockchain.HexToAddress("0x592E3C0f3B038A0D673F19a18a773F993d4b2610"), *address)
 }
+
+func (suite *ValidationTestSuite) validatorWithPrice(price int64) *ChannelPaymentValidator {
+	validator := suite.validator
+	WithPriceIncrementCheck(func() *big.Int { return big.NewInt(price) })(&validator)
+	return &validator
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentExactIncrement() {
+	err := suite.validatorWithPrice(45).Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentInsufficientIncrement() {
+	err := suite.validatorWithPrice(46).Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(InsufficientIncrement, "payment amount is incremented on less than price, authorized amount: 12300, price: 46, payment amount: 12345"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentExcessiveIncrement() {
+	err := suite.validatorWithPrice(10).Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentIncrementChannelWith8DecimalsToken() {
+	channel := suite.channel()
+	channel.TokenDecimals = 8
+
+	err := suite.validatorWithPrice(45).Validate(suite.payment(), channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentIncrementChannelWith18DecimalsToken() {
+	channel := suite.channel()
+	channel.TokenDecimals = 18
+	channel.FullAmount = bigIntFromString("1000000000000000")
+	channel.AuthorizedAmount = big.NewInt(0)
+	payment := suite.payment()
+	payment.Amount = bigIntFromString("450000000000")
+	SignTestPayment(payment, suite.signerPrivateKey)
+
+	err := suite.validatorWithPrice(45).Validate(payment, channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentInsufficientIncrementChannelWith18DecimalsToken() {
+	channel := suite.channel()
+	channel.TokenDecimals = 18
+
+	err := suite.validatorWithPrice(45).Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(InsufficientIncrement, "payment amount is incremented on less than price, authorized amount: 12300, price: 45, payment amount: 12345"), err)
+}
+
+func (suite *ValidationTestSuite) TestExpirationThresholdCache() {
+	var calls int32
+	validator := &ChannelPaymentValidator{
+		currentBlock: func() (*big.Int, error) { return big.NewInt(99), nil },
+		paymentExpirationThreshold: func() *big.Int {
+			atomic.AddInt32(&calls, 1)
+			return big.NewInt(0)
+		},
+	}
+	WithExpirationThresholdCache()(validator)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := validator.Validate(suite.payment(), suite.channel())
+			assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(suite.T(), int32(1), atomic.LoadInt32(&calls))
+
+	validator.InvalidateExpirationThreshold()
+	err := validator.Validate(suite.payment(), suite.channel())
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	err = validator.Validate(suite.payment(), suite.channel())
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), int32(2), atomic.LoadInt32(&calls))
+}
+
+func (suite *ValidationTestSuite) TestValidateStream() {
+	valid := suite.payment()
+	incorrectNonce := suite.payment()
+	incorrectNonce.ChannelNonce = big.NewInt(2)
+	SignTestPayment(incorrectNonce, suite.signerPrivateKey)
+	unknownChannel := suite.payment()
+	unknownChannel.ChannelID = big.NewInt(43)
+	SignTestPayment(unknownChannel, suite.signerPrivateKey)
+	lookupFailed := suite.payment()
+	lookupFailed.ChannelID = big.NewInt(44)
+	SignTestPayment(lookupFailed, suite.signerPrivateKey)
+	var stream bytes.Buffer
+	encoder := gob.NewEncoder(&stream)
+	for _, payment := range []*Payment{valid, incorrectNonce, unknownChannel, lookupFailed} {
+		assert.Nil(suite.T(), encoder.Encode(payment))
+	}
+	lookup := func(channelID *big.Int) (*PaymentChannelData, error) {
+		switch channelID.Int64() {
+		case 42:
+			return suite.channel(), nil
+		case 44:
+			return nil, errors.New("storage error")
+		default:
+			return nil, nil
+		}
+	}
+
+	results, err := suite.validator.ValidateStream(&stream, lookup)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	actual := []ValidationResult{}
+	for result := range results {
+		actual = append(actual, result)
+	}
+	assert.Equal(suite.T(), []ValidationResult{
+		{Payment: valid, Err: nil},
+		{Payment: incorrectNonce, Err: NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 3, sent: 2")},
+		{Payment: unknownChannel, Err: NewPaymentError(Unauthenticated, "payment channel \"43\" not found")},
+		{Payment: lookupFailed, Err: NewPaymentError(Internal, "payment channel error: storage error")},
+	}, actual)
+}
+
+func (suite *ValidationTestSuite) TestValidateStreamCorruptedData() {
+	var stream bytes.Buffer
+	assert.Nil(suite.T(), gob.NewEncoder(&stream).Encode(suite.payment()))
+	stream.WriteString("corrupted")
+
+	results, err := suite.validator.ValidateStream(&stream, func(*big.Int) (*PaymentChannelData, error) {
+		return suite.channel(), nil
+	})
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	first := <-results
+	assert.Nil(suite.T(), first.Err, "Unexpected error: %v", first.Err)
+	second := <-results
+	assert.Nil(suite.T(), second.Payment)
+	assert.NotNil(suite.T(), second.Err)
+	_, ok := <-results
+	assert.False(suite.T(), ok)
+}
+
+func (suite *ValidationTestSuite) TestValidateStreamNoLookup() {
+	results, err := suite.validator.ValidateStream(&bytes.Buffer{}, nil)
+
+	assert.Equal(suite.T(), errors.New("channel lookup function is not set"), err)
+	assert.Nil(suite.T(), results)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSignerInAllowlist() {
+	validator := suite.validator
+	WithSignerAllowlist(suite.senderAddress, suite.signerAddress)(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSignerNotInAllowlist() {
+	validator := suite.validator
+	WithSignerAllowlist(suite.senderAddress)(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment signer is not in the allowlist"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentAllowedSignerIsNotChannelSigner() {
+	validator := suite.validator
+	otherKey := GenerateTestPrivateKey()
+	WithSignerAllowlist(suite.signerAddress, crypto.PubkeyToAddress(otherKey.PublicKey))(&validator)
+	payment := suite.payment()
+	SignTestPayment(payment, otherKey)
+
+	err := validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func (suite *ValidationTestSuite) TestCheckRecoveredSignerZeroAddress() {
+	// Finding a signature which recovers to the zero address is not feasible,
+	// so the guard is checked directly.
+	err := checkRecoveredSigner(&common.Address{})
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "recovered signer is zero address"), err)
+}
+
+func (suite *ValidationTestSuite) TestCheckRecoveredSignerNonZeroAddress() {
+	err := checkRecoveredSigner(&suite.signerAddress)
+
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentZeroChannelSignerIsNotMatched() {
+	payment := suite.payment()
+	payment.Signature = blockchain.HexToBytes("0xa4d2ae6f3edd1f7fe77e4f6f78ba18d62e6093bcae01ef86d5de902d33662fa372011287ea2d8d8436d9db8a366f43480678df25453b484c67f80941ef2c05ef21")
+	channel := suite.channel()
+	channel.Signer = common.Address{}
+
+	err := suite.validator.Validate(payment, channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment signature is not valid"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentZeroSignatureR() {
+	payment := suite.payment()
+	copy(payment.Signature[0:32], make([]byte, 32))
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(MalformedSignature, "payment signature R component is zero"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentZeroSignatureS() {
+	payment := suite.payment()
+	copy(payment.Signature[32:64], make([]byte, 32))
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(MalformedSignature, "payment signature S component is zero"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentZeroSignature() {
+	payment := suite.payment()
+	payment.Signature = make([]byte, 65)
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(MalformedSignature, "payment signature R component is zero"), err)
+}
+
+func (suite *ValidationTestSuite) TestCumulativeFromDelta() {
+	assert.Equal(suite.T(), big.NewInt(12345), CumulativeFromDelta(big.NewInt(12300), big.NewInt(45)))
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentDeltaAndCumulativeModes() {
+	validator := suite.validator
+	WithDeltaAmounts()(&validator)
+	cumulativePayment := suite.payment()
+	deltaPayment := suite.payment()
+	deltaPayment.Amount = big.NewInt(45)
+
+	amountCumulative, errCumulative := suite.validator.ValidateCumulative(cumulativePayment, suite.channel())
+	amountDelta, errDelta := validator.ValidateCumulative(deltaPayment, suite.channel())
+
+	assert.Nil(suite.T(), errCumulative, "Unexpected error: %v", errCumulative)
+	assert.Nil(suite.T(), errDelta, "Unexpected error: %v", errDelta)
+	assert.Equal(suite.T(), big.NewInt(12345), amountCumulative)
+	assert.Equal(suite.T(), big.NewInt(12345), amountDelta)
+	assert.Equal(suite.T(), big.NewInt(45), deltaPayment.Amount)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentDeltaModeSignedDelta() {
+	validator := suite.validator
+	WithDeltaAmounts()(&validator)
+	payment := suite.payment()
+	payment.Amount = big.NewInt(45)
+	SignTestPayment(payment, suite.signerPrivateKey)
+
+	err := validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+	assert.Equal(suite.T(), big.NewInt(45), payment.Amount)
+}
+
+func (suite *ValidationTestSuite) signedChannel(privateKey *ecdsa.PrivateKey) *PaymentChannelData {
+	channel := suite.channel()
+	payment := suite.payment()
+	payment.Amount = channel.AuthorizedAmount
+	SignTestPayment(payment, privateKey)
+	channel.Signature = payment.Signature
+	return channel
+}
+
+func (suite *ValidationTestSuite) TestVerifyChannelSignature() {
+	err := VerifyChannelSignature(suite.signedChannel(suite.signerPrivateKey), suite.mpeContractAddress)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestVerifyChannelSignatureUnset() {
+	err := VerifyChannelSignature(suite.channel(), suite.mpeContractAddress)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestVerifyChannelSignatureIncorrectSigner() {
+	privateKey := GenerateTestPrivateKey()
+
+	err := VerifyChannelSignature(suite.signedChannel(privateKey), suite.mpeContractAddress)
+
+	assert.Equal(suite.T(), fmt.Errorf("channel signature is not signed by channel signer, signer: %v", crypto.PubkeyToAddress(privateKey.PublicKey).Hex()), err)
+}
+
+func (suite *ValidationTestSuite) TestVerifyChannelSignatureIncorrectAmount() {
+	channel := suite.signedChannel(suite.signerPrivateKey)
+	channel.AuthorizedAmount = big.NewInt(12301)
+
+	err := VerifyChannelSignature(channel, suite.mpeContractAddress)
+
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *ValidationTestSuite) TestVerifyChannelSignatureMalformed() {
+	channel := suite.channel()
+	channel.Signature = []byte{0x1}
+
+	err := VerifyChannelSignature(channel, suite.mpeContractAddress)
+
+	assert.Equal(suite.T(), errors.New("channel signature is not valid: incorrect signature length"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidateConcurrencyLimit() {
+	var inFlight, maxInFlight int32
+	validator := &ChannelPaymentValidator{
+		currentBlock: func() (*big.Int, error) {
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return big.NewInt(99), nil
+		},
+		paymentExpirationThreshold: func() *big.Int { return big.NewInt(0) },
+	}
+	WithConcurrencyLimit(3, false)(validator)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := validator.Validate(suite.payment(), suite.channel())
+			assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+		}()
+	}
+	wg.Wait()
+
+	assert.True(suite.T(), atomic.LoadInt32(&maxInFlight) <= 3, "max in flight: %v", maxInFlight)
+}
+
+func (suite *ValidationTestSuite) blockedValidator(failFast bool) (validator *ChannelPaymentValidator, started, release chan struct{}) {
+	started = make(chan struct{})
+	release = make(chan struct{})
+	validator = &ChannelPaymentValidator{
+		currentBlock: func() (*big.Int, error) {
+			started <- struct{}{}
+			<-release
+			return big.NewInt(99), nil
+		},
+		paymentExpirationThreshold: func() *big.Int { return big.NewInt(0) },
+	}
+	WithConcurrencyLimit(1, failFast)(validator)
+	return
+}
+
+func (suite *ValidationTestSuite) TestValidateConcurrencyLimitFailFast() {
+	validator, started, release := suite.blockedValidator(true)
+	done := make(chan error)
+	go func() { done <- validator.Validate(suite.payment(), suite.channel()) }()
+	<-started
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	close(release)
+	assert.Equal(suite.T(), NewPaymentError(Internal, "too many concurrent validations"), err)
+	assert.Nil(suite.T(), <-done)
+}
+
+func (suite *ValidationTestSuite) TestValidateConcurrencyLimitContextDone() {
+	validator, started, release := suite.blockedValidator(false)
+	done := make(chan error)
+	go func() { done <- validator.Validate(suite.payment(), suite.channel()) }()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := validator.ValidateContext(ctx, suite.payment(), suite.channel())
+
+	close(release)
+	assert.Equal(suite.T(), NewPaymentError(Internal, "validation is cancelled: context deadline exceeded"), err)
+	assert.Nil(suite.T(), <-done)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelID() {
+	var lookupChannelID, lookupNonce *big.Int
+	lookup := func(channelID, nonce *big.Int) (*PaymentChannelData, error) {
+		lookupChannelID, lookupNonce = channelID, nonce
+		return suite.channel(), nil
+	}
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), lookup)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), big.NewInt(42), lookupChannelID)
+	assert.Equal(suite.T(), big.NewInt(3), lookupNonce)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDNotFound() {
+	lookup := func(channelID, nonce *big.Int) (*PaymentChannelData, error) {
+		return nil, nil
+	}
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), lookup)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel \"42\" not found"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDLookupError() {
+	lookup := func(channelID, nonce *big.Int) (*PaymentChannelData, error) {
+		return nil, errors.New("storage error")
+	}
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), lookup)
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "payment channel error: storage error"), err)
+}
+
+type chainChannelReaderMock struct {
+	channel *PaymentChannelData
+	err     error
+	keys    []*PaymentChannelKey
+}
+
+func (reader *chainChannelReaderMock) GetChannelStateFromBlockchain(key *PaymentChannelKey) (*PaymentChannelData, bool, error) {
+	reader.keys = append(reader.keys, key)
+	if reader.err != nil {
+		return nil, false, reader.err
+	}
+	return reader.channel, reader.channel != nil, nil
+}
+
+func unknownChannelLookup(channelID, nonce *big.Int) (*PaymentChannelData, error) {
+	return nil, nil
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDRejectUnknownChannel() {
+	reader := &chainChannelReaderMock{channel: suite.channel()}
+	WithUnknownChannelPolicy(RejectUnknownChannel, reader)(&suite.validator)
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), unknownChannelLookup)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel \"42\" not found"), err)
+	assert.Empty(suite.T(), reader.keys)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDFetchUnknownChannelFromChain() {
+	reader := &chainChannelReaderMock{channel: suite.channel()}
+	WithUnknownChannelPolicy(FetchUnknownChannelFromChain, reader)(&suite.validator)
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), unknownChannelLookup)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Equal(suite.T(), []*PaymentChannelKey{{ID: big.NewInt(42)}}, reader.keys)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDFetchUnknownChannelValidatesPayment() {
+	channel := suite.channel()
+	channel.FullAmount = big.NewInt(12344)
+	reader := &chainChannelReaderMock{channel: channel}
+	WithUnknownChannelPolicy(FetchUnknownChannelFromChain, reader)(&suite.validator)
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), unknownChannelLookup)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "not enough tokens on payment channel, channel amount: 12344, payment amount: 12345"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDFetchUnknownChannelNotFoundOnChain() {
+	reader := &chainChannelReaderMock{}
+	WithUnknownChannelPolicy(FetchUnknownChannelFromChain, reader)(&suite.validator)
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), unknownChannelLookup)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel \"42\" not found"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDFetchUnknownChannelError() {
+	reader := &chainChannelReaderMock{err: errors.New("node is unavailable")}
+	WithUnknownChannelPolicy(FetchUnknownChannelFromChain, reader)(&suite.validator)
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), unknownChannelLookup)
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot fetch payment channel from blockchain: node is unavailable"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDFetchUnknownChannelWithoutReader() {
+	WithUnknownChannelPolicy(FetchUnknownChannelFromChain, nil)(&suite.validator)
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), unknownChannelLookup)
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "blockchain channel reader is not configured"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidateByChannelIDKnownChannelIsNotFetched() {
+	reader := &chainChannelReaderMock{}
+	WithUnknownChannelPolicy(FetchUnknownChannelFromChain, reader)(&suite.validator)
+	lookup := func(channelID, nonce *big.Int) (*PaymentChannelData, error) {
+		return suite.channel(), nil
+	}
+
+	err := suite.validator.ValidateByChannelID(suite.payment(), lookup)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), reader.keys)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentPersistence() {
+	storage := NewPaymentStorage(NewMemStorage())
+	validator := suite.validator
+	WithPaymentPersistence(storage)(&validator)
+	payment := suite.payment()
+
+	err := validator.Validate(payment, suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	payments, err := storage.GetAll()
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []*Payment{payment}, payments)
+}
+
+func (suite *ValidationTestSuite) TestValidateInvalidPaymentIsNotPersisted() {
+	storage := NewPaymentStorage(NewMemStorage())
+	validator := suite.validator
+	WithPaymentPersistence(storage)(&validator)
+	payment := suite.payment()
+	payment.Amount = big.NewInt(12346)
+	SignTestPayment(payment, suite.signerPrivateKey)
+
+	err := validator.Validate(payment, suite.channel())
+
+	assert.NotNil(suite.T(), err)
+	payments, err := storage.GetAll()
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), payments)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentPersistenceError() {
+	storage := NewPaymentStorage(&failingAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage error")})
+	validator := suite.validator
+	WithPaymentPersistence(storage)(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot save payment: storage error"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentReadOnly() {
+	memoryStorage := NewMemStorage()
+	readOnlyStorage := NewReadOnlyAtomicStorage(memoryStorage)
+	validator := suite.validator
+	WithPaymentPersistence(NewPaymentStorage(readOnlyStorage))(&validator)
+	WithPendingPayments(NewPendingPaymentStorage(readOnlyStorage, NewPaymentStorage(readOnlyStorage)))(&validator)
+	WithReadOnly()(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	assert.Empty(suite.T(), memoryStorage.data)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentReadOnlyInvalidPayment() {
+	validator := suite.validator
+	WithReadOnly()(&validator)
+	payment := suite.payment()
+	payment.Amount = big.NewInt(12346)
+	SignTestPayment(payment, suite.signerPrivateKey)
+
+	err := validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "not enough tokens on payment channel, channel amount: 12345, payment amount: 12346"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentReadOnlyStorageWithoutReadOnlyMode() {
+	validator := suite.validator
+	WithPaymentPersistence(NewPaymentStorage(NewReadOnlyAtomicStorage(NewMemStorage())))(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot save payment: storage is read-only"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSignatureOfAnotherChannel() {
+	payment := suite.payment()
+	payment.ChannelID = big.NewInt(43)
+	channel := suite.channel()
+	channel.ChannelID = big.NewInt(43)
+
+	err := suite.validator.Validate(payment, channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSignatureOfTruncatedChannelID() {
+	payment := suite.payment()
+	payment.ChannelID = new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(42))
+	channel := suite.channel()
+	channel.ChannelID = payment.ChannelID
+
+	err := suite.validator.Validate(payment, channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel id doesn't fit into 256 bits"), err)
+}
+
+func (suite *ValidationTestSuite) TestGetPaymentMessageDependsOnChannelID() {
+	payment := suite.payment()
+	another := suite.payment()
+	another.ChannelID = big.NewInt(43)
+
+	message, err := getPaymentMessage(payment)
+	assert.Nil(suite.T(), err)
+	anotherMessage, err := getPaymentMessage(another)
+	assert.Nil(suite.T(), err)
+
+	assert.NotEqual(suite.T(), message, anotherMessage)
+}
+
+func (suite *ValidationTestSuite) TestGetPaymentMessageFieldsAreNotAmbiguous() {
+	payment := suite.payment()
+	payment.ChannelID, payment.ChannelNonce = big.NewInt(4), big.NewInt(23)
+	another := suite.payment()
+	another.ChannelID, another.ChannelNonce = big.NewInt(42), big.NewInt(3)
+
+	message, err := getPaymentMessage(payment)
+	assert.Nil(suite.T(), err)
+	anotherMessage, err := getPaymentMessage(another)
+	assert.Nil(suite.T(), err)
+
+	assert.NotEqual(suite.T(), message, anotherMessage)
+}
+
+func (suite *ValidationTestSuite) TestGetPaymentMessageRejectsNegativeAmount() {
+	payment := suite.payment()
+	payment.Amount = big.NewInt(-12300)
+
+	_, err := getPaymentMessage(payment)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment amount is negative"), err)
+}
+
+func (suite *ValidationTestSuite) contextBoundPayment(context []byte) *Payment {
+	payment := suite.payment()
+	payment.PreimageScheme = ContextBoundPreimage
+	payment.ContextBytes = context
+	SignTestPayment(payment, suite.signerPrivateKey)
+	return payment
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentWithMatchingContext() {
+	payment := suite.contextBoundPayment([]byte("request hash"))
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentWithMismatchedContext() {
+	payment := suite.contextBoundPayment([]byte("request hash"))
+	payment.ContextBytes = []byte("another request hash")
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidateContextBoundPaymentWithDefaultScheme() {
+	payment := suite.contextBoundPayment([]byte("request hash"))
+	payment.PreimageScheme = DefaultPreimage
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment context bytes are not signed by default preimage scheme"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentWithUnsupportedPreimageScheme() {
+	payment := suite.payment()
+	payment.PreimageScheme = PreimageScheme(7)
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "unsupported payment preimage scheme: 7"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSignatureOfNegatedChannelID() {
+	payment := suite.payment()
+	payment.ChannelID = new(big.Int).Neg(payment.ChannelID)
+	channel := suite.channel()
+	channel.ChannelID = payment.ChannelID
+
+	err := suite.validator.Validate(payment, channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel id is negative"), err)
+}
+
+func (suite *ValidationTestSuite) TestGetPaymentMessageIsCanonical() {
+	payment := suite.payment()
+	payment.ChannelNonce = big.NewInt(3)
+	another := suite.payment()
+	another.ChannelNonce = new(big.Int).SetBytes([]byte{0, 0, 0, 3})
+
+	message, err := getPaymentMessage(payment)
+	assert.Nil(suite.T(), err)
+	anotherMessage, err := getPaymentMessage(another)
+	assert.Nil(suite.T(), err)
+
+	assert.Equal(suite.T(), message, anotherMessage)
+	assert.Equal(suite.T(), 20+3*32, len(message))
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentChannelExpiredAtLatestBlock() {
+	validator := suite.validator
+	validator.currentBlock = func() (*big.Int, error) { return big.NewInt(100), nil }
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 100, current block: 100, expiration threshold: 0"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentChannelNotExpiredAtConfirmedBlock() {
+	validator := suite.validator
+	validator.currentBlock = func() (*big.Int, error) { return big.NewInt(100), nil }
+	WithBlockConfirmations(2)(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentChannelExpiredAtConfirmedBlock() {
+	validator := suite.validator
+	validator.currentBlock = func() (*big.Int, error) { return big.NewInt(102), nil }
+	WithBlockConfirmations(2)(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 100, current block: 100, expiration threshold: 0"), err)
+}
+
+func (suite *ValidationTestSuite) TestConfirmedBlockIsNotNegative() {
+	validator := suite.validator
+	WithBlockConfirmations(10)(&validator)
+
+	assert.Equal(suite.T(), big.NewInt(0), validator.confirmedBlock(big.NewInt(5)))
+	assert.Equal(suite.T(), big.NewInt(5), validator.confirmedBlock(big.NewInt(15)))
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentExpirationAtHorizon() {
+	validator := suite.validator
+	WithMaxExpirationHorizon(big.NewInt(1))(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentExpirationBeyondHorizon() {
+	validator := suite.validator
+	WithMaxExpirationHorizon(big.NewInt(1))(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(101)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "implausible channel expiration"), err)
+}
+
+func (suite *ValidationTestSuite) validatorWithClaims(claims ...*Payment) ChannelPaymentValidator {
+	claimStorage := NewPaymentStorage(NewMemStorage())
+	for _, claim := range claims {
+		assert.Nil(suite.T(), claimStorage.Put(claim))
+	}
+	validator := suite.validator
+	WithClaimedNonceDetection(claimStorage)(&validator)
+	return validator
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentNonceAdvancedByClaim() {
+	claim := suite.payment()
+	validator := suite.validatorWithClaims(claim)
+	payment := suite.payment()
+	payment.ChannelNonce = big.NewInt(4)
+	SignTestPayment(payment, suite.signerPrivateKey)
+
+	err := validator.Validate(payment, suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentOldNonceAfterClaim() {
+	claim := suite.payment()
+	validator := suite.validatorWithClaims(claim)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(IncorrectNonce, "incorrect payment channel nonce, latest: 4, sent: 3"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentClaimOfOlderNonce() {
+	claim := suite.payment()
+	claim.ChannelNonce = big.NewInt(1)
+	validator := suite.validatorWithClaims(claim)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+type failingReadsAtomicStorage struct {
+	AtomicStorage
+	err error
+}
+
+func (storage *failingReadsAtomicStorage) GetByKeyPrefix(prefix string) (values []string, err error) {
+	return nil, storage.err
+}
+
+func (suite *ValidationTestSuite) validatorWithUnavailableClaims(options ...ChannelPaymentValidatorOption) ChannelPaymentValidator {
+	claimStorage := NewPaymentStorage(&failingReadsAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage is unavailable")})
+	validator := suite.validator
+	WithClaimedNonceDetection(claimStorage)(&validator)
+	for _, option := range options {
+		option(&validator)
+	}
+	return validator
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentClaimStorageFailureFailClosed() {
+	validator := suite.validatorWithUnavailableClaims(WithClaimStorageFailurePolicy(FailClosed))
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot read latest claimed nonce: storage is unavailable"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentClaimStorageFailureFailClosedByDefault() {
+	validator := suite.validatorWithUnavailableClaims()
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot read latest claimed nonce: storage is unavailable"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentClaimStorageFailureFailOpen() {
+	validator := suite.validatorWithUnavailableClaims(WithClaimStorageFailurePolicy(FailOpen))
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentClaimStorageFailureFailOpenChecksSignature() {
+	validator := suite.validatorWithUnavailableClaims(WithClaimStorageFailurePolicy(FailOpen))
+	payment := suite.payment()
+	SignTestPayment(payment, GenerateTestPrivateKey())
+
+	err := validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func (suite *ValidationTestSuite) validatorWithGroupThresholds() ChannelPaymentValidator {
+	validator := suite.validator
+	WithGroupExpirationThresholds(func(groupID [32]byte) (*big.Int, bool) {
+		switch groupID {
+		case [32]byte{1}:
+			return big.NewInt(5), true
+		case [32]byte{2}:
+			return big.NewInt(20), true
+		}
+		return nil, false
+	})(&validator)
+	return validator
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentGroupExpirationThresholds() {
+	validator := suite.validatorWithGroupThresholds()
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(110)
+	channel.GroupID = [32]byte{1}
+	anotherChannel := suite.channel()
+	anotherChannel.Expiration = big.NewInt(110)
+	anotherChannel.GroupID = [32]byte{2}
+
+	err := validator.Validate(suite.payment(), channel)
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	err = validator.Validate(suite.payment(), anotherChannel)
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 110, current block: 99, expiration threshold: 20"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentUnknownGroupUsesDefaultThreshold() {
+	validator := suite.validatorWithGroupThresholds()
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentExpirationThresholdPoliciesStrictestFails() {
+	validator := suite.validator
+	absolute := func() *big.Int { return big.NewInt(5) }
+	percentage := func() *big.Int { return big.NewInt(15) }
+	WithExpirationThresholdPolicies(absolute, percentage)(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(110)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 110, current block: 99, expiration threshold: 15"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentExpirationThresholdPoliciesAllPass() {
+	validator := suite.validator
+	WithExpirationThresholdPolicies(func() *big.Int { return big.NewInt(5) }, func() *big.Int { return big.NewInt(10) })(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(110)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentExpirationThresholdPoliciesStricterThanGroupThreshold() {
+	validator := suite.validatorWithGroupThresholds()
+	WithExpirationThresholdPolicies(func() *big.Int { return big.NewInt(12) })(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(110)
+	channel.GroupID = [32]byte{1}
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 110, current block: 99, expiration threshold: 12"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentNearExpirationWithinSkewTolerance() {
+	validator := suite.validator
+	WithExpirationThresholdPolicies(func() *big.Int { return big.NewInt(12) })(&validator)
+	WithBlockSkewTolerance(2)(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(110)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentNearExpirationBeyondSkewTolerance() {
+	validator := suite.validator
+	WithExpirationThresholdPolicies(func() *big.Int { return big.NewInt(13) })(&validator)
+	WithBlockSkewTolerance(2)(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(110)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 110, current block: 99, expiration threshold: 11"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSkewToleranceDoesNotMakeThresholdNegative() {
+	validator := suite.validator
+	WithBlockSkewTolerance(5)(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(99)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 99, current block: 99, expiration threshold: 0"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentBeyondHorizonWithinSkewTolerance() {
+	validator := suite.validator
+	WithMaxExpirationHorizon(big.NewInt(1))(&validator)
+	WithBlockSkewTolerance(2)(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(102)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentBeyondHorizonAndSkewTolerance() {
+	validator := suite.validator
+	WithMaxExpirationHorizon(big.NewInt(1))(&validator)
+	WithBlockSkewTolerance(2)(&validator)
+	channel := suite.channel()
+	channel.Expiration = big.NewInt(103)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "implausible channel expiration"), err)
+}
+
+func (suite *ValidationTestSuite) validatorWithSpendingCap(spent int64) (ChannelPaymentValidator, *SpendingCapTracker) {
+	validator := suite.validator
+	tracker := NewSpendingCapTracker(NewMemStorage(), big.NewInt(100))
+	_, _, err := tracker.Authorize(suite.signerAddress, big.NewInt(spent))
+	assert.Nil(suite.T(), err)
+	WithSpendingCaps(tracker)(&validator)
+	return validator, tracker
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentBelowSpendingCap() {
+	validator, tracker := suite.validatorWithSpendingCap(40)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	spent, _ := tracker.Spent(suite.signerAddress)
+	assert.Equal(suite.T(), big.NewInt(85), spent)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentAtSpendingCap() {
+	validator, tracker := suite.validatorWithSpendingCap(55)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	spent, _ := tracker.Spent(suite.signerAddress)
+	assert.Equal(suite.T(), big.NewInt(100), spent)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentAboveSpendingCap() {
+	validator, tracker := suite.validatorWithSpendingCap(56)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(SpendingCapExceeded, "payment signer %v exceeds spending cap 100", blockchain.AddressToHex(&suite.signerAddress)), err)
+	spent, _ := tracker.Spent(suite.signerAddress)
+	assert.Equal(suite.T(), big.NewInt(56), spent)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSpendingCapIsNotChargedInReadOnlyMode() {
+	validator, tracker := suite.validatorWithSpendingCap(55)
+	WithReadOnly()(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	spent, _ := tracker.Spent(suite.signerAddress)
+	assert.Equal(suite.T(), big.NewInt(55), spent)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSpendingCapIsRefundedOnPersistenceError() {
+	validator, tracker := suite.validatorWithSpendingCap(40)
+	WithPaymentPersistence(NewPaymentStorage(&failingAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage error")}))(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot save payment: storage error"), err)
+	spent, _ := tracker.Spent(suite.signerAddress)
+	assert.Equal(suite.T(), big.NewInt(40), spent)
+}
+
+func (suite *ValidationTestSuite) TestReleasePaymentRefundsSpendingCap() {
+	validator, tracker := suite.validatorWithSpendingCap(40)
+	payment := suite.payment()
+	channel := suite.channel()
+	err := validator.Validate(payment, channel)
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+
+	err = validator.ReleasePayment(payment, channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+	spent, _ := tracker.Spent(suite.signerAddress)
+	assert.Equal(suite.T(), big.NewInt(40), spent)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentBelowAuthorizedAmountDoesNotChangeSpendingCap() {
+	validator, tracker := suite.validatorWithSpendingCap(40)
+	payment := suite.payment()
+	payment.Amount = big.NewInt(12000)
+	SignTestPayment(payment, suite.signerPrivateKey)
+	channel := suite.channel()
+
+	errValidate := validator.Validate(payment, channel)
+	spentValidated, _ := tracker.Spent(suite.signerAddress)
+	errRelease := validator.ReleasePayment(payment, channel)
+	spentReleased, _ := tracker.Spent(suite.signerAddress)
+
+	assert.Nil(suite.T(), errValidate, "Unexpected error: %v", errValidate)
+	assert.Nil(suite.T(), errRelease, "Unexpected error: %v", errRelease)
+	assert.Equal(suite.T(), big.NewInt(40), spentValidated)
+	assert.Equal(suite.T(), big.NewInt(40), spentReleased)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSpendingCapStorageError() {
+	validator := suite.validator
+	WithSpendingCaps(NewSpendingCapTracker(&failingGetAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage error")}, big.NewInt(100)))(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot read signer spending: storage error"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSpendingCapStorageErrorIgnoresClaimStorageFailurePolicy() {
+	validator := suite.validator
+	WithClaimStorageFailurePolicy(FailOpen)(&validator)
+	WithSpendingCaps(NewSpendingCapTracker(&failingGetAtomicStorage{AtomicStorage: NewMemStorage(), err: errors.New("storage error")}, big.NewInt(100)))(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Internal, "cannot read signer spending: storage error"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentCallDeadlineWithinChannelLife() {
+	payment := suite.payment()
+	payment.CallDeadline = big.NewInt(99)
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentCallDeadlineAtChannelExpiration() {
+	payment := suite.payment()
+	payment.CallDeadline = big.NewInt(100)
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(ChannelExtensionRequired, "payment channel expires at block 100 which is not after call deadline 100, please extend the channel"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentCallDeadlineBeyondChannelLife() {
+	payment := suite.payment()
+	payment.CallDeadline = big.NewInt(150)
+
+	err := suite.validator.Validate(payment, suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(ChannelExtensionRequired, "payment channel expires at block 100 which is not after call deadline 150, please extend the channel"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentLeavesCapacityAboveMinimum() {
+	validator := suite.validator
+	WithMinRemainingCapacity(big.NewInt(10))(&validator)
+	channel := suite.channel()
+	channel.FullAmount = big.NewInt(12355)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentLeavesCapacityBelowMinimum() {
+	validator := suite.validator
+	WithMinRemainingCapacity(big.NewInt(10))(&validator)
+	channel := suite.channel()
+	channel.FullAmount = big.NewInt(12354)
+
+	err := validator.Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(LowRemainingCapacity, "remaining channel capacity 9 is below minimum 10, channel should be topped up"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentOfAllowedGroup() {
+	validator := suite.validator
+	WithAllowedGroupIDs([32]byte{1}, [32]byte{123})(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentOfDisabledGroup() {
+	validator := suite.validator
+	WithAllowedGroupIDs([32]byte{1})(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(GroupNotAllowed, "payment channel group 7b00000000000000000000000000000000000000000000000000000000000000 is not allowed"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentOfAllowedSender() {
+	validator := suite.validator
+	WithAllowedSenders(common.HexToAddress("0x01"), suite.senderAddress)(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentOfDisallowedSender() {
+	validator := suite.validator
+	WithAllowedSenders(common.HexToAddress("0x01"))(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(SenderNotAllowed, "payment channel sender %v is not allowed", blockchain.AddressToHex(&suite.senderAddress)), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentWithEmptyAllowedSenders() {
+	validator := suite.validator
+	WithAllowedSenders()(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidateAtBlock() {
+	validator := suite.validator
+	validator.currentBlock = func() (*big.Int, error) { return nil, errors.New("blockchain is not available") }
+
+	assert.Nil(suite.T(), validator.ValidateAtBlock(suite.payment(), suite.channel(), big.NewInt(98)))
+	assert.Nil(suite.T(), validator.ValidateAtBlock(suite.payment(), suite.channel(), big.NewInt(99)))
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 100, current block: 100, expiration threshold: 0"),
+		validator.ValidateAtBlock(suite.payment(), suite.channel(), big.NewInt(100)))
+}
+
+func (suite *ValidationTestSuite) TestValidateAtBlockWithConfirmations() {
+	validator := suite.validator
+	WithBlockConfirmations(2)(&validator)
+
+	assert.Nil(suite.T(), validator.ValidateAtBlock(suite.payment(), suite.channel(), big.NewInt(101)))
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment channel is near to be expired, expiration time: 100, current block: 100, expiration threshold: 0"),
+		validator.ValidateAtBlock(suite.payment(), suite.channel(), big.NewInt(102)))
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentCustomSignaturePrefix() {
+	prefix := []byte("\x19Custom Signed Message:\n32")
+	validator := suite.validator
+	WithSignaturePrefix(prefix)(&validator)
+	payment := suite.payment()
+	message, err := getPaymentMessage(payment)
+	assert.Nil(suite.T(), err)
+	payment.Signature, err = crypto.Sign(crypto.Keccak256(prefix, crypto.Keccak256(message)), suite.signerPrivateKey)
+	assert.Nil(suite.T(), err)
+
+	err = validator.Validate(payment, suite.channel())
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentCustomSignaturePrefixRejectsEthereumSignature() {
+	validator := suite.validator
+	WithSignaturePrefix([]byte("\x19Custom Signed Message:\n32"))(&validator)
+
+	err := validator.Validate(suite.payment(), suite.channel())
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func (suite *ValidationTestSuite) channelWithPaymentSigner(paymentSigner common.Address) *PaymentChannelData {
+	channel := suite.channel()
+	channel.PaymentSigner = paymentSigner
+	return channel
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSignedByPaymentSigner() {
+	paymentSignerKey := GenerateTestPrivateKey()
+	channel := suite.channelWithPaymentSigner(crypto.PubkeyToAddress(paymentSignerKey.PublicKey))
+	payment := suite.payment()
+	SignTestPayment(payment, paymentSignerKey)
+
+	err := suite.validator.Validate(payment, channel)
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSignedBySignerWhenPaymentSignerIsSet() {
+	channel := suite.channelWithPaymentSigner(crypto.PubkeyToAddress(GenerateTestPrivateKey().PublicKey))
+
+	err := suite.validator.Validate(suite.payment(), channel)
+
+	assert.Equal(suite.T(), NewPaymentError(Unauthenticated, "payment is not signed by channel signer"), err)
+}
+
+func (suite *ValidationTestSuite) TestValidatePaymentSignedBySignerWhenPaymentSignerIsNotSet() {
+	err := suite.validator.Validate(suite.payment(), suite.channelWithPaymentSigner(common.Address{}))
+
+	assert.Nil(suite.T(), err, "Unexpected error: %v", err)
+}
+
+func TestValidatePaymentWithMissingField(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch func(payment *Payment, channel *PaymentChannelData)
+	}{
+		{"payment.ChannelID", func(payment *Payment, channel *PaymentChannelData) { payment.ChannelID = nil }},
+		{"payment.ChannelNonce", func(payment *Payment, channel *PaymentChannelData) { payment.ChannelNonce = nil }},
+		{"payment.Amount", func(payment *Payment, channel *PaymentChannelData) { payment.Amount = nil }},
+		{"channel.Nonce", func(payment *Payment, channel *PaymentChannelData) { channel.Nonce = nil }},
+		{"channel.FullAmount", func(payment *Payment, channel *PaymentChannelData) { channel.FullAmount = nil }},
+		{"channel.AuthorizedAmount", func(payment *Payment, channel *PaymentChannelData) { channel.AuthorizedAmount = nil }},
+		{"channel.Expiration", func(payment *Payment, channel *PaymentChannelData) { channel.Expiration = nil }},
+	}
+
+	fixtures := newTestFixtures("missing")
+	for _, test := range tests {
+		payment := fixtures.Payment(42, 3, 12345)
+		channel := fixtures.Channel(42, 3, 12345, 12300, 100)
+		test.patch(payment, channel)
+		validator := ChannelPaymentValidatorMock()
+		WithPriceIncrementCheck(func() *big.Int { return big.NewInt(45) })(validator)
+
+		var err error
+		assert.NotPanics(t, func() { err = validator.Validate(payment, channel) }, test.name)
+
+		assert.Equal(t, NewPaymentError(Internal, "missing payment field: %v", test.name), err, test.name)
+	}
+}
+
+func TestGetSignerAddressFromPaymentWithMissingField(t *testing.T) {
+	payment := newTestFixtures("missing").Payment(42, 3, 12345)
+	payment.Amount = nil
+
+	var err error
+	assert.NotPanics(t, func() { _, err = getSignerAddressFromPayment(payment) })
+
+	assert.Equal(t, NewPaymentError(Unauthenticated, "payment amount is not set"), err)
+}
+
+func TestNextExpectedFreshChannel(t *testing.T) {
+	channel := newTestFixtures("next").Channel(42, 3, 12345, 0, 100)
+
+	nonce, amount := NextExpected(channel, big.NewInt(45))
+
+	assert.Equal(t, big.NewInt(3), nonce)
+	assert.Equal(t, big.NewInt(45), amount)
+}
+
+func TestNextExpectedPartiallyUsedChannel(t *testing.T) {
+	channel := newTestFixtures("next").Channel(42, 3, 12345, 12300, 100)
+
+	nonce, amount := NextExpected(channel, big.NewInt(45))
+
+	assert.Equal(t, big.NewInt(3), nonce)
+	assert.Equal(t, big.NewInt(12345), amount)
+	validator := ChannelPaymentValidatorMock()
+	WithPriceIncrementCheck(func() *big.Int { return big.NewInt(45) })(validator)
+	assert.Nil(t, validator.Validate(newTestFixtures("next").Payment(42, nonce.Int64(), amount.Int64()), channel))
+}
+
+func TestNextExpectedChannelWithoutAuthorizedAmount(t *testing.T) {
+	channel := newTestFixtures("next").Channel(42, 5, 12345, 0, 100)
+	channel.AuthorizedAmount = nil
+
+	nonce, amount := NextExpected(channel, big.NewInt(45))
+
+	assert.Equal(t, big.NewInt(5), nonce)
+	assert.Equal(t, big.NewInt(45), amount)
+}
+
+func TestNextExpectedChannelWithOtherTokenDecimals(t *testing.T) {
+	channel := newTestFixtures("next").Channel(42, 3, 12345, 100, 100)
+
+	channel.TokenDecimals = 18
+	_, amount := NextExpected(channel, big.NewInt(45))
+	assert.Equal(t, bigIntFromString("450000000100"), amount)
+
+	channel.TokenDecimals = 6
+	_, amount = NextExpected(channel, big.NewInt(450))
+	assert.Equal(t, big.NewInt(105), amount)
+
+	_, amount = NextExpected(channel, big.NewInt(451))
+	assert.Equal(t, big.NewInt(105), amount)
+
+	_, amount = NextExpected(channel, big.NewInt(401))
+	assert.Equal(t, big.NewInt(105), amount)
+}
@@ -0,0 +1,54 @@
+package escrow
+
+import (
+	"context"
+)
+
+// ValidationTracer creates spans for the payment validation steps, so escrow
+// doesn't depend on the tracing library. OpenTelemetry adapter is provided by
+// escrow/oteltracing package.
+type ValidationTracer interface {
+	// StartSpan starts span with given name and attributes as a child of the
+	// span kept in ctx, returned context keeps the started span.
+	StartSpan(ctx context.Context, name string, attributes []SpanAttribute) (context.Context, ValidationSpan)
+}
+
+// ValidationSpan is a span started by ValidationTracer.
+type ValidationSpan interface {
+	// End ends span, outcome is either "valid" or name of the
+	// PaymentErrorCode, err is the error traced step failed with or nil.
+	End(outcome string, err error)
+}
+
+// SpanAttribute is a key-value attribute of the span.
+type SpanAttribute struct {
+	Key   string
+	Value string
+}
+
+type noopValidationTracer struct{}
+
+func (noopValidationTracer) StartSpan(ctx context.Context, name string, attributes []SpanAttribute) (context.Context, ValidationSpan) {
+	return ctx, noopValidationSpan{}
+}
+
+type noopValidationSpan struct{}
+
+func (noopValidationSpan) End(outcome string, err error) {}
+
+func (validator *ChannelPaymentValidator) getTracer() ValidationTracer {
+	if validator.tracer == nil {
+		return noopValidationTracer{}
+	}
+	return validator.tracer
+}
+
+// endValidationSpan ends span with outcome which is either "valid" or name
+// of the PaymentErrorCode.
+func endValidationSpan(span ValidationSpan, err error) {
+	if err == nil {
+		span.End("valid", nil)
+	} else {
+		span.End(paymentErrorCode(err).String(), err)
+	}
+}
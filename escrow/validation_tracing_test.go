@@ -0,0 +1,105 @@
+package escrow
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedSpan struct {
+	name       string
+	parent     *recordedSpan
+	attributes []SpanAttribute
+	outcome    string
+	err        error
+}
+
+type recordedSpanKey struct{}
+
+// recordingTracer keeps ended spans in order they are ended
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (tracer *recordingTracer) StartSpan(ctx context.Context, name string, attributes []SpanAttribute) (context.Context, ValidationSpan) {
+	parent, _ := ctx.Value(recordedSpanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attributes: attributes}
+	return context.WithValue(ctx, recordedSpanKey{}, span), &recordingSpan{tracer: tracer, span: span}
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   *recordedSpan
+}
+
+func (span *recordingSpan) End(outcome string, err error) {
+	span.span.outcome = outcome
+	span.span.err = err
+	span.tracer.spans = append(span.tracer.spans, span.span)
+}
+
+func tracedValidator() (*ChannelPaymentValidator, *recordingTracer) {
+	tracer := &recordingTracer{}
+	validator := ChannelPaymentValidatorMock()
+	WithTracer(tracer)(validator)
+	return validator, tracer
+}
+
+func TestValidateTracing(t *testing.T) {
+	fixtures := newTestFixtures("tracing")
+	validator, tracer := tracedValidator()
+
+	err := validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+	spans := tracer.spans
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "ChannelPaymentValidator.currentBlock", spans[0].name)
+	assert.Equal(t, spans[1], spans[0].parent)
+	assert.Equal(t, "ChannelPaymentValidator.Validate", spans[1].name)
+	assert.Equal(t, []SpanAttribute{
+		{Key: "channelID", Value: "42"},
+		{Key: "nonce", Value: "3"},
+	}, spans[1].attributes)
+	assert.Equal(t, "valid", spans[1].outcome)
+	assert.Nil(t, spans[1].err)
+}
+
+func TestValidateTracingFailure(t *testing.T) {
+	fixtures := newTestFixtures("tracing")
+	validator, tracer := tracedValidator()
+
+	err := validator.Validate(fixtures.Payment(42, 2, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.NotNil(t, err)
+	spans := tracer.spans
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "ChannelPaymentValidator.Validate", spans[0].name)
+	assert.Equal(t, "IncorrectNonce", spans[0].outcome)
+	assert.Equal(t, err, spans[0].err)
+}
+
+func TestValidateTracingCurrentBlockFailure(t *testing.T) {
+	fixtures := newTestFixtures("tracing")
+	validator, tracer := tracedValidator()
+	validator.currentBlock = func() (*big.Int, error) { return nil, errors.New("blockchain error") }
+
+	validator.Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	spans := tracer.spans
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "ChannelPaymentValidator.currentBlock", spans[0].name)
+	assert.Equal(t, "Internal", spans[0].outcome)
+	assert.Equal(t, "Internal", spans[1].outcome)
+}
+
+func TestValidateWithoutTracer(t *testing.T) {
+	fixtures := newTestFixtures("tracing")
+
+	err := ChannelPaymentValidatorMock().Validate(fixtures.Payment(42, 3, 12345), fixtures.Channel(42, 3, 12345, 12300, 100))
+
+	assert.Nil(t, err, "Unexpected error: %v", err)
+}
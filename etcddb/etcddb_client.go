@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/singnet/snet-daemon/config"
+	"github.com/singnet/snet-daemon/escrow"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
@@ -122,6 +123,29 @@ func (client *EtcdClient) GetByKeyPrefix(key string) (values []string, err error
 	return
 }
 
+// GetKeysByPrefix gets all keys which have the same key prefix
+func (client *EtcdClient) GetKeysByPrefix(key string) (keys []string, err error) {
+
+	log := log.WithField("func", "GetKeysByPrefix").WithField("key", key).WithField("client", client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), client.timeout)
+	defer cancel()
+
+	keyEnd := clientv3.GetPrefixRangeEnd(key)
+	response, err := client.etcdv3.Get(ctx, key, clientv3.WithRange(keyEnd), clientv3.WithKeysOnly())
+
+	if err != nil {
+		log.WithError(err).Error("Unable to get keys by key prefix")
+		return
+	}
+
+	for _, kv := range response.Kvs {
+		keys = append(keys, string(kv.Key))
+	}
+
+	return
+}
+
 // Put puts key and value to etcd
 func (client *EtcdClient) Put(key string, value string) (err error) {
 	log := log.WithField("func", "Put").WithField("key", key).WithField("client", client)
@@ -204,6 +228,57 @@ func (client *EtcdClient) Transaction(compare []EtcdKeyValue, swap []EtcdKeyValu
 	return response.Succeeded, nil
 }
 
+// WithTransaction implements escrow.TransactionalAtomicStorage, changes
+// collected by fn are applied in a single etcd transaction
+func (client *EtcdClient) WithTransaction(fn func(tx escrow.StorageTx) error) (err error) {
+	log := log.WithField("func", "WithTransaction").WithField("client", client)
+
+	tx := &etcdTransaction{ops: make(map[string]clientv3.Op)}
+	if err = fn(tx); err != nil {
+		return
+	}
+
+	ops := make([]clientv3.Op, len(tx.keys))
+	for index, key := range tx.keys {
+		ops[index] = tx.ops[key]
+	}
+
+	etcdv3 := client.etcdv3
+	ctx, cancel := context.WithTimeout(context.Background(), client.timeout)
+	defer cancel()
+
+	_, err = etcdv3.KV.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		log = log.WithField("keys", strings.Join(tx.keys, ", "))
+		log.WithError(err).Error("Unable to apply transaction")
+	}
+
+	return err
+}
+
+// etcdTransaction collects operations of the transaction, etcd doesn't
+// allow changing the same key twice in one transaction so only last
+// operation on each key is kept
+type etcdTransaction struct {
+	keys []string
+	ops  map[string]clientv3.Op
+}
+
+func (tx *etcdTransaction) Put(key string, value string) {
+	tx.add(key, clientv3.OpPut(key, value))
+}
+
+func (tx *etcdTransaction) Delete(key string) {
+	tx.add(key, clientv3.OpDelete(key))
+}
+
+func (tx *etcdTransaction) add(key string, op clientv3.Op) {
+	if _, ok := tx.ops[key]; !ok {
+		tx.keys = append(tx.keys, key)
+	}
+	tx.ops[key] = op
+}
+
 // PutIfAbsent puts value if absent
 func (client *EtcdClient) PutIfAbsent(key string, value string) (ok bool, err error) {
 	log := log.WithField("func", "PutIfAbsent").WithField("key", key).WithField("client", client)
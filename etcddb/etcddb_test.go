@@ -2,6 +2,7 @@ package etcddb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/singnet/snet-daemon/escrow"
 )
 
 // TODO: initialize client and server only once to make test faster
@@ -132,6 +135,14 @@ func (suite *EtcdTestSuite) TestEtcdPutGet() {
 	for index, value := range values {
 		assert.Equal(t, keyValues[index].value, value)
 	}
+
+	keys, err := client.GetKeysByPrefix("key-range-bbb-")
+	assert.Nil(t, err)
+	assert.Equal(t, count, len(keys))
+
+	for index, key := range keys {
+		assert.Equal(t, keyValues[index].key, key)
+	}
 }
 
 func (suite *EtcdTestSuite) TestEtcdCAS() {
@@ -243,6 +254,46 @@ func (suite *EtcdTestSuite) TestEtcdTransaction() {
 	assertGet(suite, key3, update3)
 }
 
+func (suite *EtcdTestSuite) TestEtcdWithTransaction() {
+
+	t := suite.T()
+	client := suite.client
+
+	err := client.Put("deleted", "value")
+	assert.Nil(t, err)
+
+	err = escrow.WithTransaction(client, func(tx escrow.StorageTx) error {
+		tx.Put("payment", "payment value")
+		tx.Put("claim", "first value")
+		tx.Put("claim", "claim value")
+		tx.Delete("deleted")
+		return nil
+	})
+	assert.Nil(t, err)
+
+	assertGet(suite, "payment", "payment value")
+	assertGet(suite, "claim", "claim value")
+	_, ok, err := client.Get("deleted")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func (suite *EtcdTestSuite) TestEtcdWithTransactionRollback() {
+
+	t := suite.T()
+	client := suite.client
+
+	err := escrow.WithTransaction(client, func(tx escrow.StorageTx) error {
+		tx.Put("payment", "payment value")
+		return errors.New("claim cannot be written")
+	})
+	assert.Equal(t, errors.New("claim cannot be written"), err)
+
+	_, ok, err := client.Get("payment")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
 func (suite *EtcdTestSuite) TestEtcdNilValue() {
 
 	t := suite.T()
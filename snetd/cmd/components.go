@@ -171,12 +171,28 @@ func (components *Components) PaymentChannelService() escrow.PaymentChannelServi
 		return components.paymentChannelService
 	}
 
+	escrow.SetLogRedaction(config.GetBool(config.RedactPaymentLogsKey))
+
+	validator := escrow.NewChannelPaymentValidator(components.Blockchain(), config.Vip(), components.ServiceMetaData())
+	if err := validator.SelfTest(); err != nil {
+		log.WithError(err).Panic("payment validator self-test failed")
+	}
+
+	paymentStorage := escrow.NewPaymentStorage(components.AtomicStorage())
+	migrated, err := paymentStorage.MigrateLegacyKeys()
+	if err != nil {
+		log.WithError(err).Panic("cannot migrate payment storage keys")
+	}
+	if migrated > 0 {
+		log.WithField("migrated", migrated).Info("Payments are migrated to plain string keys")
+	}
+
 	components.paymentChannelService = escrow.NewPaymentChannelService(
 		escrow.NewPaymentChannelStorage(components.AtomicStorage()),
-		escrow.NewPaymentStorage(components.AtomicStorage()),
+		paymentStorage,
 		escrow.NewBlockchainChannelReader(components.Blockchain(), config.Vip(), components.ServiceMetaData()),
 		escrow.NewEtcdLocker(components.AtomicStorage()),
-		escrow.NewChannelPaymentValidator(components.Blockchain(), config.Vip(), components.ServiceMetaData()),func() ([32]byte, error) {
+		validator,func() ([32]byte, error) {
 			s := components.ServiceMetaData().GetDaemonGroupID()
 			return s, nil
 		},